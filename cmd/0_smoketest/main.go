@@ -0,0 +1,55 @@
+package main
+
+import (
+	"TDMR87/go_protohackers/internal/server"
+	"TDMR87/go_protohackers/internal/smoketest"
+	"log"
+	"log/slog"
+	"os"
+)
+
+// define registers the command's flags on config.
+func define(config *server.Config, f *server.Flags) {
+	config.AddFlags(f)
+	config.AddListenFlags(f, ":8080")
+	config.AddLimitFlags(f)
+	config.AddTCPFlags(f)
+}
+
+func main() {
+	config, flags, err := server.LoadConfig("smoketest", define)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if flags.Healthcheck() {
+		if err := config.CheckHealth(config.Addr, smoketest.CheckHealth); err != nil {
+			log.Fatal("Unhealthy: ", err)
+		}
+		return
+	}
+	if err := config.SetupLogging("smoketest"); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := config.SignalContext()
+	defer stop()
+	config.ServeEndpoints(ctx)
+
+	srv := smoketest.NewServer(config.Addr)
+	config.Configure(srv)
+	if config.RecordFile != "" {
+		recorder, err := server.OpenRecording(config.RecordFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer recorder.Close()
+		srv.Middleware = append(srv.Middleware, server.Record(recorder))
+	}
+	go server.WatchConfig(ctx, "smoketest", flags, define, func(next *server.Config) {
+		next.Reconfigure(srv)
+	})
+	if err := srv.Serve(ctx); err != nil {
+		slog.Error("Server stopped", "err", err)
+		os.Exit(1)
+	}
+}
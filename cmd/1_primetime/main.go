@@ -0,0 +1,78 @@
+package main
+
+import (
+	"TDMR87/go_protohackers/internal/primetime"
+	"TDMR87/go_protohackers/internal/server"
+	"errors"
+	"log"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// settings are the command's configuration.
+type settings struct {
+	server.Config
+}
+
+// define registers the command's flags on s.
+func (s *settings) define(f *server.Flags) {
+	s.AddFlags(f)
+	s.AddListenFlags(f, ":8080")
+	s.AddLimitFlags(f)
+	s.AddTCPFlags(f)
+	s.AddWebSocketFlags(f)
+}
+
+func main() {
+	config, flags, err := server.LoadConfig("primetime", (*settings).define)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if flags.Healthcheck() {
+		if err := config.CheckHealth(config.Addr, primetime.CheckHealth); err != nil {
+			log.Fatal("Unhealthy: ", err)
+		}
+		return
+	}
+	if err := config.SetupLogging("primetime"); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := config.SignalContext()
+	defer stop()
+	config.ServeEndpoints(ctx)
+
+	srv := primetime.NewServer(config.Addr)
+	config.Configure(srv)
+	if config.RecordFile != "" {
+		recorder, err := server.OpenRecording(config.RecordFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer recorder.Close()
+		srv.Middleware = append(srv.Middleware, server.Record(recorder))
+	}
+	go server.WatchConfig(ctx, "primetime", flags, (*settings).define, func(next *settings) {
+		next.Reconfigure(srv)
+	})
+
+	// Browsers can ask too, over WebSocket. Either server failing
+	// stops the other.
+	var websocket sync.WaitGroup
+	var websocketErr error
+	if config.WebSocketAddr != "" {
+		websocket.Go(func() {
+			if websocketErr = srv.ServeWebSocket(ctx, config.WebSocketAddr); websocketErr != nil {
+				stop()
+			}
+		})
+	}
+	err = srv.Serve(ctx)
+	stop()
+	websocket.Wait()
+	if err := errors.Join(err, websocketErr); err != nil {
+		slog.Error("Server stopped", "err", err)
+		os.Exit(1)
+	}
+}
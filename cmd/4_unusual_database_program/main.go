@@ -0,0 +1,54 @@
+package main
+
+import (
+	"TDMR87/go_protohackers/internal/server"
+	"TDMR87/go_protohackers/internal/unusualdatabase"
+	"log"
+	"log/slog"
+	"os"
+)
+
+// define registers the command's flags on config.
+func define(config *server.Config, f *server.Flags) {
+	config.AddFlags(f)
+	config.AddListenFlags(f, ":8080")
+	config.AddUdpFlags(f)
+}
+
+func main() {
+	config, flags, err := server.LoadConfig("unusual_database_program", define)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if flags.Healthcheck() {
+		if err := config.CheckUdpHealth(config.Addr, unusualdatabase.CheckHealth); err != nil {
+			log.Fatal("Unhealthy: ", err)
+		}
+		return
+	}
+	if err := config.SetupLogging("unusual_database_program"); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := config.SignalContext()
+	defer stop()
+	config.ServeEndpoints(ctx)
+
+	srv := unusualdatabase.NewServer(config.Addr)
+	config.ConfigureUdp(srv)
+	if config.RecordFile != "" {
+		recorder, err := server.OpenRecording(config.RecordFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer recorder.Close()
+		srv.Middleware = append(srv.Middleware, server.RecordUdp(recorder))
+	}
+	go server.WatchConfig(ctx, "unusual_database_program", flags, define, func(next *server.Config) {
+		next.Reconfigure(nil)
+	})
+	if err := srv.Serve(ctx); err != nil {
+		slog.Error("Server stopped", "err", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"TDMR87/go_protohackers/internal/mobinthemiddle"
+	"TDMR87/go_protohackers/internal/server"
+	"log"
+	"log/slog"
+	"os"
+)
+
+// settings are the command's configuration.
+type settings struct {
+	server.Config
+	proxy        mobinthemiddle.Settings
+	upstreamAddr string
+}
+
+// define registers the command's flags on s.
+func (s *settings) define(f *server.Flags) {
+	s.AddFlags(f)
+	s.AddListenFlags(f, ":8080")
+	s.AddLimitFlags(f)
+	s.AddTCPFlags(f)
+	s.proxy.AddFlags(f)
+	f.DialAddr(&s.upstreamAddr, "upstream-addr", mobinthemiddle.DefaultUpstream, "`address` of the Budget Chat server to proxy to")
+}
+
+func main() {
+	config, flags, err := server.LoadConfig("mob_in_the_middle", (*settings).define)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if flags.Healthcheck() {
+		if err := config.CheckHealth(config.Addr, mobinthemiddle.CheckHealth); err != nil {
+			log.Fatal("Unhealthy: ", err)
+		}
+		return
+	}
+	if err := config.SetupLogging("mob_in_the_middle"); err != nil {
+		log.Fatal(err)
+	}
+	config.proxy.Apply()
+
+	ctx, stop := config.SignalContext()
+	defer stop()
+	config.ServeEndpoints(ctx)
+
+	srv := mobinthemiddle.NewServer(config.Addr, config.upstreamAddr)
+	config.Configure(srv)
+	if config.RecordFile != "" {
+		recorder, err := server.OpenRecording(config.RecordFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer recorder.Close()
+		srv.Middleware = append(srv.Middleware, server.Record(recorder))
+	}
+	go server.WatchConfig(ctx, "mob_in_the_middle", flags, (*settings).define, func(next *settings) {
+		next.Reconfigure(srv)
+		next.proxy.Apply()
+	})
+	if err := srv.Serve(ctx); err != nil {
+		slog.Error("Server stopped", "err", err)
+		os.Exit(1)
+	}
+}
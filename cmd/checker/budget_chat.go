@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// quiet is how long a user must hear nothing when nothing should reach them.
+const quiet = 200 * time.Millisecond
+
+var budgetChatScenarios = []scenario{
+	{"join, chat and leave", func(c *checker) error {
+		alice, _, err := joinChat(c, "alice")
+		if err != nil {
+			return err
+		}
+		defer alice.leave()
+		bob, present, err := joinChat(c, "bob")
+		if err != nil {
+			return err
+		}
+		defer bob.leave()
+		if !slices.Contains(present, alice.name) {
+			return fmt.Errorf("expected %s to be listed in the room, got %q", alice.name, present)
+		}
+		if err := alice.expectPresence(bob.name, "entered"); err != nil {
+			return err
+		}
+
+		if err := alice.say("Hi bob"); err != nil {
+			return err
+		}
+		if err := bob.expectLine("[" + alice.name + "] Hi bob"); err != nil {
+			return err
+		}
+		if err := alice.expectSilence(quiet); err != nil {
+			return fmt.Errorf("%s heard their own message: %w", alice.name, err)
+		}
+
+		bob.leave()
+		return alice.expectPresence(bob.name, "left")
+	}},
+	{"illegal names are rejected", func(c *checker) error {
+		observer, _, err := joinChat(c, "observer")
+		if err != nil {
+			return err
+		}
+		defer observer.leave()
+
+		var errs []error
+		for _, name := range []string{"", "bad name", "bad!"} {
+			conn, err := c.dial()
+			if err != nil {
+				return err
+			}
+			if _, err := conn.readLine(); err != nil {
+				errs = append(errs, fmt.Errorf("awaiting the welcome message: %w", err))
+			} else if err := conn.sendLine(name); err == nil {
+				if err := conn.expectClosed(); err != nil {
+					errs = append(errs, fmt.Errorf("name %q: %w", name, err))
+				}
+			}
+			conn.Close()
+		}
+		if err := observer.expectSilence(quiet); err != nil {
+			errs = append(errs, fmt.Errorf("a rejected user was announced: %w", err))
+		}
+		return errors.Join(errs...)
+	}},
+	{"users see each other join", func(c *checker) error {
+		var users []*chatUser
+		defer func() {
+			for _, u := range users {
+				u.leave()
+			}
+		}()
+		for i := range 5 {
+			user, present, err := joinChat(c, fmt.Sprintf("user%d", i))
+			if err != nil {
+				return err
+			}
+			for _, u := range users {
+				if !slices.Contains(present, u.name) {
+					return fmt.Errorf("expected %s to be listed in the room, got %q", u.name, present)
+				}
+				if err := u.expectPresence(user.name, "entered"); err != nil {
+					return err
+				}
+			}
+			users = append(users, user)
+		}
+		return nil
+	}},
+	{"messages arrive in order", func(c *checker) error {
+		alice, _, err := joinChat(c, "alice")
+		if err != nil {
+			return err
+		}
+		defer alice.leave()
+		bob, _, err := joinChat(c, "bob")
+		if err != nil {
+			return err
+		}
+		defer bob.leave()
+		if err := alice.expectPresence(bob.name, "entered"); err != nil {
+			return err
+		}
+
+		var messages strings.Builder
+		for i := range 100 {
+			fmt.Fprintf(&messages, "message %d\n", i)
+		}
+		if err := alice.send([]byte(messages.String())); err != nil {
+			return err
+		}
+		for i := range 100 {
+			if err := bob.expectLine(fmt.Sprintf("[%s] message %d", alice.name, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{"long messages", func(c *checker) error {
+		alice, _, err := joinChat(c, "alice")
+		if err != nil {
+			return err
+		}
+		defer alice.leave()
+		bob, _, err := joinChat(c, "bob")
+		if err != nil {
+			return err
+		}
+		defer bob.leave()
+		if err := alice.expectPresence(bob.name, "entered"); err != nil {
+			return err
+		}
+
+		message := strings.Repeat("All work and no play. ", 45)
+		if err := alice.say(message); err != nil {
+			return err
+		}
+		return bob.expectLine("[" + alice.name + "] " + message)
+	}},
+}
+
+// chatUser is a client that has joined the chat room.
+type chatUser struct {
+	*conn
+	name string
+}
+
+// joinChat joins the room under a unique name starting with base and
+// returns the names the room was said to contain.
+func joinChat(c *checker, base string) (*chatUser, []string, error) {
+	name := fmt.Sprintf("%s%04d", base, rand.N(10000))
+	conn, err := c.dial()
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := conn.readLine(); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("%s awaiting the welcome message: %w", name, err)
+	}
+	if err := conn.sendLine(name); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	line, err := conn.readLine()
+	if err == nil && !strings.HasPrefix(line, "*") {
+		err = fmt.Errorf("expected the room's members, got %q", line)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("%s joining: %w", name, err)
+	}
+
+	var present []string
+	if _, list, ok := strings.Cut(line, ":"); ok {
+		for member := range strings.SplitSeq(list, ",") {
+			if member = strings.TrimSpace(member); member != "" {
+				present = append(present, member)
+			}
+		}
+	}
+	return &chatUser{conn: conn, name: name}, present, nil
+}
+
+// leave leaves the room and waits for the service to hang up, by which time
+// it has told the others, so that the news doesn't reach later scenarios.
+func (u *chatUser) leave() {
+	u.Conn.(*net.TCPConn).CloseWrite()
+	u.expectClosed()
+	u.Close()
+}
+
+func (u *chatUser) say(message string) error {
+	return u.sendLine(message)
+}
+
+// expectPresence expects a presence notification about name, which must
+// start with "*". Its wording is up to the service.
+func (u *chatUser) expectPresence(name, what string) error {
+	line, err := u.readLine()
+	if err != nil {
+		return fmt.Errorf("%s awaiting news that %s %s: %w", u.name, name, what, err)
+	}
+	if !strings.HasPrefix(line, "*") || !strings.Contains(line, name) {
+		return fmt.Errorf("%s expected news that %s %s, got %q", u.name, name, what, line)
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// problem is a Protohackers problem and the scenarios of the public checker
+// for it.
+type problem struct {
+	number    int
+	name      string
+	scenarios []scenario
+}
+
+// scenario reproduces one of the public checker's tests, returning an error
+// describing how the service failed it.
+type scenario struct {
+	name string
+	run  func(c *checker) error
+}
+
+var problems = []problem{
+	{0, "smoketest", smoketestScenarios},
+	{1, "primetime", primetimeScenarios},
+	{2, "means_to_an_end", meansToAnEndScenarios},
+	{3, "budget_chat", budgetChatScenarios},
+	{4, "unusual_database_program", unusualDatabaseScenarios},
+	{5, "mob_in_the_middle", mobInTheMiddleScenarios},
+	{6, "speed_daemon", speedDaemonScenarios},
+}
+
+// findProblem looks a problem up by number or name.
+func findProblem(s string) (problem, error) {
+	for _, p := range problems {
+		if s == p.name || s == strconv.Itoa(p.number) {
+			return p, nil
+		}
+	}
+	return problem{}, fmt.Errorf("unknown problem %q", s)
+}
+
+// result is the outcome of a scenario.
+type result struct {
+	name    string
+	elapsed time.Duration
+	err     error
+}
+
+func (r result) String() string {
+	if r.err != nil {
+		return fmt.Sprintf("FAIL %s (%s)\n     %v", r.name, r.elapsed.Round(time.Millisecond), r.err)
+	}
+	return fmt.Sprintf("PASS %s (%s)", r.name, r.elapsed.Round(time.Millisecond))
+}
+
+// checker runs scenarios against the service at addr. Every read and write
+// must complete within timeout.
+type checker struct {
+	addr    string
+	timeout time.Duration
+
+	// rewriteTarget is the address mob_in_the_middle rewrites Boguscoin
+	// addresses to.
+	rewriteTarget string
+}
+
+// check runs the problem's scenarios whose names match filter, one after
+// the other, since some of them share state in the service, such as the chat
+// room.
+func (c *checker) check(p problem, filter *regexp.Regexp) []result {
+	var results []result
+	for _, s := range p.scenarios {
+		if !filter.MatchString(s.name) {
+			continue
+		}
+		start := time.Now()
+		err := s.run(c)
+		results = append(results, result{name: p.name + "/" + s.name, elapsed: time.Since(start), err: err})
+	}
+	return results
+}
+
+// dial connects to the service over TCP.
+func (c *checker) dial() (*conn, error) {
+	nc, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: nc, reader: bufio.NewReader(nc), timeout: c.timeout}, nil
+}
+
+// dialUdp returns a socket that exchanges datagrams with the service.
+func (c *checker) dialUdp() (*udpConn, error) {
+	nc, err := net.Dial("udp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	return &udpConn{Conn: nc, timeout: c.timeout}, nil
+}
+
+// parallel runs f for each of n clients at once and returns the errors of
+// all those that failed.
+func parallel(n int, f func(i int) error) error {
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Go(func() {
+			if err := f(i); err != nil {
+				errs[i] = fmt.Errorf("client %d: %w", i, err)
+			}
+		})
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// conn is a TCP connection to the service under test.
+type conn struct {
+	net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+}
+
+func (c *conn) send(data []byte) error {
+	c.SetWriteDeadline(time.Now().Add(c.timeout))
+	_, err := c.Write(data)
+	return err
+}
+
+func (c *conn) sendLine(line string) error {
+	return c.send([]byte(line + "\n"))
+}
+
+// readLine reads a line, without its newline.
+func (c *conn) readLine() (string, error) {
+	c.SetReadDeadline(time.Now().Add(c.timeout))
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		if line != "" {
+			return "", fmt.Errorf("reading line, got %q before: %w", line, err)
+		}
+		return "", fmt.Errorf("reading line: %w", err)
+	}
+	return strings.TrimSuffix(line, "\n"), nil
+}
+
+// expectLine reads a line and checks that it is want.
+func (c *conn) expectLine(want string) error {
+	line, err := c.readLine()
+	if err != nil {
+		return fmt.Errorf("expected %q: %w", want, err)
+	}
+	if line != want {
+		return fmt.Errorf("expected %q, got %q", want, line)
+	}
+	return nil
+}
+
+// readFull reads exactly n bytes.
+func (c *conn) readFull(n int) ([]byte, error) {
+	c.SetReadDeadline(time.Now().Add(c.timeout))
+	buf := make([]byte, n)
+	read, err := io.ReadFull(c.reader, buf)
+	if err != nil {
+		return nil, fmt.Errorf("read %d of %d bytes: %w", read, n, err)
+	}
+	return buf, nil
+}
+
+// expectClosed checks that the service closes the connection, discarding
+// anything it sends first.
+func (c *conn) expectClosed() error {
+	c.SetReadDeadline(time.Now().Add(c.timeout))
+	_, err := io.Copy(io.Discard, c.reader)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return errors.New("expected the connection to be closed")
+	}
+	return nil
+}
+
+// expectSilence checks that the service sends nothing for d.
+func (c *conn) expectSilence(d time.Duration) error {
+	c.SetReadDeadline(time.Now().Add(d))
+	line, err := c.reader.ReadString('\n')
+	if errors.Is(err, os.ErrDeadlineExceeded) && line == "" {
+		return nil
+	}
+	if err != nil && line == "" {
+		return fmt.Errorf("expected nothing, got %w", err)
+	}
+	return fmt.Errorf("expected nothing, got %q", line)
+}
+
+// udpConn is a socket exchanging datagrams with the service under test.
+type udpConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *udpConn) send(msg string) error {
+	_, err := c.Write([]byte(msg))
+	return err
+}
+
+// request sends msg and returns the reply.
+func (c *udpConn) request(msg string) (string, error) {
+	if err := c.send(msg); err != nil {
+		return "", err
+	}
+	c.SetReadDeadline(time.Now().Add(c.timeout))
+	buf := make([]byte, 1000)
+	n, err := c.Read(buf)
+	if err != nil {
+		return "", fmt.Errorf("awaiting the reply to %q: %w", msg, err)
+	}
+	return string(buf[:n]), nil
+}
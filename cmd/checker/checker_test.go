@@ -0,0 +1,84 @@
+package main
+
+import (
+	"TDMR87/go_protohackers/internal/budgetchat"
+	"TDMR87/go_protohackers/internal/meanstoanend"
+	"TDMR87/go_protohackers/internal/mobinthemiddle"
+	"TDMR87/go_protohackers/internal/primetime"
+	"TDMR87/go_protohackers/internal/server"
+	"TDMR87/go_protohackers/internal/smoketest"
+	"TDMR87/go_protohackers/internal/speeddaemon"
+	"TDMR87/go_protohackers/internal/unusualdatabase"
+	"context"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// startTCP starts srv on a free port for the duration of the test and
+// returns its address.
+func startTCP(t *testing.T, srv *server.Server) string {
+	t.Helper()
+	listener, err := srv.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+	return listener.Addr().String()
+}
+
+func TestCheckerPassesTheServices(t *testing.T) {
+	for _, tt := range []struct {
+		problem string
+		start   func(t *testing.T) string
+	}{
+		{"smoketest", func(t *testing.T) string { return startTCP(t, smoketest.NewServer("127.0.0.1:0")) }},
+		{"primetime", func(t *testing.T) string { return startTCP(t, primetime.NewServer("127.0.0.1:0")) }},
+		{"means_to_an_end", func(t *testing.T) string { return startTCP(t, meanstoanend.NewServer("127.0.0.1:0")) }},
+		{"budget_chat", func(t *testing.T) string { return startTCP(t, budgetchat.NewServer("127.0.0.1:0")) }},
+		{"unusual_database_program", func(t *testing.T) string {
+			srv := unusualdatabase.NewServer("127.0.0.1:0")
+			if err := srv.Start(); err != nil {
+				t.Fatal("Error starting server:", err)
+			}
+			t.Cleanup(func() { srv.Close() })
+			return srv.LocalAddr().String()
+		}},
+		{"mob_in_the_middle", func(t *testing.T) string {
+			upstream := startTCP(t, budgetchat.NewServer("127.0.0.1:0"))
+			return startTCP(t, mobinthemiddle.NewServer("127.0.0.1:0", upstream))
+		}},
+		{"speed_daemon", func(t *testing.T) string { return startTCP(t, speeddaemon.NewServer("127.0.0.1:0")) }},
+	} {
+		t.Run(tt.problem, func(t *testing.T) {
+			t.Parallel()
+			p, err := findProblem(tt.problem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := &checker{addr: tt.start(t), timeout: 2 * time.Second, rewriteTarget: tonysAddress}
+			for _, r := range c.check(p, regexp.MustCompile("")) {
+				if r.err != nil {
+					t.Error(r)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckerFailsTheWrongService(t *testing.T) {
+	p, err := findProblem("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &checker{addr: startTCP(t, smoketest.NewServer("127.0.0.1:0")), timeout: 200 * time.Millisecond}
+	results := c.check(p, regexp.MustCompile("well-formed|malformed"))
+	if len(results) != 2 {
+		t.Fatalf("Expected the two matching scenarios to run, got %v", results)
+	}
+	for _, r := range results {
+		if r.err == nil {
+			t.Errorf("Expected an echo service to fail %s", r.name)
+		}
+	}
+}
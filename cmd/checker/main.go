@@ -0,0 +1,65 @@
+// Command checker runs the scenarios of the public Protohackers checker
+// against a service at any address, without needing a public IP, and reports
+// whether each of them passed.
+//
+//	checker [-timeout 5s] [-run regexp] problem host:port
+//
+// The problem is given by number or by name, as in "6" or "speed_daemon".
+// -run limits the check to the scenarios whose names match. Problem 5 is
+// checked through the proxy, so its upstream must be reachable.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"time"
+)
+
+func main() {
+	timeout := flag.Duration("timeout", 5*time.Second, "how long to wait for each response")
+	run := flag.String("run", "", "`regexp` selecting the scenarios to run")
+	rewriteTarget := flag.String("rewrite-target", tonysAddress, "Boguscoin `address` mob_in_the_middle should rewrite others to")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: checker [flags] problem host:port")
+		fmt.Fprintln(flag.CommandLine.Output(), "\nProblems:")
+		for _, p := range problems {
+			fmt.Fprintf(flag.CommandLine.Output(), "  %d %s\n", p.number, p.name)
+		}
+		fmt.Fprintln(flag.CommandLine.Output(), "\nFlags:")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	p, err := findProblem(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	filter, err := regexp.Compile(*run)
+	if err != nil {
+		log.Fatalf("Invalid -run: %v", err)
+	}
+
+	c := &checker{addr: flag.Arg(1), timeout: *timeout, rewriteTarget: *rewriteTarget}
+	results := c.check(p, filter)
+	if len(results) == 0 {
+		log.Fatalf("No %s scenarios match %q", p.name, *run)
+	}
+	failed := 0
+	for _, r := range results {
+		fmt.Println(r)
+		if r.err != nil {
+			failed++
+		}
+	}
+	fmt.Printf("%s: %d passed, %d failed\n", p.name, len(results)-failed, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+)
+
+var meansToAnEndScenarios = []scenario{
+	{"example session", func(c *checker) error {
+		conn, err := c.dial()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		return meansSession(conn, []meansMessage{
+			{'I', 12345, 101},
+			{'I', 12346, 102},
+			{'I', 12347, 100},
+			{'I', 40960, 5},
+		}, []meansQuery{{12288, 16384, 101}})
+	}},
+	{"queries that match nothing", func(c *checker) error {
+		conn, err := c.dial()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		return meansSession(conn, []meansMessage{
+			{'I', 1000, 50},
+		}, []meansQuery{
+			{2000, 3000, 0},
+			{1000, 999, 0}, // mintime after maxtime
+		})
+	}},
+	{"negative prices and timestamps", func(c *checker) error {
+		conn, err := c.dial()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		return meansSession(conn, []meansMessage{
+			{'I', -5, -100},
+			{'I', 0, -50},
+			{'I', 5, 0},
+			{'I', 7, 2},
+		}, []meansQuery{{-10, 5, -50}, {1, 10, 1}})
+	}},
+	{"large session", func(c *checker) error {
+		conn, err := c.dial()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		return randomMeansSession(conn, 20_000)
+	}},
+	{"sessions are separate", func(c *checker) error {
+		return parallel(5, func(i int) error {
+			conn, err := c.dial()
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			return randomMeansSession(conn, 1_000)
+		})
+	}},
+	{"messages split across writes", func(c *checker) error {
+		conn, err := c.dial()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		data := meansMessage{'I', 1, 42}.encode()
+		data = append(data, meansMessage{'Q', 0, 2}.encode()...)
+		for _, b := range data {
+			if err := conn.send([]byte{b}); err != nil {
+				return err
+			}
+		}
+		return expectMean(conn, meansQuery{0, 2, 42})
+	}},
+}
+
+// meansMessage is an insert or query message.
+type meansMessage struct {
+	kind byte
+	a, b int32
+}
+
+func (m meansMessage) encode() []byte {
+	data := []byte{m.kind}
+	data = binary.BigEndian.AppendUint32(data, uint32(m.a))
+	return binary.BigEndian.AppendUint32(data, uint32(m.b))
+}
+
+// meansQuery is a query and the mean it should get.
+type meansQuery struct {
+	minTime, maxTime int32
+	mean             int32
+}
+
+// meansSession sends inserts in one write, then each query, checking its
+// result.
+func meansSession(conn *conn, inserts []meansMessage, queries []meansQuery) error {
+	var data []byte
+	for _, m := range inserts {
+		data = append(data, m.encode()...)
+	}
+	if err := conn.send(data); err != nil {
+		return err
+	}
+	for _, q := range queries {
+		if err := conn.send(meansMessage{'Q', q.minTime, q.maxTime}.encode()); err != nil {
+			return err
+		}
+		if err := expectMean(conn, q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func expectMean(conn *conn, q meansQuery) error {
+	result, err := conn.readFull(4)
+	if err != nil {
+		return fmt.Errorf("querying %d to %d: %w", q.minTime, q.maxTime, err)
+	}
+	if mean := int32(binary.BigEndian.Uint32(result)); mean != q.mean {
+		return fmt.Errorf("querying %d to %d: expected a mean of %d, got %d", q.minTime, q.maxTime, q.mean, mean)
+	}
+	return nil
+}
+
+// randomMeansSession inserts n random prices at distinct timestamps and
+// queries random ranges of them. The mean may be rounded either way, as the
+// official checker allows.
+func randomMeansSession(conn *conn, n int) error {
+	prices := make([]int32, n)
+	inserts := make([]meansMessage, n)
+	for i, ts := range rand.Perm(n) {
+		prices[ts] = rand.Int32N(10_000) - 1_000
+		inserts[i] = meansMessage{'I', int32(ts), prices[ts]}
+	}
+	if err := meansSession(conn, inserts, nil); err != nil {
+		return err
+	}
+
+	for range 20 {
+		lo := rand.IntN(n)
+		hi := lo + rand.IntN(n-lo)
+		var sum int64
+		for _, p := range prices[lo : hi+1] {
+			sum += int64(p)
+		}
+		count := int64(hi - lo + 1)
+		if err := conn.send(meansMessage{'Q', int32(lo), int32(hi)}.encode()); err != nil {
+			return err
+		}
+		result, err := conn.readFull(4)
+		if err != nil {
+			return err
+		}
+		mean := int64(int32(binary.BigEndian.Uint32(result)))
+		if mean*count > sum+count || mean*count < sum-count {
+			return fmt.Errorf("querying %d to %d: expected a mean of about %.1f, got %d", lo, hi, float64(sum)/float64(count), mean)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// tonysAddress is the Boguscoin address the proxy rewrites others to,
+// unless the checker is told otherwise.
+const tonysAddress = "7YWHMfk9JZe0LM0g1ZauHuiSxhI"
+
+// rewriteCase is a message and what it should read once through the proxy,
+// with "{target}" standing for the rewrite target.
+type rewriteCase struct {
+	message, rewritten string
+}
+
+var mobInTheMiddleScenarios = []scenario{
+	{"chat through the proxy", budgetChatScenarios[0].run},
+	{"Boguscoin addresses are rewritten", func(c *checker) error {
+		return checkRewrites(c, []rewriteCase{
+			{"7F1u3wSD5RbOHQmupo9nx4TnhQ", "{target}"},
+			{"Send to 7iKDZEwPZSqIvDnHvVN2r0hUWXD5rHX please", "Send to {target} please"},
+			{"7adNeSwJkMakpEcln9HEtthSRtxdmEHOT8T is mine", "{target} is mine"},
+			{"Mine is 7LOrwbDlS8NujgjddyogWgIM93MV5N2VR", "Mine is {target}"},
+			{"Pay 7YWHMfk9JZe0LM0g1ZauHuiSxhI or 7iKDZEwPZSqIvDnHvVN2r0hUWXD5rHX", "Pay {target} or {target}"},
+		})
+	}},
+	{"other text is left alone", func(c *checker) error {
+		return checkRewrites(c, []rewriteCase{
+			{"Too short: 7iKDZEwPZSqIvDnHvVN2r0h", "Too short: 7iKDZEwPZSqIvDnHvVN2r0h"},
+			{"Too long: 7iKDZEwPZSqIvDnHvVN2r0hUWXD5rHXabcdef", "Too long: 7iKDZEwPZSqIvDnHvVN2r0hUWXD5rHXabcdef"},
+			{"Product ID 7iKDZEwPZSqIvDnHvVN2r0hUWXD5rHX-1234", "Product ID 7iKDZEwPZSqIvDnHvVN2r0hUWXD5rHX-1234"},
+			{"Not at the start x7iKDZEwPZSqIvDnHvVN2r0hUWXD5rHX", "Not at the start x7iKDZEwPZSqIvDnHvVN2r0hUWXD5rHX"},
+		})
+	}},
+}
+
+// checkRewrites sends each message from one user to another through the
+// proxy and checks what arrives.
+func checkRewrites(c *checker, cases []rewriteCase) error {
+	alice, _, err := joinChat(c, "alice")
+	if err != nil {
+		return err
+	}
+	defer alice.leave()
+	bob, _, err := joinChat(c, "bob")
+	if err != nil {
+		return err
+	}
+	defer bob.leave()
+	if err := alice.expectPresence(bob.name, "entered"); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, tt := range cases {
+		if err := alice.say(tt.message); err != nil {
+			return err
+		}
+		want := "[" + alice.name + "] " + strings.ReplaceAll(tt.rewritten, "{target}", c.rewriteTarget)
+		line, err := bob.readLine()
+		if err != nil {
+			return fmt.Errorf("awaiting %q: %w", want, err)
+		}
+		if line != want {
+			errs = append(errs, fmt.Errorf("expected %q, got %q", want, line))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// primeCase is an isPrime request and the answer it should get.
+type primeCase struct {
+	number string // As JSON
+	prime  bool
+}
+
+var primeCases = []primeCase{
+	{"2", true},
+	{"3", true},
+	{"4", false},
+	{"7919", true},
+	{"7920", false},
+	{"2147483647", true},
+	{"1", false},
+	{"0", false},
+	{"-7", false},
+	{"7.0", true},
+	{"7.5", false},
+	{"123456789012345678901234567890", false},
+}
+
+var primetimeScenarios = []scenario{
+	{"well-formed requests", func(c *checker) error {
+		conn, err := c.dial()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		for _, tt := range primeCases {
+			if err := isPrime(conn, tt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{"extra fields are ignored", func(c *checker) error {
+		conn, err := c.dial()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		if err := conn.sendLine(`{"number":7,"extra":{"nested":[1,2]},"method":"isPrime"}`); err != nil {
+			return err
+		}
+		return expectPrime(conn, primeCase{"7", true})
+	}},
+	{"many requests in one write", func(c *checker) error {
+		conn, err := c.dial()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		var batch strings.Builder
+		var expected []primeCase
+		for range 100 {
+			for _, tt := range primeCases {
+				fmt.Fprintf(&batch, `{"method":"isPrime","number":%s}`+"\n", tt.number)
+				expected = append(expected, tt)
+			}
+		}
+		if err := conn.send([]byte(batch.String())); err != nil {
+			return err
+		}
+		for _, tt := range expected {
+			if err := expectPrime(conn, tt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{"5 simultaneous clients", func(c *checker) error {
+		return parallel(5, func(i int) error {
+			conn, err := c.dial()
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			for j := range 50 {
+				if err := isPrime(conn, primeCases[(i+j)%len(primeCases)]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}},
+	{"malformed requests get a malformed response and a disconnect", func(c *checker) error {
+		var errs []error
+		for _, request := range []string{
+			`{}`,
+			`{"method":"isPrime"}`,
+			`{"method":"isprime","number":7}`,
+			`{"method":"isPrime","number":"7"}`,
+			`{"method":"isPrime","number":7`,
+			`["isPrime",7]`,
+			`isPrime 7`,
+		} {
+			if err := malformedRequest(c, request); err != nil {
+				errs = append(errs, fmt.Errorf("request %s: %w", request, err))
+			}
+		}
+		return errors.Join(errs...)
+	}},
+}
+
+// isPrime asks whether tt.number is prime and checks the answer.
+func isPrime(conn *conn, tt primeCase) error {
+	if err := conn.sendLine(`{"method":"isPrime","number":` + tt.number + `}`); err != nil {
+		return err
+	}
+	return expectPrime(conn, tt)
+}
+
+func expectPrime(conn *conn, tt primeCase) error {
+	line, err := conn.readLine()
+	if err != nil {
+		return fmt.Errorf("asking about %s: %w", tt.number, err)
+	}
+	prime, err := parsePrimeResponse(line)
+	if err != nil {
+		return fmt.Errorf("asking about %s: %w", tt.number, err)
+	}
+	if prime != tt.prime {
+		return fmt.Errorf("expected %s to be prime %v, got %q", tt.number, tt.prime, line)
+	}
+	return nil
+}
+
+// parsePrimeResponse returns the answer in a well-formed response.
+func parsePrimeResponse(line string) (bool, error) {
+	var response struct {
+		Method *string `json:"method"`
+		Prime  *bool   `json:"prime"`
+	}
+	if err := json.Unmarshal([]byte(line), &response); err != nil {
+		return false, fmt.Errorf("malformed response %q: %w", line, err)
+	}
+	if response.Method == nil || *response.Method != "isPrime" || response.Prime == nil {
+		return false, fmt.Errorf("malformed response %q", line)
+	}
+	return *response.Prime, nil
+}
+
+// malformedRequest sends request and expects anything but a well-formed
+// response, or nothing at all, before the service disconnects.
+func malformedRequest(c *checker, request string) error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.sendLine(request); err != nil {
+		return err
+	}
+	if line, err := conn.readLine(); err == nil {
+		if _, err := parsePrimeResponse(line); err == nil {
+			return fmt.Errorf("expected a malformed response, got %q", line)
+		}
+	}
+	return conn.expectClosed()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sync"
+)
+
+var smoketestScenarios = []scenario{
+	{"echo until the client is done sending", func(c *checker) error {
+		return echo(c, []byte("Hello, echo!\n"))
+	}},
+	{"binary data", func(c *checker) error {
+		data := make([]byte, 256)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		return echo(c, data)
+	}},
+	{"5 simultaneous clients", func(c *checker) error {
+		return parallel(5, func(i int) error {
+			return echo(c, fmt.Appendf(nil, "client %d says hello\n", i))
+		})
+	}},
+	{"large payload", func(c *checker) error {
+		data := make([]byte, 100_000)
+		for i := range data {
+			data[i] = byte(rand.N(256))
+		}
+		return echo(c, data)
+	}},
+}
+
+// echo sends data, signals it is done sending and expects exactly data
+// back, followed by the end of the connection. The echo is read while data
+// is sent, since a service may not buffer all of it.
+func echo(c *checker, data []byte) error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var echoed []byte
+	var readErr error
+	var wg sync.WaitGroup
+	wg.Go(func() { echoed, readErr = conn.readFull(len(data)) })
+	if err := conn.send(data); err != nil {
+		return err
+	}
+	if err := conn.Conn.(*net.TCPConn).CloseWrite(); err != nil {
+		return err
+	}
+	wg.Wait()
+	if readErr != nil {
+		return readErr
+	}
+	if !bytes.Equal(echoed, data) {
+		return fmt.Errorf("the echo of %d bytes differs from what was sent", len(data))
+	}
+	return conn.expectClosed()
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"TDMR87/go_protohackers/internal/speeddaemon"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"time"
+)
+
+// day is the length of a day in the protocol's timestamps.
+const day = 86400
+
+var speedDaemonScenarios = []scenario{
+	{"example ticket", func(c *checker) error {
+		road, plate := uniqueRoad(), uniquePlate()
+		dispatcher, err := dispatcherFor(c, road)
+		if err != nil {
+			return err
+		}
+		defer dispatcher.Close()
+		if err := observe(c, road, 60, plate, []sighting{{8, 0}, {9, 45}}); err != nil {
+			return err
+		}
+		return expectTickets(dispatcher, speeddaemon.Ticket{
+			Plate: plate, Road: road, Mile1: 8, Timestamp1: 0, Mile2: 9, Timestamp2: 45, Speed: 8000,
+		})
+	}},
+	{"sightings out of order", func(c *checker) error {
+		road, plate := uniqueRoad(), uniquePlate()
+		dispatcher, err := dispatcherFor(c, road)
+		if err != nil {
+			return err
+		}
+		defer dispatcher.Close()
+		if err := observe(c, road, 60, plate, []sighting{{9, 45}, {8, 0}}); err != nil {
+			return err
+		}
+		return expectTickets(dispatcher, speeddaemon.Ticket{
+			Plate: plate, Road: road, Mile1: 8, Timestamp1: 0, Mile2: 9, Timestamp2: 45, Speed: 8000,
+		})
+	}},
+	{"tickets wait for a dispatcher", func(c *checker) error {
+		road, plate := uniqueRoad(), uniquePlate()
+		if err := observe(c, road, 100, plate, []sighting{{100, 1000}, {110, 1200}}); err != nil {
+			return err
+		}
+		dispatcher, err := dispatcherFor(c, road)
+		if err != nil {
+			return err
+		}
+		defer dispatcher.Close()
+		return expectTickets(dispatcher, speeddaemon.Ticket{
+			Plate: plate, Road: road, Mile1: 100, Timestamp1: 1000, Mile2: 110, Timestamp2: 1200, Speed: 18000,
+		})
+	}},
+	{"no ticket below the limit", func(c *checker) error {
+		road, plate := uniqueRoad(), uniquePlate()
+		dispatcher, err := dispatcherFor(c, road)
+		if err != nil {
+			return err
+		}
+		defer dispatcher.Close()
+		// 50 mph all along.
+		if err := observe(c, road, 60, plate, []sighting{{0, 0}, {1, 72}, {3, 216}}); err != nil {
+			return err
+		}
+		return expectNoTicket(dispatcher)
+	}},
+	{"at most one ticket per car per day", func(c *checker) error {
+		road, plate := uniqueRoad(), uniquePlate()
+		dispatcher, err := dispatcherFor(c, road)
+		if err != nil {
+			return err
+		}
+		defer dispatcher.Close()
+		// 120 mph all along, on days 0 and 1.
+		err = observe(c, road, 60, plate, []sighting{
+			{0, 0}, {1, 30}, {2, 60},
+			{10, day + 0}, {11, day + 30}, {12, day + 60},
+		})
+		if err != nil {
+			return err
+		}
+		return expectTicketDays(dispatcher, plate, [][2]uint32{{0, 0}, {1, 1}})
+	}},
+	{"a ticket spanning midnight counts for both days", func(c *checker) error {
+		road, plate := uniqueRoad(), uniquePlate()
+		dispatcher, err := dispatcherFor(c, road)
+		if err != nil {
+			return err
+		}
+		defer dispatcher.Close()
+		err = observe(c, road, 60, plate, []sighting{
+			{0, day - 30}, {2, day + 30}, // Days 0 and 1
+			{10, day + 1000}, {11, day + 1030}, // Day 1 again
+			{20, 2*day + 1000}, {21, 2*day + 1030}, // Day 2
+		})
+		if err != nil {
+			return err
+		}
+		return expectTicketDays(dispatcher, plate, [][2]uint32{{0, 1}, {2, 2}})
+	}},
+	{"only dispatchers for the road get its tickets", func(c *checker) error {
+		road, plate := uniqueRoad(), uniquePlate()
+		other, err := dispatcherFor(c, road+1)
+		if err != nil {
+			return err
+		}
+		defer other.Close()
+		if err := observe(c, road, 60, plate, []sighting{{8, 0}, {9, 45}}); err != nil {
+			return err
+		}
+		if err := expectNoTicket(other); err != nil {
+			return err
+		}
+		dispatcher, err := dispatcherFor(c, road)
+		if err != nil {
+			return err
+		}
+		defer dispatcher.Close()
+		return expectTickets(dispatcher, speeddaemon.Ticket{
+			Plate: plate, Road: road, Mile1: 8, Timestamp1: 0, Mile2: 9, Timestamp2: 45, Speed: 8000,
+		})
+	}},
+	{"heartbeats", func(c *checker) error {
+		conn, err := c.dial()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		if err := conn.send(speeddaemon.WantHeartBeat{Interval: 5}.Encode()); err != nil {
+			return err
+		}
+		for i := range 3 {
+			conn.SetReadDeadline(time.Now().Add(conn.timeout))
+			msg, err := readServerMessage(conn)
+			if err != nil {
+				return fmt.Errorf("awaiting heartbeat %d: %w", i+1, err)
+			}
+			if _, ok := msg.(speeddaemon.HeartBeat); !ok {
+				return fmt.Errorf("expected heartbeat %d, got %+v", i+1, msg)
+			}
+		}
+		return nil
+	}},
+	{"illegal messages get an error", func(c *checker) error {
+		var errs []error
+		for _, tt := range []struct {
+			name       string
+			data       []byte
+			disconnect bool
+		}{
+			{"an unknown message type", []byte{0xff}, true},
+			{"a plate from a client that isn't a camera", mustEncode(speeddaemon.Plate{Plate: "UN1X", Timestamp: 0}), false},
+			{"a second WantHeartbeat", append(speeddaemon.WantHeartBeat{}.Encode(), speeddaemon.WantHeartBeat{}.Encode()...), true},
+			{"a camera identifying itself twice", append(speeddaemon.IAmCamera{Road: 1, Mile: 1, Limit: 1}.Encode(), speeddaemon.IAmCamera{Road: 1, Mile: 1, Limit: 1}.Encode()...), true},
+		} {
+			if err := expectError(c, tt.data, tt.disconnect); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", tt.name, err))
+			}
+		}
+		return errors.Join(errs...)
+	}},
+}
+
+// uniqueRoad returns a road number that earlier runs are unlikely to have
+// used, leaving the next one free too.
+func uniqueRoad() uint16 {
+	return uint16(rand.N(65000)) + 1
+}
+
+// uniquePlate returns a plate that earlier runs are unlikely to have used.
+func uniquePlate() string {
+	return fmt.Sprintf("CHK%05d", rand.N(100000))
+}
+
+// sighting is a car passing a camera.
+type sighting struct {
+	mile      uint16
+	timestamp uint32
+}
+
+// observe reports each sighting of plate from a camera of its own on road,
+// where the speed limit is limit, and waits until the service has read them.
+func observe(c *checker, road, limit uint16, plate string, sightings []sighting) error {
+	for _, s := range sightings {
+		conn, err := c.dial()
+		if err != nil {
+			return err
+		}
+		data := speeddaemon.IAmCamera{Road: road, Mile: s.mile, Limit: limit}.Encode()
+		data = append(data, mustEncode(speeddaemon.Plate{Plate: plate, Timestamp: s.timestamp})...)
+		err = conn.send(data)
+		if err == nil {
+			err = awaitRead(conn)
+		}
+		conn.Close()
+		if err != nil {
+			return fmt.Errorf("camera at mile %d: %w", s.mile, err)
+		}
+	}
+	return nil
+}
+
+// awaitRead makes sure the service has read everything sent on conn so far,
+// by asking for a heartbeat and waiting for it.
+func awaitRead(conn *conn) error {
+	if err := conn.send(speeddaemon.WantHeartBeat{Interval: 1}.Encode()); err != nil {
+		return err
+	}
+	conn.SetReadDeadline(time.Now().Add(conn.timeout))
+	msg, err := readServerMessage(conn)
+	if err != nil {
+		return err
+	}
+	if _, ok := msg.(speeddaemon.HeartBeat); !ok {
+		return fmt.Errorf("expected a heartbeat, got %+v", msg)
+	}
+	return nil
+}
+
+// dispatcherFor connects a dispatcher for road.
+func dispatcherFor(c *checker, road uint16) (*conn, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.send(speeddaemon.IAmDispatcher{Numroads: 1, Roads: []uint16{road}}.Encode()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// expectTickets expects the dispatcher to receive the tickets, in any order.
+// The speed may be off by one mph, as the official checker allows.
+func expectTickets(dispatcher *conn, tickets ...speeddaemon.Ticket) error {
+	remaining := tickets
+	for len(remaining) > 0 {
+		ticket, err := readTicket(dispatcher)
+		if err != nil {
+			return fmt.Errorf("awaiting %d more tickets: %w", len(remaining), err)
+		}
+		found := false
+		for i, want := range remaining {
+			got := ticket
+			if got.Speed >= want.Speed-100 && got.Speed <= want.Speed+100 {
+				got.Speed = want.Speed
+			}
+			if got == want {
+				remaining = append(remaining[:i:i], remaining[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unexpected ticket %+v, expected %+v", ticket, remaining)
+		}
+	}
+	return expectNoTicket(dispatcher)
+}
+
+// expectTicketDays expects one ticket for plate per range of days, in any
+// order, and no more.
+func expectTicketDays(dispatcher *conn, plate string, days [][2]uint32) error {
+	remaining := days
+	for len(remaining) > 0 {
+		ticket, err := readTicket(dispatcher)
+		if err != nil {
+			return fmt.Errorf("awaiting tickets for days %v: %w", remaining, err)
+		}
+		span := [2]uint32{ticket.Timestamp1 / day, ticket.Timestamp2 / day}
+		i := -1
+		for j, d := range remaining {
+			if d == span && ticket.Plate == plate {
+				i = j
+			}
+		}
+		if i < 0 {
+			return fmt.Errorf("unexpected ticket %+v, expected tickets for days %v", ticket, remaining)
+		}
+		remaining = append(remaining[:i:i], remaining[i+1:]...)
+	}
+	return expectNoTicket(dispatcher)
+}
+
+// expectNoTicket checks that the dispatcher receives nothing for a while.
+func expectNoTicket(dispatcher *conn) error {
+	dispatcher.SetReadDeadline(time.Now().Add(quiet))
+	msg, err := readServerMessage(dispatcher)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("expected no more tickets, got %+v", msg)
+}
+
+func readTicket(conn *conn) (speeddaemon.Ticket, error) {
+	conn.SetReadDeadline(time.Now().Add(conn.timeout))
+	msg, err := readServerMessage(conn)
+	if err != nil {
+		return speeddaemon.Ticket{}, err
+	}
+	ticket, ok := msg.(speeddaemon.Ticket)
+	if !ok {
+		return speeddaemon.Ticket{}, fmt.Errorf("expected a ticket, got %+v", msg)
+	}
+	return ticket, nil
+}
+
+// expectError sends data, expects an error in reply and, if disconnect is
+// set, the end of the connection.
+func expectError(c *checker, data []byte, disconnect bool) error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.send(data); err != nil {
+		return err
+	}
+	conn.SetReadDeadline(time.Now().Add(conn.timeout))
+	msg, err := readServerMessage(conn)
+	if err != nil {
+		return fmt.Errorf("awaiting an error: %w", err)
+	}
+	if _, ok := msg.(speeddaemon.Error); !ok {
+		return fmt.Errorf("expected an error, got %+v", msg)
+	}
+	if disconnect {
+		return conn.expectClosed()
+	}
+	return nil
+}
+
+// readServerMessage reads the next message from the service, within the
+// read deadline already set on conn.
+func readServerMessage(conn *conn) (any, error) {
+	msgType, err := conn.reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch msgType {
+	case speeddaemon.HeartBeat{}.Type():
+		return speeddaemon.HeartBeat{}, nil
+	case speeddaemon.Error{}.Type():
+		length, err := conn.reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		msg, err := conn.readFull(int(length))
+		if err != nil {
+			return nil, err
+		}
+		return speeddaemon.Error{Msg: string(msg)}, nil
+	case speeddaemon.Ticket{}.Type():
+		length, err := conn.reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		rest, err := conn.readFull(int(length) + 2 + 2 + 4 + 2 + 4 + 2)
+		if err != nil {
+			return nil, err
+		}
+		return speeddaemon.Ticket{}.Decode(append([]byte{msgType, length}, rest...))
+	}
+	return nil, fmt.Errorf("unknown message type %#x", msgType)
+}
+
+// mustEncode encodes a message whose fields are known to be valid.
+func mustEncode(msg interface{ Encode() ([]byte, error) }) []byte {
+	data, err := msg.Encode()
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+)
+
+var unusualDatabaseScenarios = []scenario{
+	{"insert and retrieve", func(c *checker) error {
+		conn, err := c.dialUdp()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		key := uniqueKey("foo")
+		return insertAndRetrieve(conn, []string{key + "=bar"}, key, key+"=bar")
+	}},
+	{"inserts overwrite", func(c *checker) error {
+		conn, err := c.dialUdp()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		key := uniqueKey("foo")
+		return insertAndRetrieve(conn, []string{key + "=bar", key + "=baz"}, key, key+"=baz")
+	}},
+	{"values may contain equals signs", func(c *checker) error {
+		conn, err := c.dialUdp()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		key := uniqueKey("foo")
+		if err := insertAndRetrieve(conn, []string{key + "=bar=baz"}, key, key+"=bar=baz"); err != nil {
+			return err
+		}
+		return insertAndRetrieve(conn, []string{key + "==="}, key, key+"===")
+	}},
+	{"empty keys and values", func(c *checker) error {
+		conn, err := c.dialUdp()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		key := uniqueKey("foo")
+		if err := insertAndRetrieve(conn, []string{key + "="}, key, key+"="); err != nil {
+			return err
+		}
+		value := uniqueKey("empty key")
+		return insertAndRetrieve(conn, []string{"=" + value}, "", "="+value)
+	}},
+	{"version is immutable", func(c *checker) error {
+		conn, err := c.dialUdp()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		version, err := conn.request("version")
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(version, "version=") || version == "version=" {
+			return fmt.Errorf("expected a version, got %q", version)
+		}
+		return insertAndRetrieve(conn, []string{"version=hacked", "version="}, "version", version)
+	}},
+	{"concurrent clients see each other's inserts", func(c *checker) error {
+		const clients = 10
+		keys := make([]string, clients)
+		for i := range keys {
+			keys[i] = uniqueKey(fmt.Sprintf("client%d", i))
+		}
+		err := parallel(clients, func(i int) error {
+			conn, err := c.dialUdp()
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			return insertAndRetrieve(conn, []string{keys[i] + "=value"}, keys[i], keys[i]+"=value")
+		})
+		if err != nil {
+			return err
+		}
+
+		conn, err := c.dialUdp()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		var errs []error
+		for _, key := range keys {
+			if err := insertAndRetrieve(conn, nil, key, key+"=value"); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}},
+}
+
+// uniqueKey returns a key starting with base that earlier runs didn't use.
+func uniqueKey(base string) string {
+	return fmt.Sprintf("%s-%08x", base, rand.Uint32())
+}
+
+// insertAndRetrieve sends the inserts, then retrieves key and expects want.
+// It relies on the service handling a client's requests in the order they
+// were sent, which is how they arrive over loopback or a quiet network.
+func insertAndRetrieve(conn *udpConn, inserts []string, key, want string) error {
+	for _, insert := range inserts {
+		if err := conn.send(insert); err != nil {
+			return err
+		}
+	}
+	got, err := conn.request(key)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("after %q, expected %q for key %q, got %q", inserts, want, key, got)
+	}
+	return nil
+}
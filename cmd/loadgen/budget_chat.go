@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var budgetChatScenario = scenario{
+	number:      3,
+	name:        "budget_chat",
+	description: "each client joins the room and each operation sends a message to all the others; latency is until each of them has it",
+	rate:        1,
+	start: func(ctx context.Context, g *generator) (client, error) {
+		return g.chat, nil
+	},
+}
+
+var mobInTheMiddleScenario = scenario{
+	number:      5,
+	name:        "mob_in_the_middle",
+	description: "the budget_chat scenario through the proxy",
+	rate:        1,
+	start:       budgetChatScenario.start,
+}
+
+// chat is a chat user that says the time now and then and measures how long
+// the others take to hear it. Everyone is in the same process, so they share
+// a clock.
+func (g *generator) chat(ctx context.Context, id int) error {
+	conn, err := g.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	if err := joinChat(g, conn, reader, fmt.Sprintf("load%04d%04d", id, rand.N(10000))); err != nil {
+		return err
+	}
+	g.stats.count("joins", 1)
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	go func() { cancel(g.listen(conn, reader)) }()
+
+	var next time.Time
+	for g.pace(ctx, &next) {
+		conn.SetWriteDeadline(time.Now().Add(g.timeout))
+		if _, err := fmt.Fprintf(conn, "%d\n", time.Now().UnixNano()); err != nil {
+			return err
+		}
+		g.stats.count("messages sent", 1)
+	}
+	return context.Cause(ctx)
+}
+
+// joinChat joins the room as name, over conn.
+func joinChat(g *generator, conn net.Conn, reader *bufio.Reader, name string) error {
+	g.deadline(conn)
+	if _, err := reader.ReadString('\n'); err != nil {
+		return err
+	}
+	if _, err := conn.Write([]byte(name + "\n")); err != nil {
+		return err
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return errors.New("not admitted to the room")
+	}
+	conn.SetDeadline(time.Time{})
+	return nil
+}
+
+// listen records the latency of every message heard from the others.
+func (g *generator) listen(conn net.Conn, reader *bufio.Reader) error {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, "*") {
+			continue // Someone joined or left
+		}
+		_, said, _ := strings.Cut(strings.TrimSpace(line), "] ")
+		sent, err := strconv.ParseInt(said, 10, 64)
+		if err != nil {
+			g.stats.fail(errors.New("garbled message"))
+			continue
+		}
+		g.stats.respond(time.Since(time.Unix(0, sent)))
+		g.stats.count("deliveries", 1)
+	}
+}
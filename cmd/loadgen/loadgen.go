@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// scenario loads one of the services.
+type scenario struct {
+	number int
+	name   string
+	// description says what an operation is, and what its latency measures.
+	description string
+	// rate is the default number of operations per second per client, where
+	// 0 means as fast as the service responds.
+	rate float64
+	// start prepares a run of the scenario and returns the client that each
+	// simulated client runs.
+	start func(ctx context.Context, g *generator) (client, error)
+}
+
+// client is a simulated client, numbered id, that runs operations until ctx
+// is done or an error ends its connection, which it returns.
+type client func(ctx context.Context, id int) error
+
+var scenarios = []scenario{
+	smoketestScenario,
+	primetimeScenario,
+	meansToAnEndScenario,
+	budgetChatScenario,
+	unusualDatabaseScenario,
+	mobInTheMiddleScenario,
+	speedDaemonScenario,
+}
+
+// findScenario looks a scenario up by the number or name of its service.
+func findScenario(s string) (scenario, error) {
+	for _, sc := range scenarios {
+		if s == sc.name || s == strconv.Itoa(sc.number) {
+			return sc, nil
+		}
+	}
+	return scenario{}, fmt.Errorf("unknown scenario %q", s)
+}
+
+// generator runs a scenario's clients against the service at addr.
+type generator struct {
+	addr    string
+	clients int
+	// interval is the time between a client's operations, or 0 for as fast
+	// as the service responds.
+	interval time.Duration
+	// timeout is how long to wait for any response.
+	timeout time.Duration
+	// writeRatio is the fraction of operations that write rather than read,
+	// where a scenario has both.
+	writeRatio float64
+	// size is the payload size of operations that have one.
+	size int
+
+	stats *stats
+}
+
+// run runs the scenario until ctx is done. A client whose connection fails
+// is counted as an error and reconnects after a pause.
+func (g *generator) run(ctx context.Context, s scenario) error {
+	newClient, err := s.start(ctx, g)
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	for id := range g.clients {
+		wg.Go(func() {
+			for ctx.Err() == nil {
+				if err := newClient(ctx, id); err != nil && ctx.Err() == nil {
+					g.stats.fail(err)
+					sleep(ctx, 100*time.Millisecond)
+				}
+			}
+		})
+	}
+	wg.Wait()
+	return nil
+}
+
+// dial connects to the service over TCP. The connection is closed once ctx
+// is done, to interrupt whatever the client is waiting for.
+func (g *generator) dial(ctx context.Context) (net.Conn, error) {
+	d := net.Dialer{Timeout: g.timeout}
+	conn, err := d.DialContext(ctx, "tcp", g.addr)
+	if err != nil {
+		return nil, err
+	}
+	context.AfterFunc(ctx, func() { conn.Close() })
+	return conn, nil
+}
+
+// dialUdp is like dial for a socket that exchanges datagrams with the
+// service.
+func (g *generator) dialUdp(ctx context.Context) (net.Conn, error) {
+	conn, err := net.Dial("udp", g.addr)
+	if err != nil {
+		return nil, err
+	}
+	context.AfterFunc(ctx, func() { conn.Close() })
+	return conn, nil
+}
+
+// pace waits until a client's next operation is due, given when the last one
+// was, and reports whether the run is still on.
+func (g *generator) pace(ctx context.Context, next *time.Time) bool {
+	if g.interval > 0 {
+		if next.IsZero() {
+			*next = time.Now()
+		}
+		*next = next.Add(g.interval)
+		sleep(ctx, time.Until(*next))
+	}
+	return ctx.Err() == nil
+}
+
+// deadline sets conn's deadline for the next response.
+func (g *generator) deadline(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(g.timeout))
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
+
+// stats are what a run measured: how many operations of each kind were
+// done, the latencies of the responses, and the errors.
+type stats struct {
+	mu        sync.Mutex
+	counts    map[string]int
+	latencies []time.Duration
+	errors    map[string]int
+}
+
+func newStats() *stats {
+	return &stats{counts: make(map[string]int), errors: make(map[string]int)}
+}
+
+// count counts n operations of the named kind.
+func (s *stats) count(name string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[name] += n
+}
+
+// respond records a response that took latency to arrive.
+func (s *stats) respond(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latencies = append(s.latencies, latency)
+}
+
+// fail counts an error by its kind.
+func (s *stats) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors[errorKind(err)]++
+}
+
+// errorKind describes err without the details that vary from one occurrence
+// to the next, such as port numbers, so that errors of a kind add up.
+func errorKind(err error) string {
+	var opErr *net.OpError
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return "connection closed by the service"
+	case errors.As(err, &opErr):
+		return opErr.Op + ": " + opErr.Err.Error()
+	}
+	return err.Error()
+}
+
+// percentile returns the latency that the fraction p of the sorted latencies
+// are within.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p+0.5) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+// report writes what the run measured over elapsed.
+func (s *stats) report(w io.Writer, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, name := range slices.Sorted(maps.Keys(s.counts)) {
+		n := s.counts[name]
+		fmt.Fprintf(w, "  %-16s %10d  %12.1f/s\n", name, n, float64(n)/elapsed.Seconds())
+	}
+
+	latencies := slices.Sorted(slices.Values(s.latencies))
+	if len(latencies) > 0 {
+		fmt.Fprintf(w, "  %-16s p50 %s  p90 %s  p99 %s  max %s  (%d responses)\n", "latency",
+			round(percentile(latencies, 0.5)), round(percentile(latencies, 0.9)),
+			round(percentile(latencies, 0.99)), round(latencies[len(latencies)-1]), len(latencies))
+	}
+
+	total := 0
+	for _, n := range s.errors {
+		total += n
+	}
+	fmt.Fprintf(w, "  %-16s %10d\n", "errors", total)
+	kinds := slices.SortedFunc(maps.Keys(s.errors), func(a, b string) int {
+		return s.errors[b] - s.errors[a]
+	})
+	for _, kind := range kinds {
+		fmt.Fprintf(w, "  %16s %10d  %s\n", "", s.errors[kind], kind)
+	}
+}
+
+// round rounds a latency to a precision that suits its size.
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
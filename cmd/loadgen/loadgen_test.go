@@ -0,0 +1,131 @@
+package main
+
+import (
+	"TDMR87/go_protohackers/internal/budgetchat"
+	"TDMR87/go_protohackers/internal/meanstoanend"
+	"TDMR87/go_protohackers/internal/mobinthemiddle"
+	"TDMR87/go_protohackers/internal/primetime"
+	"TDMR87/go_protohackers/internal/server"
+	"TDMR87/go_protohackers/internal/smoketest"
+	"TDMR87/go_protohackers/internal/speeddaemon"
+	"TDMR87/go_protohackers/internal/unusualdatabase"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTCP starts srv on a free port for the duration of the test and
+// returns its address.
+func startTCP(t *testing.T, srv *server.Server) string {
+	t.Helper()
+	listener, err := srv.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+	return listener.Addr().String()
+}
+
+func TestScenariosLoadTheServices(t *testing.T) {
+	for _, tt := range []struct {
+		scenario string
+		start    func(t *testing.T) string
+		counts   []string
+	}{
+		{"smoketest", func(t *testing.T) string { return startTCP(t, smoketest.NewServer("127.0.0.1:0")) }, []string{"echoes"}},
+		{"primetime", func(t *testing.T) string { return startTCP(t, primetime.NewServer("127.0.0.1:0")) }, []string{"requests"}},
+		{"means_to_an_end", func(t *testing.T) string { return startTCP(t, meanstoanend.NewServer("127.0.0.1:0")) }, []string{"inserts", "queries"}},
+		{"budget_chat", func(t *testing.T) string { return startTCP(t, budgetchat.NewServer("127.0.0.1:0")) }, []string{"messages sent", "deliveries"}},
+		{"unusual_database_program", func(t *testing.T) string {
+			srv := unusualdatabase.NewServer("127.0.0.1:0")
+			if err := srv.Start(); err != nil {
+				t.Fatal("Error starting server:", err)
+			}
+			t.Cleanup(func() { srv.Close() })
+			return srv.LocalAddr().String()
+		}, []string{"sets", "gets"}},
+		{"mob_in_the_middle", func(t *testing.T) string {
+			upstream := startTCP(t, budgetchat.NewServer("127.0.0.1:0"))
+			return startTCP(t, mobinthemiddle.NewServer("127.0.0.1:0", upstream))
+		}, []string{"messages sent", "deliveries"}},
+		{"speed_daemon", func(t *testing.T) string { return startTCP(t, speeddaemon.NewServer("127.0.0.1:0")) }, []string{"observations", "tickets"}},
+	} {
+		t.Run(tt.scenario, func(t *testing.T) {
+			t.Parallel()
+			s, err := findScenario(tt.scenario)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g := &generator{
+				addr:       tt.start(t),
+				clients:    3,
+				interval:   20 * time.Millisecond,
+				timeout:    2 * time.Second,
+				writeRatio: 0.5,
+				size:       100_000,
+				stats:      newStats(),
+			}
+			ctx, cancel := context.WithTimeout(t.Context(), 500*time.Millisecond)
+			defer cancel()
+			if err := g.run(ctx, s); err != nil {
+				t.Fatal(err)
+			}
+
+			var report strings.Builder
+			g.stats.report(&report, time.Second)
+			for _, name := range tt.counts {
+				if g.stats.counts[name] == 0 {
+					t.Errorf("Expected some %s, got:\n%s", name, report.String())
+				}
+			}
+			if len(g.stats.latencies) == 0 || len(g.stats.errors) > 0 {
+				t.Errorf("Expected latencies and no errors, got:\n%s", report.String())
+			}
+		})
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("reading: %w", os.ErrDeadlineExceeded), "timeout"},
+		{io.ErrUnexpectedEOF, "connection closed by the service"},
+		{&net.OpError{Op: "dial", Net: "tcp", Addr: &net.TCPAddr{Port: 1234}, Err: errors.New("connection refused")}, "dial: connection refused"},
+		{errors.New("garbled message"), "garbled message"},
+	} {
+		if got := errorKind(tt.err); got != tt.want {
+			t.Errorf("errorKind(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := range 100 {
+		latencies = append(latencies, time.Duration(i+1)*time.Millisecond)
+	}
+	for _, tt := range []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0.5, 50 * time.Millisecond},
+		{0.99, 99 * time.Millisecond},
+		{1, 100 * time.Millisecond},
+		{0, time.Millisecond},
+	} {
+		if got := percentile(latencies, tt.p); got != tt.want {
+			t.Errorf("percentile(%g) = %s, want %s", tt.p, got, tt.want)
+		}
+	}
+	if got := percentile(nil, 0.5); got != 0 {
+		t.Errorf("percentile of nothing = %s, want 0", got)
+	}
+}
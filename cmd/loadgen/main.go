@@ -0,0 +1,84 @@
+// Command loadgen puts one of the services under load for a while and
+// reports its throughput, its latency percentiles and the errors its clients
+// ran into.
+//
+//	loadgen [-clients 10] [-duration 10s] [-rate 0] scenario host:port
+//
+// The scenario is named after the service it loads, or given by its number,
+// as in "6" or "speed_daemon". Each simulated client has a connection of its
+// own and does an operation every 1/-rate seconds. Run it with -help for what
+// an operation is in each scenario.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	clients := flag.Int("clients", 10, "number of simulated `clients`")
+	duration := flag.Duration("duration", 10*time.Second, "how long to run")
+	rate := flag.Float64("rate", 0, "operations per second per client; 0 keeps the scenario's default, negative means as fast as possible")
+	timeout := flag.Duration("timeout", 5*time.Second, "how long to wait for any response")
+	writeRatio := flag.Float64("write-ratio", 0.5, "fraction of operations that write, in the means_to_an_end and unusual_database_program scenarios")
+	size := flag.Int("size", 1024, "payload `bytes` per operation, in the smoketest scenario")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: loadgen [flags] scenario host:port")
+		fmt.Fprintln(flag.CommandLine.Output(), "\nScenarios:")
+		for _, s := range scenarios {
+			fmt.Fprintf(flag.CommandLine.Output(), "  %d %s\n    \t%s\n", s.number, s.name, s.description)
+		}
+		fmt.Fprintln(flag.CommandLine.Output(), "\nFlags:")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *clients < 1 || *writeRatio < 0 || *writeRatio > 1 || *size < 1 {
+		log.Fatal("-clients and -size must be positive and -write-ratio between 0 and 1")
+	}
+
+	s, err := findScenario(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *rate == 0 {
+		*rate = s.rate
+	}
+	g := &generator{
+		addr:       flag.Arg(1),
+		clients:    *clients,
+		timeout:    *timeout,
+		writeRatio: *writeRatio,
+		size:       *size,
+		stats:      newStats(),
+	}
+	if *rate > 0 {
+		g.interval = time.Duration(float64(time.Second) / *rate)
+	}
+
+	// Stop early, and still report, on Ctrl-C.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	pace := "as fast as possible"
+	if *rate > 0 {
+		pace = fmt.Sprintf("%g operations/s each", *rate)
+	}
+	fmt.Printf("%s against %s: %d clients, %s, for %s\n", s.name, g.addr, *clients, pace, *duration)
+	start := time.Now()
+	if err := g.run(ctx, s); err != nil {
+		log.Fatal(err)
+	}
+	g.stats.report(os.Stdout, time.Since(start))
+}
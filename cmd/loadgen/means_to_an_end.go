@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"math/rand/v2"
+	"time"
+)
+
+var meansToAnEndScenario = scenario{
+	number:      2,
+	name:        "means_to_an_end",
+	description: "each operation inserts a price, as a -write-ratio of them do, or else queries the mean of a range of the session's; latency is until a query's result",
+	start: func(ctx context.Context, g *generator) (client, error) {
+		return func(ctx context.Context, id int) error {
+			conn, err := g.dial(ctx)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			var timestamp int32
+			message := make([]byte, 9)
+			result := make([]byte, 4)
+			var next time.Time
+			for g.pace(ctx, &next) {
+				g.deadline(conn)
+				insert := timestamp == 0 || rand.Float64() < g.writeRatio
+				if insert {
+					timestamp += 1 + rand.Int32N(100)
+					message[0] = 'I'
+					binary.BigEndian.PutUint32(message[1:], uint32(timestamp))
+					binary.BigEndian.PutUint32(message[5:], uint32(rand.Int32N(100_000)))
+				} else {
+					minTime := rand.Int32N(timestamp + 1)
+					message[0] = 'Q'
+					binary.BigEndian.PutUint32(message[1:], uint32(minTime))
+					binary.BigEndian.PutUint32(message[5:], uint32(minTime+rand.Int32N(timestamp-minTime+1)))
+				}
+
+				start := time.Now()
+				if _, err := conn.Write(message); err != nil {
+					return err
+				}
+				if insert {
+					g.stats.count("inserts", 1)
+					continue
+				}
+				if _, err := io.ReadFull(conn, result); err != nil {
+					return err
+				}
+				g.stats.respond(time.Since(start))
+				g.stats.count("queries", 1)
+			}
+			return nil
+		}, nil
+	},
+}
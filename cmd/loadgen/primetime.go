@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+var primetimeScenario = scenario{
+	number:      1,
+	name:        "primetime",
+	description: "each operation asks whether a number below a billion is prime; latency is until the answer",
+	start: func(ctx context.Context, g *generator) (client, error) {
+		return func(ctx context.Context, id int) error {
+			conn, err := g.dial(ctx)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			reader := bufio.NewReader(conn)
+			var next time.Time
+			for g.pace(ctx, &next) {
+				n := rand.N(1_000_000_000)
+				g.deadline(conn)
+				start := time.Now()
+				if _, err := fmt.Fprintf(conn, `{"method":"isPrime","number":%d}`+"\n", n); err != nil {
+					return err
+				}
+				line, err := reader.ReadBytes('\n')
+				if err != nil {
+					return err
+				}
+				g.stats.respond(time.Since(start))
+				g.stats.count("requests", 1)
+
+				var response struct {
+					Method string `json:"method"`
+					Prime  bool   `json:"prime"`
+				}
+				if err := json.Unmarshal(line, &response); err != nil || response.Method != "isPrime" {
+					return errors.New("malformed response")
+				}
+				if response.Prime != isPrime(n) {
+					g.stats.fail(errors.New("wrong answer"))
+				}
+			}
+			return nil
+		}, nil
+	},
+}
+
+func isPrime(n int) bool {
+	if n < 2 {
+		return false
+	}
+	for i := 2; i*i <= n; i++ {
+		if n%i == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"time"
+)
+
+var smoketestScenario = scenario{
+	number:      0,
+	name:        "smoketest",
+	description: "each operation sends -size bytes and reads them back; latency is until the last byte is back",
+	start: func(ctx context.Context, g *generator) (client, error) {
+		return func(ctx context.Context, id int) error {
+			conn, err := g.dial(ctx)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			payload := make([]byte, g.size)
+			for i := range payload {
+				payload[i] = byte(rand.N(256))
+			}
+			echo := make([]byte, g.size)
+			var next time.Time
+			for g.pace(ctx, &next) {
+				g.deadline(conn)
+				start := time.Now()
+				// Send while reading, since the service may echo a large
+				// payload before it has read all of it.
+				written := make(chan error, 1)
+				go func() {
+					_, err := conn.Write(payload)
+					written <- err
+				}()
+				_, err := io.ReadFull(conn, echo)
+				if err := errors.Join(err, <-written); err != nil {
+					return err
+				}
+				g.stats.respond(time.Since(start))
+				if !bytes.Equal(echo, payload) {
+					return errors.New("echo differs from what was sent")
+				}
+				g.stats.count("echoes", 1)
+				g.stats.count("bytes echoed", g.size)
+			}
+			return nil
+		}, nil
+	},
+}
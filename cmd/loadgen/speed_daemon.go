@@ -0,0 +1,135 @@
+package main
+
+import (
+	"TDMR87/go_protohackers/internal/speeddaemon"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+)
+
+// speedDaemonRoads is how many roads the clients are spread over.
+const speedDaemonRoads = 16
+
+var speedDaemonScenario = scenario{
+	number:      6,
+	name:        "speed_daemon",
+	description: "each client is a pair of cameras 10 miles apart, and each operation a car seen by both going too fast; latency is until the dispatcher has the ticket",
+	rate:        10,
+	start: func(ctx context.Context, g *generator) (client, error) {
+		// Start from a random road so that tickets from earlier runs against
+		// the same service don't count.
+		first := uint16(1 + rand.N(60_000))
+		roads := make([]uint16, speedDaemonRoads)
+		for i := range roads {
+			roads[i] = first + uint16(i)
+		}
+
+		dispatcher, err := g.dial(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := dispatcher.Write(speeddaemon.IAmDispatcher{Numroads: uint8(len(roads)), Roads: roads}.Encode()); err != nil {
+			dispatcher.Close()
+			return nil, err
+		}
+
+		// seen is when each car was seen by its second camera.
+		var seen sync.Map
+		go func() {
+			defer dispatcher.Close()
+			reader := bufio.NewReader(dispatcher)
+			for {
+				ticket, err := readTicket(reader)
+				if err != nil {
+					if ctx.Err() == nil {
+						g.stats.fail(fmt.Errorf("dispatcher: %w", err))
+					}
+					return
+				}
+				if at, ok := seen.LoadAndDelete(ticket.Plate); ok {
+					g.stats.respond(time.Since(at.(time.Time)))
+				}
+				g.stats.count("tickets", 1)
+			}
+		}()
+
+		return func(ctx context.Context, id int) error {
+			road := roads[id%len(roads)]
+			var cameras [2]net.Conn
+			for i, mile := range []uint16{0, 10} {
+				conn, err := g.dial(ctx)
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				if _, err := conn.Write(speeddaemon.IAmCamera{Road: road, Mile: mile, Limit: 60}.Encode()); err != nil {
+					return err
+				}
+				cameras[i] = conn
+			}
+
+			// Each car does 120 mph, and has a plate of its own so that it gets a
+			// ticket of its own, even across reconnections.
+			session := rand.N(1_000_000)
+			var next time.Time
+			for car := 0; g.pace(ctx, &next); car++ {
+				plate := fmt.Sprintf("LG%dS%dC%d", id, session, car)
+				timestamp := uint32(car) * 1000
+				for i, camera := range cameras {
+					data, err := speeddaemon.Plate{Plate: plate, Timestamp: timestamp + uint32(i)*300}.Encode()
+					if err != nil {
+						return err
+					}
+					if i == len(cameras)-1 {
+						seen.Store(plate, time.Now())
+					}
+					camera.SetWriteDeadline(time.Now().Add(g.timeout))
+					if _, err := camera.Write(data); err != nil {
+						return err
+					}
+				}
+				g.stats.count("cars", 1)
+				g.stats.count("observations", len(cameras))
+			}
+			return nil
+		}, nil
+	},
+}
+
+// readTicket reads the next message to the dispatcher, which should be a
+// ticket.
+func readTicket(reader *bufio.Reader) (speeddaemon.Ticket, error) {
+	msgType, err := reader.ReadByte()
+	if err != nil {
+		return speeddaemon.Ticket{}, err
+	}
+	switch msgType {
+	case speeddaemon.Ticket{}.Type():
+		length, err := reader.ReadByte()
+		if err != nil {
+			return speeddaemon.Ticket{}, err
+		}
+		data := make([]byte, 2+int(length)+2+2+4+2+4+2)
+		data[0], data[1] = msgType, length
+		if _, err := io.ReadFull(reader, data[2:]); err != nil {
+			return speeddaemon.Ticket{}, err
+		}
+		return speeddaemon.Ticket{}.Decode(data)
+	case speeddaemon.Error{}.Type():
+		length, err := reader.ReadByte()
+		if err != nil {
+			return speeddaemon.Ticket{}, err
+		}
+		msg := make([]byte, length)
+		if _, err := io.ReadFull(reader, msg); err != nil {
+			return speeddaemon.Ticket{}, err
+		}
+		return speeddaemon.Ticket{}, fmt.Errorf("error from the service: %s", msg)
+	}
+	return speeddaemon.Ticket{}, fmt.Errorf("unexpected message type %#x", msgType)
+}
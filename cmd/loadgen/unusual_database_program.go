@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+// keyspace is how many keys the clients share, so that gets mostly find
+// something that was set.
+const keyspace = 1000
+
+var unusualDatabaseScenario = scenario{
+	number:      4,
+	name:        "unusual_database_program",
+	description: "each operation sets a key, as a -write-ratio of them do, or else gets one; latency is until a get's reply",
+	start: func(ctx context.Context, g *generator) (client, error) {
+		return func(ctx context.Context, id int) error {
+			conn, err := g.dialUdp(ctx)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			reply := make([]byte, 1000)
+			var next time.Time
+			for g.pace(ctx, &next) {
+				key := fmt.Sprintf("key%d", rand.N(keyspace))
+				if rand.Float64() < g.writeRatio {
+					if _, err := fmt.Fprintf(conn, "%s=%d from client %d", key, time.Now().UnixNano(), id); err != nil {
+						return err
+					}
+					g.stats.count("sets", 1)
+					continue
+				}
+
+				g.deadline(conn)
+				start := time.Now()
+				if _, err := conn.Write([]byte(key)); err != nil {
+					return err
+				}
+				g.stats.count("gets", 1)
+				// A lost datagram is an error but not the end of the client, which
+				// skips any late replies to earlier gets.
+				for {
+					n, err := conn.Read(reply)
+					if err != nil {
+						if ctx.Err() == nil {
+							g.stats.fail(err)
+						}
+						break
+					}
+					if strings.HasPrefix(string(reply[:n]), key+"=") {
+						g.stats.respond(time.Since(start))
+						break
+					}
+					if !strings.HasPrefix(string(reply[:n]), "key") {
+						g.stats.fail(errors.New("reply for a key that wasn't asked for"))
+					}
+				}
+			}
+			return nil
+		}, nil
+	},
+}
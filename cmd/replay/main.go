@@ -0,0 +1,51 @@
+// Command replay re-drives a traffic recording made with server.Record or
+// server.RecordUdp against a running service and reports every response
+// that differs from the recorded one.
+//
+//	replay [-timeout 2s] host:port recording.jsonl
+package main
+
+import (
+	"TDMR87/go_protohackers/internal/server"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+func main() {
+	timeout := flag.Duration("timeout", 2*time.Second, "how long to wait for each response")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: replay [flags] host:port recording.jsonl")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	addr, path := flag.Arg(0), flag.Arg(1)
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	events, err := server.ReadRecording(f)
+	f.Close()
+	if err != nil {
+		log.Fatalf("Error reading %s: %v", path, err)
+	}
+
+	mismatches, err := replay(addr, events, *timeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, m := range mismatches {
+		fmt.Println(m)
+	}
+	fmt.Printf("Replayed %d events, %d responses differed\n", len(events), len(mismatches))
+	if len(mismatches) > 0 {
+		os.Exit(1)
+	}
+}
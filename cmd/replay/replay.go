@@ -0,0 +1,152 @@
+package main
+
+import (
+	"TDMR87/go_protohackers/internal/server"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// mismatch is a response that differs from the recording.
+type mismatch struct {
+	session  string
+	index    int // Position among the session's responses, from 1
+	expected []byte
+	actual   []byte
+	err      error
+}
+
+func (m mismatch) String() string {
+	s := fmt.Sprintf("session %s, response %d:\n  expected: %q\n  actual:   %q", m.session, m.index, m.expected, m.actual)
+	if m.err != nil {
+		s += fmt.Sprintf("\n  error:    %v", m.err)
+	}
+	return s
+}
+
+// replayer plays the client side of a recording. Events are replayed in
+// their recorded order across all sessions, and every response is awaited
+// before moving on, so that interactions between clients (such as a chat
+// message reaching another user) happen in the same order as recorded.
+type replayer struct {
+	addr      string
+	timeout   time.Duration
+	tcp       map[string]net.Conn
+	udp       map[string]*net.UDPConn
+	responses map[string]int
+}
+
+func replay(addr string, events []server.TrafficEvent, timeout time.Duration) ([]mismatch, error) {
+	r := &replayer{
+		addr:      addr,
+		timeout:   timeout,
+		tcp:       make(map[string]net.Conn),
+		udp:       make(map[string]*net.UDPConn),
+		responses: make(map[string]int),
+	}
+	defer r.closeAll()
+
+	var mismatches []mismatch
+	for _, event := range events {
+		switch event.Event {
+		case "open":
+			if _, err := r.conn(event); err != nil {
+				return mismatches, err
+			}
+		case "in":
+			conn, err := r.conn(event)
+			if err != nil {
+				return mismatches, err
+			}
+			conn.Write(event.Data)
+		case "out":
+			conn, err := r.conn(event)
+			if err != nil {
+				return mismatches, err
+			}
+			if m, ok := r.expect(conn, event); !ok {
+				mismatches = append(mismatches, m)
+			}
+		case "close":
+			if conn, ok := r.tcp[event.Session]; ok {
+				conn.Close()
+				delete(r.tcp, event.Session)
+			}
+		}
+	}
+	return mismatches, nil
+}
+
+// conn returns the connection replaying the event's session, dialling it on
+// first use.
+func (r *replayer) conn(event server.TrafficEvent) (net.Conn, error) {
+	if event.Network == "udp" {
+		if conn, ok := r.udp[event.Session]; ok {
+			return conn, nil
+		}
+		addr, err := net.ResolveUDPAddr("udp", r.addr)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := net.DialUDP("udp", nil, addr)
+		if err != nil {
+			return nil, err
+		}
+		r.udp[event.Session] = conn
+		return conn, nil
+	}
+
+	if conn, ok := r.tcp[event.Session]; ok {
+		return conn, nil
+	}
+	conn, err := net.DialTimeout("tcp", r.addr, r.timeout)
+	if err != nil {
+		return nil, fmt.Errorf("session %s: %w", event.Session, err)
+	}
+	r.tcp[event.Session] = conn
+	return conn, nil
+}
+
+// expect reads the response to compare with a recorded "out" event. For TCP
+// that is as many bytes as were recorded, however the service chunks them,
+// and for UDP a single datagram.
+func (r *replayer) expect(conn net.Conn, event server.TrafficEvent) (mismatch, bool) {
+	r.responses[event.Session]++
+	conn.SetReadDeadline(time.Now().Add(r.timeout))
+
+	var actual []byte
+	var err error
+	if event.Network == "udp" {
+		buf := make([]byte, 65536)
+		var n int
+		n, err = conn.Read(buf)
+		actual = buf[:n]
+	} else {
+		actual = make([]byte, len(event.Data))
+		var n int
+		n, err = io.ReadFull(conn, actual)
+		actual = actual[:n]
+	}
+
+	if err == nil && bytes.Equal(actual, event.Data) {
+		return mismatch{}, true
+	}
+	return mismatch{
+		session:  event.Session,
+		index:    r.responses[event.Session],
+		expected: event.Data,
+		actual:   actual,
+		err:      err,
+	}, false
+}
+
+func (r *replayer) closeAll() {
+	for _, conn := range r.tcp {
+		conn.Close()
+	}
+	for _, conn := range r.udp {
+		conn.Close()
+	}
+}
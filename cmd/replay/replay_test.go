@@ -0,0 +1,97 @@
+package main
+
+import (
+	"TDMR87/go_protohackers/internal/server"
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func echoLines(upper bool) server.Handler {
+	return func(conn net.Conn) {
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if upper {
+				line = strings.ToUpper(line)
+			}
+			conn.Write([]byte(line + "\n"))
+		}
+	}
+}
+
+func TestReplayTcp(t *testing.T) {
+	var recording bytes.Buffer
+	recorded := server.NewServer("127.0.0.1:0", echoLines(false))
+	recorded.Middleware = []server.Middleware{server.Record(server.NewRecorder(&recording))}
+	listener, err := recorded.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	reader := bufio.NewReader(conn)
+	for _, line := range []string{"hello\n", "world\n"} {
+		conn.Write([]byte(line))
+		reader.ReadString('\n')
+	}
+	conn.Close()
+	recorded.Shutdown(t.Context())
+
+	events, err := server.ReadRecording(&recording)
+	if err != nil {
+		t.Fatal("Error reading recording:", err)
+	}
+
+	for _, tt := range []struct {
+		upper      bool
+		mismatches int
+	}{{false, 0}, {true, 2}} {
+		listener, err := server.StartTcpListener("127.0.0.1:0", echoLines(tt.upper))
+		if err != nil {
+			t.Fatal("Error starting server:", err)
+		}
+		defer listener.Close()
+
+		mismatches, err := replay(listener.Addr().String(), events, time.Second)
+		if err != nil {
+			t.Fatal("Error replaying:", err)
+		}
+		if len(mismatches) != tt.mismatches {
+			t.Fatalf("Expected %d mismatches, got %v", tt.mismatches, mismatches)
+		}
+		if tt.mismatches > 0 && string(mismatches[0].actual) != "HELLO\n" {
+			t.Fatalf("Expected the actual response in the mismatch, got %q", mismatches[0].actual)
+		}
+	}
+}
+
+func TestReplayUdp(t *testing.T) {
+	events := []server.TrafficEvent{
+		{Network: "udp", Session: "127.0.0.1:1000", Event: "in", Data: []byte("version")},
+		{Network: "udp", Session: "127.0.0.1:1000", Event: "out", Data: []byte("version=1")},
+	}
+
+	s, err := server.StartUdpListener("127.0.0.1:0", func(conn server.UdpConn, buf []byte, n int, addr *net.UDPAddr) {
+		conn.WriteToUDP([]byte("version=2"), addr)
+	})
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer s.Close()
+
+	mismatches, err := replay(s.LocalAddr().String(), events, time.Second)
+	if err != nil {
+		t.Fatal("Error replaying:", err)
+	}
+	if len(mismatches) != 1 || string(mismatches[0].actual) != "version=2" {
+		t.Fatalf("Expected the changed version to be reported, got %v", mismatches)
+	}
+}
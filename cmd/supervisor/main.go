@@ -0,0 +1,202 @@
+// Command supervisor runs any subset of the services in one process, each on
+// its own address, restarting those that fail.
+//
+// -services lists the services to run as comma-separated names, each
+// optionally followed by "=" and the address to serve it on, such as
+// "primetime,budget_chat=:9000". Empty means every service on its default
+// address. -status-addr, if set, serves the status of every service as JSON.
+// "supervisor healthcheck" checks on every selected service of a running
+// supervisor with the same configuration instead.
+// The flags shared with the individual commands apply to all services. Run
+// it with -help for the full list of flags and their environment variables.
+package main
+
+import (
+	"TDMR87/go_protohackers/internal/budgetchat"
+	"TDMR87/go_protohackers/internal/meanstoanend"
+	"TDMR87/go_protohackers/internal/mobinthemiddle"
+	"TDMR87/go_protohackers/internal/primetime"
+	"TDMR87/go_protohackers/internal/server"
+	"TDMR87/go_protohackers/internal/smoketest"
+	"TDMR87/go_protohackers/internal/speeddaemon"
+	"TDMR87/go_protohackers/internal/supervisor"
+	"TDMR87/go_protohackers/internal/unusualdatabase"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// service is one of the services the supervisor can run.
+type service struct {
+	name  string
+	addr  string // Default address
+	tcp   func(addr string) *server.Server
+	udp   func(addr string) *server.UdpServer
+	check server.HealthCheck
+}
+
+var services = []service{
+	{name: "smoketest", addr: ":8080", tcp: smoketest.NewServer, check: smoketest.CheckHealth},
+	{name: "primetime", addr: ":8081", tcp: primetime.NewServer, check: primetime.CheckHealth},
+	{name: "means_to_an_end", addr: ":8082", tcp: meanstoanend.NewServer, check: meanstoanend.CheckHealth},
+	{name: "budget_chat", addr: ":8083", tcp: budgetchat.NewServer, check: budgetchat.CheckHealth},
+	{name: "unusual_database_program", addr: ":8084", udp: unusualdatabase.NewServer, check: unusualdatabase.CheckHealth},
+	{name: "mob_in_the_middle", addr: ":8085", tcp: func(addr string) *server.Server {
+		return mobinthemiddle.NewServer(addr, upstreamAddr)
+	}, check: mobinthemiddle.CheckHealth},
+	{name: "speed_daemon", addr: ":8086", tcp: speeddaemon.NewServer, check: speeddaemon.CheckHealth},
+}
+
+// upstreamAddr is the Budget Chat server mob_in_the_middle proxies to.
+var upstreamAddr string
+
+// settings are the command's configuration.
+type settings struct {
+	server.Config
+	chat         budgetchat.Settings
+	proxy        mobinthemiddle.Settings
+	daemon       speeddaemon.Settings
+	services     string
+	statusAddr   string
+	upstreamAddr string
+}
+
+// define registers the command's flags on s.
+func (s *settings) define(f *server.Flags) {
+	s.AddFlags(f)
+	s.AddTCPFlags(f)
+	s.AddUdpFlags(f)
+	s.chat.AddFlags(f)
+	s.proxy.AddFlags(f)
+	s.daemon.AddFlags(f)
+	f.String(&s.services, "services", "", "comma-separated `services` to run, each optionally as name=address; all of them if empty")
+	f.EndpointAddr(&s.statusAddr, "status-addr", "", "`address` to serve the status of every service on")
+	f.DialAddr(&s.upstreamAddr, "upstream-addr", mobinthemiddle.DefaultUpstream, "`address` of the Budget Chat server for mob_in_the_middle to proxy to")
+}
+
+// apply applies the settings of the services.
+func (s *settings) apply() {
+	s.chat.Apply()
+	s.proxy.Apply()
+	s.daemon.Apply()
+}
+
+func main() {
+	config, flags, err := server.LoadConfig("supervisor", (*settings).define)
+	if err != nil {
+		log.Fatal(err)
+	}
+	selected, err := selectServices(config.services)
+	if err != nil {
+		log.Fatal(err)
+	}
+	config.apply()
+	if flags.Healthcheck() {
+		if err := checkHealth(&config.Config, selected); err != nil {
+			log.Fatal("Unhealthy: ", err)
+		}
+		return
+	}
+	if err := config.SetupLogging(""); err != nil {
+		log.Fatal(err)
+	}
+	logger := slog.Default()
+	upstreamAddr = config.upstreamAddr
+
+	s := &supervisor.Supervisor{}
+	for _, svc := range selected {
+		logger := logger.With("service", svc.name)
+		if svc.udp != nil {
+			s.Services = append(s.Services, supervisor.UDP(svc.name, func() *server.UdpServer {
+				srv := svc.udp(svc.addr)
+				srv.Logger = logger
+				config.ConfigureUdp(srv)
+				return srv
+			}))
+			continue
+		}
+		s.Services = append(s.Services, supervisor.TCP(svc.name, func() *server.Server {
+			srv := svc.tcp(svc.addr)
+			srv.Logger = logger
+			config.Configure(srv)
+			return srv
+		}))
+	}
+
+	ctx, stop := config.SignalContext()
+	defer stop()
+
+	config.ServeEndpoints(ctx)
+	if config.statusAddr != "" {
+		go server.ServeEndpoint(ctx, "status", config.statusAddr, s)
+	}
+	go server.WatchConfig(ctx, "supervisor", flags, (*settings).define, func(next *settings) {
+		next.Reconfigure(nil)
+		next.apply()
+	})
+
+	if err := s.Run(ctx); err != nil {
+		slog.Error("Supervisor stopped", "err", err)
+		os.Exit(1)
+	}
+}
+
+// checkHealth checks every selected service, returning the failures of all
+// those that are unhealthy.
+func checkHealth(config *server.Config, selected []service) error {
+	var errs []error
+	for _, svc := range selected {
+		check := config.CheckHealth
+		if svc.udp != nil {
+			check = config.CheckUdpHealth
+		}
+		if err := check(svc.addr, svc.check); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", svc.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// selectServices parses the -services list.
+func selectServices(list string) ([]service, error) {
+	if strings.TrimSpace(list) == "" {
+		return services, nil
+	}
+
+	var selected []service
+	for entry := range strings.SplitSeq(list, ",") {
+		name, addr, hasAddr := strings.Cut(strings.TrimSpace(entry), "=")
+		svc, ok := findService(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown service %q, expected one of %s", name, serviceNames())
+		}
+		if hasAddr {
+			if err := server.CheckListenAddr(addr); err != nil {
+				return nil, fmt.Errorf("invalid address for service %s: %w", name, err)
+			}
+			svc.addr = addr
+		}
+		selected = append(selected, svc)
+	}
+	return selected, nil
+}
+
+func findService(name string) (service, bool) {
+	for _, svc := range services {
+		if svc.name == name {
+			return svc, true
+		}
+	}
+	return service{}, false
+}
+
+func serviceNames() string {
+	names := make([]string, len(services))
+	for i, svc := range services {
+		names[i] = svc.name
+	}
+	return strings.Join(names, ", ")
+}
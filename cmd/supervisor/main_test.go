@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestSelectServices(t *testing.T) {
+	selected, err := selectServices("")
+	if err != nil || len(selected) != len(services) {
+		t.Fatalf("Expected every service by default, got %d (%v)", len(selected), err)
+	}
+
+	selected, err = selectServices("primetime, budget_chat=:9000")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if len(selected) != 2 || selected[0].name != "primetime" || selected[0].addr != ":8081" ||
+		selected[1].name != "budget_chat" || selected[1].addr != ":9000" {
+		t.Fatalf("Unexpected selection %+v", selected)
+	}
+
+	if _, err := selectServices("primetime,chess"); err == nil {
+		t.Fatal("Expected an error for an unknown service")
+	}
+	if _, err := selectServices("primetime=:http-alt"); err == nil {
+		t.Fatal("Expected an error for an invalid address")
+	}
+}
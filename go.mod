@@ -2,7 +2,4 @@ module TDMR87/go_protohackers
 
 go 1.25.0
 
-require (
-	github.com/dlclark/regexp2 v1.11.5
-	github.com/google/uuid v1.6.0
-)
+require github.com/dlclark/regexp2 v1.11.5
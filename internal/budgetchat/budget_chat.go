@@ -0,0 +1,208 @@
+// Package budgetchat implements Protohackers problem 3, Budget Chat: a
+// line-based chat room.
+package budgetchat
+
+import (
+	"TDMR87/go_protohackers/internal/server"
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewServer returns a server for the service on addr, with a room of its own,
+// configured the way it is deployed.
+func NewServer(addr string) *server.Server {
+	chatroom := NewChatRoom()
+	server.NewGaugeFunc("budget_chat_users", "Users currently in the chat room.", func() float64 {
+		chatroom.Lock.RLock()
+		defer chatroom.Lock.RUnlock()
+		return float64(len(chatroom.JoinedUsers))
+	})
+
+	srv := server.NewServer(addr, chatroom.handle)
+	srv.Name = "budget_chat"
+	srv.Middleware = []server.Middleware{server.AccessLog()}
+	srv.MaxConnsPerIP = 64
+	srv.RejectMessage = NewChatMessage("Too many connections, please try again later")
+	srv.HandshakeTimeout = 30 * time.Second // Time to pick a name
+	srv.IdleTimeout = 30 * time.Minute
+	srv.WriteTimeout = 10 * time.Second // Give up on a client that stops reading
+	return srv
+}
+
+func (chatroom *ChatRoom) handle(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	logger := server.Logger(conn)
+	conn.Write(NewChatMessage("Welcome to budgetchat! What shall I call you?"))
+
+	username := GetUsername(scanner)
+	if rules := settings.Load(); !rules.UsernamePattern.MatchString(username) {
+		logger.Info("Rejected invalid username", "username", username)
+		conn.Write(rules.invalidUsernameMessage())
+		conn.Close()
+		return
+	}
+
+	logger = logger.With("username", username)
+	server.SetConnLabel(conn, username)
+	logger.Info("User joined")
+	delivered := chatroom.AddUser(username, conn)
+	joinsTotal.Inc()
+	chatroom.SendWelcomeMessage(username)
+	chatroom.Announce(username, NewChatMessage(fmt.Sprintf("* %s has entered the room", username)))
+
+	for scanner.Scan() {
+		msg := scanner.Text()
+		chatroom.Relay(username, NewChatMessage(fmt.Sprintf("[%s] %s", username, msg)))
+		messagesTotal.Inc()
+	}
+
+	logger.Info("User left")
+	chatroom.RemoveUser(username, conn)
+	chatroom.Announce(username, NewChatMessage(fmt.Sprintf("* %s has left the room", username)))
+	<-delivered // The server counts the session as over once handle returns
+}
+
+type ChatMessage []byte
+type ChatRoom struct {
+	JoinedUsers map[string]*member
+	Lock        sync.RWMutex
+}
+
+// outboxSize is how many messages a user may fall behind by before the room
+// gives up on them.
+const outboxSize = 256
+
+// member is a user in the room. Messages to them wait in outbox for their
+// own goroutine to write them to conn, so that a user who stops reading holds
+// up nobody but themselves.
+type member struct {
+	conn      net.Conn
+	outbox    chan ChatMessage
+	delivered chan struct{} // Closed once deliver has returned
+}
+
+var (
+	joinsTotal    = server.NewCounter("budget_chat_joins_total", "Users that joined the chat room.")
+	messagesTotal = server.NewCounter("budget_chat_messages_total", "Chat messages relayed to the room.")
+	droppedTotal  = server.NewCounter("budget_chat_dropped_total", "Users dropped for falling too far behind the room.")
+)
+
+func NewChatRoom() *ChatRoom {
+	return &ChatRoom{
+		JoinedUsers: make(map[string]*member),
+	}
+}
+
+func GetUsername(scanner *bufio.Scanner) (username string) {
+	if scanner.Scan() {
+		username = scanner.Text()
+	}
+	return username
+}
+
+// AddUser adds the user on conn to the room and starts delivering the
+// room's messages to them. A user already there by the same name is
+// disconnected. The returned channel is closed once delivery has stopped,
+// after the user is removed, which the connection's handler should wait for
+// so that nothing writes to conn once it has returned.
+func (chatroom *ChatRoom) AddUser(user string, conn net.Conn) <-chan struct{} {
+	chatroom.Lock.Lock()
+	defer chatroom.Lock.Unlock()
+	if old, ok := chatroom.JoinedUsers[user]; ok {
+		server.Logger(old.conn).Info("Disconnected a user whose name was taken", "username", user)
+		chatroom.remove(user, old)
+		old.conn.Close()
+	}
+	m := &member{conn: conn, outbox: make(chan ChatMessage, outboxSize), delivered: make(chan struct{})}
+	chatroom.JoinedUsers[user] = m
+	go m.deliver()
+	return m.delivered
+}
+
+func (chatroom *ChatRoom) RemoveUser(user string, conn net.Conn) {
+	chatroom.Lock.Lock()
+	defer chatroom.Lock.Unlock()
+	if m, ok := chatroom.JoinedUsers[user]; ok && m.conn == conn {
+		chatroom.remove(user, m)
+	}
+	conn.Close()
+}
+
+// remove takes m out of the room and stops delivering to them once what is
+// already in their outbox is written. The lock must be held.
+func (chatroom *ChatRoom) remove(user string, m *member) {
+	delete(chatroom.JoinedUsers, user)
+	close(m.outbox)
+}
+
+func (chatroom *ChatRoom) Announce(from string, msg ChatMessage) {
+	chatroom.Relay(from, msg)
+}
+
+func (chatroom *ChatRoom) Relay(from string, msg ChatMessage) {
+	chatroom.Lock.Lock()
+	defer chatroom.Lock.Unlock()
+	for user, m := range chatroom.JoinedUsers {
+		if user == from {
+			continue
+		}
+		chatroom.send(user, m, msg)
+	}
+}
+
+// send queues msg for user. A user whose outbox is full has stopped reading,
+// and is dropped from the room and disconnected, which their handler then
+// announces. The lock must be held.
+func (chatroom *ChatRoom) send(user string, m *member, msg ChatMessage) {
+	select {
+	case m.outbox <- msg:
+	default:
+		server.Logger(m.conn).Warn("Dropped a user who stopped reading", "username", user)
+		droppedTotal.Inc()
+		chatroom.remove(user, m)
+		m.conn.Close()
+	}
+}
+
+// deliver writes the member's messages to their connection until their
+// outbox is closed. A failed write closes the connection, which ends their
+// session.
+func (m *member) deliver() {
+	defer close(m.delivered)
+	for msg := range m.outbox {
+		if _, err := m.conn.Write(msg); err != nil {
+			m.conn.Close()
+		}
+	}
+}
+
+func (chatroom *ChatRoom) SendWelcomeMessage(newUser string) {
+	chatroom.Lock.Lock()
+	defer chatroom.Lock.Unlock()
+
+	var otherUsersInChatRoom []string
+	for user := range chatroom.JoinedUsers {
+		if user == newUser {
+			continue
+		}
+		otherUsersInChatRoom = append(otherUsersInChatRoom, user)
+	}
+
+	if m, ok := chatroom.JoinedUsers[newUser]; ok {
+		chatroom.send(newUser, m, NewChatMessage(fmt.Sprintf(
+			"* The room contains: %s", strings.Join(otherUsersInChatRoom, ", "))))
+	}
+}
+
+func NewChatMessage(msg string) ChatMessage {
+	if !strings.HasSuffix(msg, "\n") {
+		msg += "\n"
+	}
+	return ChatMessage([]byte(msg))
+}
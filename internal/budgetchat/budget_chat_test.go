@@ -0,0 +1,337 @@
+package budgetchat
+
+import (
+	"TDMR87/go_protohackers/internal/server"
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConnectToChatRoom(t *testing.T) {
+	listener, err := server.StartPipeListener(NewChatRoom().handle)
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, _ := listener.Dial()
+	scanner := bufio.NewScanner(conn)
+	if scanner.Scan() {
+		expectedPrompt := "Welcome to budgetchat! What shall I call you?"
+		welcomePrompt := scanner.Text()
+		if welcomePrompt != expectedPrompt {
+			t.Fatalf("Expected '%s', got '%s'", expectedPrompt, welcomePrompt)
+		}
+	}
+
+	conn.Write(NewChatMessage("Manuel\n"))
+
+	if scanner.Scan() {
+		// No other users joined, so the list must be empty
+		expectedWelcomeMessage := "* The room contains: "
+		welcomeMessage := scanner.Text()
+		if welcomeMessage != expectedWelcomeMessage {
+			t.Fatalf("Expected '%s', got '%s'", expectedWelcomeMessage, welcomeMessage)
+		}
+	}
+}
+
+func TestTooLongUsername(t *testing.T) {
+	listener, err := server.StartPipeListener(NewChatRoom().handle)
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, _ := listener.Dial()
+	scanner := bufio.NewScanner(conn)
+	if scanner.Scan() {
+		_ = scanner.Text() // Reads the username prompt
+	}
+
+	conn.Write(NewChatMessage("thisIsATooLongUsername\n"))
+
+	if scanner.Scan() {
+		errMsg := scanner.Text()
+		expectedErrMsg := "Invalid username. Usernames must be 1-16 characters long and must consist entirely of alphanumeric characters (uppercase, lowercase, and digits)"
+		if errMsg != expectedErrMsg {
+			t.Fatalf("Expected '%s', got '%s'", expectedErrMsg, errMsg)
+		}
+	}
+}
+
+func TestTooShortUsername(t *testing.T) {
+	listener, err := server.StartPipeListener(NewChatRoom().handle)
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, _ := listener.Dial()
+	scanner := bufio.NewScanner(conn)
+	if scanner.Scan() {
+		_ = scanner.Text() // Reads the username prompt
+	}
+
+	// Sends a too short name
+	conn.Write(NewChatMessage("\n"))
+
+	if scanner.Scan() {
+		errMsg := scanner.Text()
+		expectedErrMsg := "Invalid username. Usernames must be 1-16 characters long and must consist entirely of alphanumeric characters (uppercase, lowercase, and digits)"
+		if errMsg != expectedErrMsg {
+			t.Fatalf("Expected '%s', got '%s'", expectedErrMsg, errMsg)
+		}
+	}
+}
+
+func TestAsciiUsername(t *testing.T) {
+	listener, err := server.StartPipeListener(NewChatRoom().handle)
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, _ := listener.Dial()
+	scanner := bufio.NewScanner(conn)
+	if scanner.Scan() {
+		_ = scanner.Text() // Reads the username prompt
+	}
+
+	// Sends a username with prohibited characters
+	conn.Write(ChatMessage("<<special username>>\n"))
+
+	if scanner.Scan() {
+		errMsg := scanner.Text()
+		expectedErrMsg := "Invalid username. Usernames must be 1-16 characters long and must consist entirely of alphanumeric characters (uppercase, lowercase, and digits)"
+		if errMsg != expectedErrMsg {
+			t.Fatalf("Expected '%s', got '%s'", expectedErrMsg, errMsg)
+		}
+	}
+}
+
+func TestUsernamePatternCanChange(t *testing.T) {
+	Settings{UsernamePattern: regexp.MustCompile(`^[a-z]+$`)}.Apply()
+	t.Cleanup(Settings{UsernamePattern: regexp.MustCompile(DefaultUsernamePattern)}.Apply)
+
+	listener, err := server.StartPipeListener(NewChatRoom().handle)
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, _ := listener.Dial()
+	scanner := bufio.NewScanner(conn)
+	scanner.Scan() // Reads the username prompt
+	conn.Write(NewChatMessage("Alice"))
+
+	if !scanner.Scan() || scanner.Text() != "Invalid username. Usernames must match ^[a-z]+$" {
+		t.Fatalf("Expected the username to be rejected by the new pattern, got %q", scanner.Text())
+	}
+}
+
+func TestConnectToChatRoomOverTCP(t *testing.T) {
+	transports, err := server.Transports()
+	if err != nil {
+		t.Fatal("Error generating certificate:", err)
+	}
+
+	for name, transport := range transports {
+		t.Run(name, func(t *testing.T) {
+			listener, err := server.StartTLSListener("127.0.0.1:0", NewChatRoom().handle, transport.Server)
+			if err != nil {
+				t.Fatal("Error starting server:", err)
+			}
+			defer listener.Close()
+
+			conn, err := server.Dial(listener.Addr().String(), transport.Client)
+			if err != nil {
+				t.Fatal("Error connecting to server:", err)
+			}
+			defer conn.Close()
+
+			scanner := bufio.NewScanner(conn)
+			if !scanner.Scan() {
+				t.Fatal("No welcome prompt from server:", scanner.Err())
+			}
+			expectedPrompt := "Welcome to budgetchat! What shall I call you?"
+			if scanner.Text() != expectedPrompt {
+				t.Fatalf("Expected '%s', got '%s'", expectedPrompt, scanner.Text())
+			}
+
+			conn.Write(NewChatMessage("TcpUser"))
+
+			if !scanner.Scan() {
+				t.Fatal("No room listing from server:", scanner.Err())
+			}
+			if !strings.HasPrefix(scanner.Text(), "* The room contains:") {
+				t.Fatalf("Expected room listing, got '%s'", scanner.Text())
+			}
+		})
+	}
+}
+
+func TestChatUnderHostileSegmentation(t *testing.T) {
+	for name, faults := range server.HostileSegmentation() {
+		t.Run(name, func(t *testing.T) {
+			listener := server.NewPipeListener()
+			s := server.NewServer("", NewChatRoom().handle)
+			s.Listener = listener
+			s.Middleware = []server.Middleware{server.InjectFaults(faults)}
+			if _, err := s.Start(); err != nil {
+				t.Fatal("Error starting server:", err)
+			}
+			// Wait for everyone to leave the shared room before the next run.
+			defer s.Shutdown(context.Background())
+
+			alice, _ := listener.Dial()
+			defer alice.Close()
+			aliceScanner := bufio.NewScanner(alice)
+			alice.Write([]byte("alice\n"))
+			for range 2 { // Welcome prompt and room listing
+				if !aliceScanner.Scan() {
+					t.Fatal("No welcome from server:", aliceScanner.Err())
+				}
+			}
+
+			// Bob's name and first messages arrive in a single write.
+			bob, _ := listener.Dial()
+			defer bob.Close()
+			bob.Write([]byte("bob\nhello\nhow are you?\n"))
+
+			for _, expected := range []string{
+				"* bob has entered the room",
+				"[bob] hello",
+				"[bob] how are you?",
+			} {
+				if !aliceScanner.Scan() {
+					t.Fatal("No message from server:", aliceScanner.Err())
+				}
+				if aliceScanner.Text() != expected {
+					t.Fatalf("Expected '%s', got '%s'", expected, aliceScanner.Text())
+				}
+			}
+		})
+	}
+}
+
+// A user who stops reading holds up nobody else, and is dropped once they
+// fall a full outbox behind.
+func TestStalledReaderDoesNotHoldUpTheRoom(t *testing.T) {
+	room := NewChatRoom()
+	listener, err := server.StartPipeListener(room.handle)
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	// Unlike the listener's pipes, net.Pipe blocks writes until the other end
+	// reads, like a TCP connection with full buffers.
+	stalledConn, stalled := net.Pipe()
+	go room.handle(stalledConn)
+	defer stalled.Close()
+	stalledScanner := bufio.NewScanner(stalled)
+	stalledScanner.Scan() // Welcome prompt
+	stalled.Write([]byte("stalled\n"))
+	stalledScanner.Scan() // Room listing, after which it stops reading
+
+	join := func(name string) (*server.PipeConn, *bufio.Scanner) {
+		conn, _ := listener.Dial()
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		scanner := bufio.NewScanner(conn)
+		conn.Write([]byte(name + "\n"))
+		for range 2 { // Welcome prompt and room listing
+			if !scanner.Scan() {
+				t.Fatalf("%s got no welcome: %v", name, scanner.Err())
+			}
+		}
+		return conn, scanner
+	}
+	alice, _ := join("alice")
+	defer alice.Close()
+	bob, bobScanner := join("bob")
+	defer bob.Close()
+
+	// Bob reads each message before alice sends the next, so only the stalled
+	// user falls behind.
+	dropped := false
+	for i := range outboxSize + 1 {
+		alice.Write(fmt.Appendf(nil, "message %d\n", i))
+		want := fmt.Sprintf("[alice] message %d", i)
+		for {
+			bob.SetReadDeadline(time.Now().Add(2 * time.Second))
+			if !bobScanner.Scan() {
+				t.Fatalf("Expected bob to get %q, got %v", want, bobScanner.Err())
+			}
+			line := bobScanner.Text()
+			if line == "* stalled has left the room" && !dropped {
+				dropped = true
+				continue
+			}
+			if line != want {
+				t.Fatalf("Expected %q, got %q", want, line)
+			}
+			break
+		}
+	}
+	if !dropped {
+		bob.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if !bobScanner.Scan() || bobScanner.Text() != "* stalled has left the room" {
+			t.Fatalf("Expected the stalled user to be dropped, got %q (%v)", bobScanner.Text(), bobScanner.Err())
+		}
+	}
+}
+
+// A user who joins under a name already in the room takes it over, and the
+// connection that had it is closed rather than left without messages.
+func TestTakenUsernameDisconnectsTheOldUser(t *testing.T) {
+	listener, err := server.StartPipeListener(NewChatRoom().handle)
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	join := func() (*server.PipeConn, *bufio.Scanner) {
+		conn, _ := listener.Dial()
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		scanner := bufio.NewScanner(conn)
+		conn.Write([]byte("alice\n"))
+		for range 2 { // Welcome prompt and room listing
+			if !scanner.Scan() {
+				t.Fatalf("Got no welcome: %v", scanner.Err())
+			}
+		}
+		return conn, scanner
+	}
+	old, oldScanner := join()
+	defer old.Close()
+	taken, _ := join()
+	defer taken.Close()
+
+	if oldScanner.Scan() {
+		t.Fatalf("Expected the old connection to be closed, got %q", oldScanner.Text())
+	}
+	if err := oldScanner.Err(); err != nil {
+		t.Fatal("Expected the old connection to be closed, got:", err)
+	}
+}
+
+func TestCheckHealth(t *testing.T) {
+	listener, err := server.StartPipeListener(NewChatRoom().handle)
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, _ := listener.Dial()
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if err := CheckHealth(conn); err != nil {
+		t.Fatal("Expected the service to be healthy:", err)
+	}
+}
@@ -0,0 +1,21 @@
+package budgetchat
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// CheckHealth checks that the service on the other end of conn welcomes new
+// clients. It leaves before giving a name, so nobody in the room notices.
+func CheckHealth(conn net.Conn) error {
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("reading welcome message: %w", err)
+	}
+	if !strings.HasPrefix(line, "Welcome") {
+		return fmt.Errorf("expected a welcome message, got %q", line)
+	}
+	return nil
+}
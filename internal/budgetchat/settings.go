@@ -0,0 +1,46 @@
+package budgetchat
+
+import (
+	"TDMR87/go_protohackers/internal/server"
+	"regexp"
+	"sync/atomic"
+)
+
+// DefaultUsernamePattern allows the names the Protohackers tests expect: 1
+// to 16 letters and digits.
+const DefaultUsernamePattern = `^[A-Za-z0-9]{1,16}$`
+
+// Settings are the rules of every chat room in the process, which can be
+// changed while they run.
+type Settings struct {
+	// UsernamePattern is what the names of joining users must match.
+	UsernamePattern *regexp.Regexp
+}
+
+var settings atomic.Pointer[Settings]
+
+func init() {
+	settings.Store(&Settings{UsernamePattern: regexp.MustCompile(DefaultUsernamePattern)})
+}
+
+// AddFlags registers the flags that set s, starting from the defaults.
+func (s *Settings) AddFlags(f *server.Flags) {
+	s.UsernamePattern = regexp.MustCompile(DefaultUsernamePattern)
+	f.Text(s.UsernamePattern, "username-pattern", "regular `expression` the names of joining chat users must match")
+	f.Live("username-pattern")
+}
+
+// Apply makes s the rules of every chat room, for users who join from then
+// on.
+func (s Settings) Apply() {
+	settings.Store(&s)
+}
+
+// invalidUsernameMessage explains the username rules to a rejected user.
+func (s *Settings) invalidUsernameMessage() ChatMessage {
+	if s.UsernamePattern.String() == DefaultUsernamePattern {
+		return NewChatMessage("Invalid username. Usernames must be 1-16 characters long " +
+			"and must consist entirely of alphanumeric characters (uppercase, lowercase, and digits)")
+	}
+	return NewChatMessage("Invalid username. Usernames must match " + s.UsernamePattern.String())
+}
@@ -0,0 +1,38 @@
+package meanstoanend
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+)
+
+// CheckHealth inserts two prices in the session on the other end of conn and
+// checks that it reports their mean.
+func CheckHealth(conn net.Conn) error {
+	var messages []byte
+	for _, msg := range []struct {
+		kind byte
+		a, b int32
+	}{
+		{'I', 1, 100},
+		{'I', 2, 102},
+		{'Q', 1, 2},
+	} {
+		messages = append(messages, msg.kind)
+		messages = binary.BigEndian.AppendUint32(messages, uint32(msg.a))
+		messages = binary.BigEndian.AppendUint32(messages, uint32(msg.b))
+	}
+	if _, err := conn.Write(messages); err != nil {
+		return err
+	}
+
+	result := make([]byte, 4)
+	if _, err := io.ReadFull(conn, result); err != nil {
+		return fmt.Errorf("reading query result: %w", err)
+	}
+	if mean := int32(binary.BigEndian.Uint32(result)); mean != 101 {
+		return fmt.Errorf("expected a mean of 101, got %d", mean)
+	}
+	return nil
+}
@@ -1,24 +1,35 @@
-package main
+// Package meanstoanend implements Protohackers problem 2, Means to an End: a
+// binary protocol for inserting timestamped prices and querying their mean.
+package meanstoanend
 
 import (
 	"TDMR87/go_protohackers/internal/server"
 	"bufio"
 	"encoding/binary"
 	"net"
-
-	"github.com/google/uuid"
+	"time"
 )
 
-func main() {
-	server.StartTcpListener(":8080", handle)
-	select {}
+// NewServer returns a server for the service on addr, configured the way it
+// is deployed.
+func NewServer(addr string) *server.Server {
+	srv := server.NewServer(addr, handle)
+	srv.Name = "means_to_an_end"
+	srv.Middleware = []server.Middleware{server.AccessLog()}
+	srv.HandshakeTimeout = 10 * time.Second
+	srv.IdleTimeout = time.Minute
+	srv.WriteTimeout = 10 * time.Second
+	return srv
 }
 
-var sessionData = SessionData{}
+var (
+	insertsTotal = server.NewCounter("means_to_an_end_inserts_total", "Prices inserted.")
+	queriesTotal = server.NewCounter("means_to_an_end_queries_total", "Mean price queries answered.")
+)
 
 func handle(conn net.Conn) {
 	defer conn.Close()
-	sessionId := SessionId(uuid.New())
+	var session Session
 	scanner := bufio.NewScanner(conn)
 	scanner.Split(messageSplitter)
 
@@ -26,11 +37,14 @@ func handle(conn net.Conn) {
 		bytes := []byte(scanner.Bytes())
 		switch bytes[0] {
 		case 'I':
-			handleInsert(InsertMessage(bytes), sessionId)
+			session.Insert(InsertMessage(bytes))
+			insertsTotal.Inc()
 		case 'Q':
-			queryResult := handleQuery(QueryMessage(bytes), sessionId)
+			queryResult := session.Query(QueryMessage(bytes))
 			conn.Write(queryResult)
+			queriesTotal.Inc()
 		default:
+			server.Logger(conn).Warn("Malformed message", "type", bytes[0])
 			conn.Write([]byte("malformed"))
 			conn.Close()
 			return
@@ -40,23 +54,28 @@ func handle(conn net.Conn) {
 
 type QueryMessage []byte
 type InsertMessage []byte
-type SessionId uuid.UUID
-type SessionData map[SessionId][]Price
+
+// Session holds the prices inserted by one client, which only that client
+// can query.
+type Session struct {
+	Prices []Price
+}
+
 type Price struct {
 	Timestamp int32
 	Price     int32
 }
 
-func handleInsert(msg InsertMessage, sessionId SessionId) {
-	sessionData[sessionId] = append(sessionData[sessionId], Price{
+func (s *Session) Insert(msg InsertMessage) {
+	s.Prices = append(s.Prices, Price{
 		msg.timestamp(),
 		msg.price(),
 	})
 }
 
-func handleQuery(msg QueryMessage, sessionId SessionId) (queryResult []byte) {
+func (s *Session) Query(msg QueryMessage) (queryResult []byte) {
 	var prices []Price
-	for _, price := range sessionData[sessionId] {
+	for _, price := range s.Prices {
 		if price.Timestamp >= msg.minTime() && price.Timestamp <= msg.maxTime() {
 			prices = append(prices, price)
 		}
@@ -1,28 +1,25 @@
-package main
+package meanstoanend
 
 import (
 	"TDMR87/go_protohackers/internal/server"
 	"encoding/binary"
-	"net"
+	"io"
 	"testing"
-
-	"github.com/google/uuid"
+	"time"
 )
 
 func TestInsertData(t *testing.T) {
-	if len(sessionData) != 0 {
-		t.Fatal("Data already exists")
-	}
-	handleInsert(makeMessage('I', 1100, 100), SessionId(uuid.New()))
-	if len(sessionData) != 1 {
+	var session Session
+	session.Insert(makeMessage('I', 1100, 100))
+	if len(session.Prices) != 1 {
 		t.Fatal("Inserting data failed")
 	}
 }
 
 func TestQueryData(t *testing.T) {
-	sessionId := SessionId(uuid.New())
-	handleInsert(makeMessage('I', 1000, 100), sessionId)
-	resultBytes := handleQuery(makeMessage('Q', 999, 1001), sessionId)
+	var session Session
+	session.Insert(makeMessage('I', 1000, 100))
+	resultBytes := session.Query(makeMessage('Q', 999, 1001))
 	resultVal := int32(binary.BigEndian.Uint32(resultBytes))
 	if resultVal != 100 {
 		t.Fatalf("Query failed. Expected %v, got %v", 100, resultVal)
@@ -108,43 +105,52 @@ func TestServer(t *testing.T) {
 		},
 	}
 
-	listener, err := server.StartTcpListener(":0", handle)
+	transports, err := server.Transports()
 	if err != nil {
-		t.Fatal("Error starting server:", err)
+		t.Fatal("Error generating certificate:", err)
 	}
-	defer listener.Close()
 
-	for name, tt := range testCases {
-		t.Run(name, func(t *testing.T) {
-			conn, err := net.Dial("tcp", listener.Addr().String())
+	for transportName, transport := range transports {
+		t.Run(transportName, func(t *testing.T) {
+			listener, err := server.StartTLSListener(":0", handle, transport.Server)
 			if err != nil {
-				t.Fatal("Error connecting to server:", err)
+				t.Fatal("Error starting server:", err)
 			}
-			defer conn.Close()
+			defer listener.Close()
 
-			// Insert data
-			for _, msg := range tt.InsertMessages {
-				conn.Write(msg)
-			}
-			
-			if tt.ExpectToFail {
-				buf := make([]byte, 1024)
-				n, _ :=conn.Read(buf)
-				errorMsg := string(buf[:n])
-				if errorMsg != "malformed" {
-					t.Fatalf("Test '%s' failed. Expected error response 'malformed', got '%s'", name, errorMsg)
-				}
-			}
+			for name, tt := range testCases {
+				t.Run(name, func(t *testing.T) {
+					conn, err := server.Dial(listener.Addr().String(), transport.Client)
+					if err != nil {
+						t.Fatal("Error connecting to server:", err)
+					}
+					defer conn.Close()
 
-			// Query data
-			conn.Write(tt.QueryMessage)
+					// Insert data
+					for _, msg := range tt.InsertMessages {
+						conn.Write(msg)
+					}
+					
+					if tt.ExpectToFail {
+						buf := make([]byte, 1024)
+						n, _ :=conn.Read(buf)
+						errorMsg := string(buf[:n])
+						if errorMsg != "malformed" {
+							t.Fatalf("Test '%s' failed. Expected error response 'malformed', got '%s'", name, errorMsg)
+						}
+					}
 
-			// Assert the result of the query
-			buf := make([]byte, 8) // Result must be int32
-			conn.Read(buf)
-			result := int32(binary.BigEndian.Uint32(buf))
-			if result != tt.ExpectedResult {
-				t.Fatalf("Test '%s' failed. Invalid query result. Expected %v, got %v", name, tt.ExpectedResult, result)
+					// Query data
+					conn.Write(tt.QueryMessage)
+
+					// Assert the result of the query
+					buf := make([]byte, 8) // Result must be int32
+					conn.Read(buf)
+					result := int32(binary.BigEndian.Uint32(buf))
+					if result != tt.ExpectedResult {
+						t.Fatalf("Test '%s' failed. Invalid query result. Expected %v, got %v", name, tt.ExpectedResult, result)
+					}
+				})
 			}
 		})
 	}
@@ -156,4 +162,52 @@ func makeMessage(firstByte byte, firstInt, secondInt int32) []byte {
 	binary.BigEndian.PutUint32(msg[1:5], uint32(firstInt))
 	binary.BigEndian.PutUint32(msg[5:9], uint32(secondInt))
 	return msg
-}
\ No newline at end of file
+}
+func TestServerUnderHostileSegmentation(t *testing.T) {
+	for name, faults := range server.HostileSegmentation() {
+		t.Run(name, func(t *testing.T) {
+			listener, err := server.StartPipeListener(handle, server.InjectFaults(faults))
+			if err != nil {
+				t.Fatal("Error starting server:", err)
+			}
+			defer listener.Close()
+
+			conn, _ := listener.Dial()
+			defer conn.Close()
+
+			// All messages in a single write, so that the server has to split
+			// them into 9-byte messages itself.
+			var stream []byte
+			stream = append(stream, makeMessage('I', 12345, 101)...)
+			stream = append(stream, makeMessage('I', 12346, 102)...)
+			stream = append(stream, makeMessage('I', 12347, 100)...)
+			stream = append(stream, makeMessage('I', 40960, 5)...)
+			stream = append(stream, makeMessage('Q', 12288, 16384)...)
+			conn.Write(stream)
+
+			buf := make([]byte, 4)
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				t.Fatal("Expected a query result:", err)
+			}
+			if result := int32(binary.BigEndian.Uint32(buf)); result != 101 {
+				t.Fatalf("Invalid query result. Expected %v, got %v", 101, result)
+			}
+		})
+	}
+}
+
+func TestCheckHealth(t *testing.T) {
+	listener, err := server.StartPipeListener(handle)
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, _ := listener.Dial()
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if err := CheckHealth(conn); err != nil {
+		t.Fatal("Expected the service to be healthy:", err)
+	}
+}
@@ -0,0 +1,12 @@
+package mobinthemiddle
+
+import "net"
+
+// CheckHealth checks the proxy's own listener, which has accepted conn by
+// the time the check runs, so there is nothing more to exchange. Whether the
+// upstream chat server can be reached is left out: restarting the proxy
+// wouldn't bring it back, so the proxy logs every failed attempt and counts
+// it in mob_in_the_middle_upstream_errors_total instead.
+func CheckHealth(conn net.Conn) error {
+	return nil
+}
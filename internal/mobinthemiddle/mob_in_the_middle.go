@@ -0,0 +1,107 @@
+// Package mobinthemiddle implements Protohackers problem 5, Mob in the
+// Middle: a proxy to the Budget Chat server that rewrites Boguscoin addresses.
+package mobinthemiddle
+
+import (
+	"TDMR87/go_protohackers/internal/server"
+	"bufio"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dlclark/regexp2"
+)
+
+// DefaultUpstream is the Budget Chat server the Protohackers tests expect the
+// proxy to use.
+const DefaultUpstream = "chat.protohackers.com:16963"
+
+var tonysBogusCoinAddr = "7YWHMfk9JZe0LM0g1ZauHuiSxhI"
+var rewritesTotal = server.NewCounter("mob_in_the_middle_rewrites_total", "Messages in which a Boguscoin address was rewritten.")
+var upstreamErrorsTotal = server.NewCounter("mob_in_the_middle_upstream_errors_total", "Clients that could not be relayed because the upstream chat server was unreachable.")
+var bogusCoinRegex = regexp2.MustCompile(`(?<!\S)7[a-zA-Z0-9]{25,34}(?!\S)`, 0)
+
+func init() {
+	bogusCoinRegex.MatchTimeout = time.Second * 5
+}
+
+// NewServer returns a server for the service on addr that proxies to the
+// Budget Chat server at upstream, configured the way it is deployed.
+func NewServer(addr, upstream string) *server.Server {
+	srv := server.NewServer(addr, proxyTo(upstream))
+	srv.Name = "mob_in_the_middle"
+	srv.Middleware = []server.Middleware{server.AccessLog()}
+	srv.HandshakeTimeout = 30 * time.Second
+	srv.IdleTimeout = 30 * time.Minute
+	srv.WriteTimeout = 10 * time.Second
+	return srv
+}
+
+// proxyTo returns a handler that relays each client to upstream.
+func proxyTo(upstream string) server.Handler {
+	return func(clientConn net.Conn) {
+		proxy(clientConn, upstream)
+	}
+}
+
+func proxy(clientConn net.Conn, upstream string) {
+	defer clientConn.Close()
+	logger := server.Logger(clientConn)
+
+	upstreamConn, err := net.Dial("tcp", upstream)
+	if err != nil {
+		logger.Error("Error connecting to upstream chat server", "upstream", upstream, "err", err)
+		upstreamErrorsTotal.Inc()
+		return
+	}
+	defer upstreamConn.Close()
+
+	clientReader := bufio.NewReader(clientConn)
+	upstreamReader := bufio.NewReader(upstreamConn)
+
+	var wg sync.WaitGroup
+
+	wg.Go(func() {
+		for {
+			msg, err := clientReader.ReadString('\n')
+			if err != nil {
+				break
+			} // EOF or error, discard partial lines
+			msg = rewrite(logger.With("direction", "client->upstream"), msg)
+			upstreamConn.Write([]byte(msg))
+		}
+		upstreamConn.Close()
+	})
+
+	wg.Go(func() {
+		for {
+			msg, err := upstreamReader.ReadString('\n')
+			if err != nil {
+				break
+			} // EOF or error, discard partial lines
+			msg = rewrite(logger.With("direction", "upstream->client"), msg)
+			clientConn.Write([]byte(msg))
+		}
+		clientConn.Close()
+	})
+
+	wg.Wait()
+}
+
+// rewrite replaces every Boguscoin address in msg with the rewrite target,
+// Tony's unless configured otherwise.
+func rewrite(logger *slog.Logger, msg string) string {
+	rewritten, err := bogusCoinRegex.Replace(msg, settings.Load().Target, -1, -1)
+	if err != nil {
+		logger.Error("Error rewriting message", "err", err)
+		return msg
+	}
+	if rewritten != msg {
+		// Chat messages are private, so their bodies stay out of the logs
+		// unless debugging.
+		logger.Debug("Rewrote Boguscoin address", "original", msg, "rewritten", rewritten)
+		rewritesTotal.Inc()
+	}
+	return rewritten
+}
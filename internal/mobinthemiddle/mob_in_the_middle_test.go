@@ -0,0 +1,171 @@
+package mobinthemiddle
+
+import (
+	"TDMR87/go_protohackers/internal/server"
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRegex(t *testing.T) {
+	testCases := map[string]struct {
+		input   string
+		shouldMatch bool
+	}{
+		"test case 0": {
+			input: tonysBogusCoinAddr,
+			shouldMatch: true,
+		},
+		"test case 1": {
+			input: "  7F1u3wSD5RbOHQmupo9nx4TsnQ  ",
+			shouldMatch: true,
+		},
+		"test case 2": {
+			input: "7wertyui9gJZe0LM0g1gdfgdfgZauHuiShI",
+			shouldMatch: true,
+		},
+		"test case 3": {
+			input: "7iKDZEwPZSqIvDnHvVN2r0hUWXD5rHX sdfdsf",
+			shouldMatch: true,
+		},
+		"test case 4": {
+			input: "weqwe234 7LOrwbDlS8NujgjddyogWgIM93MV5N2VR 42342",
+			shouldMatch: true,
+		},
+		"test case 5": {
+			input: "too short 7wertyui9JZe0LM0g1ZauHui",
+			shouldMatch: false,
+		},
+		"test case 6": {
+			input: "too long 7wertyui9JZe0LM0g1ZauHuifgfdgdg4dssf",
+			shouldMatch: false,
+		},
+		"test case 7": {
+			input: "7vi9jJ8u5Av1WxgLvdMDSzES8KsYc7-EoQVwDjwjb4X1cnx6YaVgCv2hiLykCQ-1234",
+			shouldMatch: false,
+		},
+	}
+
+	for name, tt := range testCases {
+		isMatch, _ := bogusCoinRegex.MatchString(tt.input)
+		if tt.shouldMatch != isMatch {
+			t.Fatalf("%s : ShouldMatch '%v' but IsMatch '%v'", name, tt.shouldMatch, isMatch)
+		}
+	}
+}
+
+func TestBadNameClient(t *testing.T) {
+	listener, err := server.StartTcpListener(":0", proxyTo(DefaultUpstream))
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	// Connect as User1
+	conn1, _ := net.Dial("tcp", listener.Addr().String())
+	scanner1 := bufio.NewScanner(conn1)
+	if scanner1.Scan() {}
+	conn1.Write([]byte("User1\n"))
+	if scanner1.Scan() {}
+
+	// Connect as User2
+	conn2, _ := net.Dial("tcp", listener.Addr().String())
+	scanner2 := bufio.NewScanner(conn2)
+	if scanner2.Scan() {}
+
+	// Disconnect User2 before sending newline delimiter
+	conn2.Write([]byte("User2"))
+	conn2.Close()
+
+	// User1 should not see User2 join
+	done := make(chan struct{})
+	go func() {
+		if scanner1.Scan() {
+			line := scanner1.Text()
+			if line == "* User2 has joined the room" {
+				t.Errorf("User1 received unexpected message: %s", line)
+			}
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+	}
+}
+func TestProxyUnderHostileSegmentation(t *testing.T) {
+	for name, faults := range server.HostileSegmentation() {
+		t.Run(name, func(t *testing.T) {
+			// A stand-in for the chat server that echoes every line, as
+			// hostile towards the proxy as the client side is.
+			upstream := server.NewServer("127.0.0.1:0", func(conn net.Conn) {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					conn.Write([]byte(scanner.Text() + "\n"))
+				}
+			})
+			upstream.Middleware = []server.Middleware{server.InjectFaults(faults)}
+			upstreamListener, err := upstream.Start()
+			if err != nil {
+				t.Fatal("Error starting upstream:", err)
+			}
+			defer upstreamListener.Close()
+
+			listener, err := server.StartPipeListener(proxyTo(upstreamListener.Addr().String()), server.InjectFaults(faults))
+			if err != nil {
+				t.Fatal("Error starting server:", err)
+			}
+			defer listener.Close()
+
+			conn, _ := listener.Dial()
+			defer conn.Close()
+			conn.Write([]byte("Hi, send to 7iKDZEwPZSqIvDnHvVN2r0hUWXD5rHX\nthanks\n"))
+
+			scanner := bufio.NewScanner(conn)
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			for _, expected := range []string{
+				"Hi, send to " + tonysBogusCoinAddr,
+				"thanks",
+			} {
+				if !scanner.Scan() {
+					t.Fatal("No message from proxy:", scanner.Err())
+				}
+				if scanner.Text() != expected {
+					t.Fatalf("Expected %q, got %q", expected, scanner.Text())
+				}
+			}
+		})
+	}
+}
+
+// The proxy is healthy as long as it accepts connections, with the upstream
+// chat server down or not, which it counts instead.
+func TestCheckHealthIgnoresUpstream(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error reserving an upstream address:", err)
+	}
+	upstream.Close() // Nothing listens there any more
+
+	srv := NewServer("127.0.0.1:0", upstream.Addr().String())
+	listener, err := srv.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer srv.Shutdown(context.Background())
+
+	before := upstreamErrorsTotal.Value()
+	var config server.Config
+	if err := config.CheckHealth(listener.Addr().String(), CheckHealth); err != nil {
+		t.Fatal("Expected the proxy to be healthy without its upstream:", err)
+	}
+	for deadline := time.Now().Add(time.Second); upstreamErrorsTotal.Value() == before; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the unreachable upstream to be counted")
+		}
+	}
+}
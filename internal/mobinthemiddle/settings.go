@@ -0,0 +1,42 @@
+package mobinthemiddle
+
+import (
+	"TDMR87/go_protohackers/internal/server"
+	"fmt"
+	"regexp"
+	"sync/atomic"
+)
+
+// Settings are the behaviour of every proxy in the process, which can be
+// changed while they run.
+type Settings struct {
+	// Target is the Boguscoin address that every address in a message is
+	// rewritten to.
+	Target string
+}
+
+var settings atomic.Pointer[Settings]
+
+func init() {
+	settings.Store(&Settings{Target: tonysBogusCoinAddr})
+}
+
+var boguscoinAddress = regexp.MustCompile(`^7[a-zA-Z0-9]{25,34}$`)
+
+// AddFlags registers the flags that set s, starting from the defaults.
+func (s *Settings) AddFlags(f *server.Flags) {
+	f.String(&s.Target, "rewrite-target", tonysBogusCoinAddr, "Boguscoin `address` to rewrite every address in a message to")
+	f.Live("rewrite-target")
+	f.Check(func() error {
+		if !boguscoinAddress.MatchString(s.Target) {
+			return fmt.Errorf("rewrite target %q is not a Boguscoin address", s.Target)
+		}
+		return nil
+	})
+}
+
+// Apply makes s the behaviour of every proxy, for messages relayed from
+// then on.
+func (s Settings) Apply() {
+	settings.Store(&s)
+}
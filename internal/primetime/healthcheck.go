@@ -0,0 +1,28 @@
+package primetime
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+)
+
+// CheckHealth checks that the service on the other end of conn tells that 7
+// is prime.
+func CheckHealth(conn net.Conn) error {
+	if _, err := conn.Write([]byte(`{"method":"isPrime","number":7}` + "\n")); err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+	var response Response
+	if err := json.Unmarshal(line, &response); err != nil {
+		return fmt.Errorf("malformed response %q: %w", line, err)
+	}
+	if response.Method != "isPrime" || !response.Prime {
+		return fmt.Errorf("expected 7 to be prime, got %q", line)
+	}
+	return nil
+}
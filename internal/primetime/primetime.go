@@ -1,16 +1,23 @@
-package main
+// Package primetime implements Protohackers problem 1, Prime Time: a
+// line-delimited JSON service that tells whether numbers are prime.
+package primetime
 
 import (
 	"TDMR87/go_protohackers/internal/server"
 	"bufio"
 	"encoding/json"
-	"log"
 	"math"
 	"net"
+	"time"
+)
+
+var (
+	requestsTotal  = server.NewCounter("primetime_requests_total", "isPrime requests answered.")
+	malformedTotal = server.NewCounter("primetime_malformed_requests_total", "Malformed requests received.")
 )
 
 type Request struct {
-	Method string  `json:"method"`
+	Method string   `json:"method"`
 	Number *float64 `json:"number"`
 }
 
@@ -19,22 +26,31 @@ type Response struct {
 	Prime  bool   `json:"prime"`
 }
 
-func main() {
-	server.StartTcpListener(":8080", handle)
-	select {}
+// NewServer returns a server for the service on addr, configured the way it
+// is deployed.
+func NewServer(addr string) *server.Server {
+	srv := server.NewServer(addr, handle)
+	srv.Name = "primetime"
+	srv.Middleware = []server.Middleware{server.AccessLog()}
+	srv.HandshakeTimeout = 10 * time.Second
+	srv.IdleTimeout = time.Minute
+	srv.WriteTimeout = 10 * time.Second
+	return srv
 }
 
 func handle(conn net.Conn) {
 	defer conn.Close()
 
 	scanner := bufio.NewScanner(conn)
-	
+	logger := server.Logger(conn)
+
 	for scanner.Scan() {
 		var req Request
 		err := json.Unmarshal([]byte(scanner.Text()), &req)
 
 		if err != nil || req.Method != "isPrime" || req.Number == nil {
-			log.Println("Malformed request:", scanner.Text())
+			logger.Warn("Malformed request", "request", scanner.Text())
+			malformedTotal.Inc()
 			conn.Write([]byte("malformed\n"))
 			conn.Close()
 			return
@@ -45,6 +61,7 @@ func handle(conn net.Conn) {
 			Prime:  isPrime(*req.Number)})
 
 		conn.Write(append(response, '\n'))
+		requestsTotal.Inc()
 	}
 }
 
@@ -66,16 +83,16 @@ func isPrime(num float64) bool {
 	}
 
 	// Start from 3 up until the square root of n.
-	// If we haven’t found a divisor by the time we've checked up to square root of n, 
+	// If we haven’t found a divisor by the time we've checked up to square root of n,
 	// there can’t be a prime beyond that.
 	// Also, increment by 2 to skip even numbers.
 	for i := 3; i*i <= n; i += 2 {
 		if n%i == 0 {
 			// Found a divisor, not prime
-			return false 
+			return false
 		}
 	}
 
 	// No divisors found, is prime
-	return true 
+	return true
 }
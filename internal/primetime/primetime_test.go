@@ -0,0 +1,130 @@
+package primetime
+
+import (
+	"TDMR87/go_protohackers/internal/server"
+	"bufio"
+	"testing"
+	"time"
+)
+
+	func TestServer(t *testing.T) {
+		var testCases = map[string]struct {
+			request  string
+			response string
+		}{
+			"prime number": {
+				request:  `{"method":"isPrime","number":7}`,
+				response: `{"method":"isPrime","prime":true}`,
+			},
+			"non-prime number": {
+				request:  `{"method":"isPrime","number":6}`,
+				response: `{"method":"isPrime","prime":false}`,
+			},
+			"zero number": {
+				request:  `{"method":"isPrime","number":0}`,
+				response: `{"method":"isPrime","prime":false}`,
+			},
+			"negative number": {
+				request:  `{"method":"isPrime","number":-999}`,
+				response: `{"method":"isPrime","prime":false}`,
+			},
+			"number as string": {
+				request:  `{"method":"isPrime","number":"10"}`,
+				response: `malformed`,
+			},
+			"missing number property": {
+				request:  `{"method":"isPrime"}`,
+				response: `malformed`,
+			},
+			"missing method property": {
+				request:  `{"number":10}`,
+				response: `malformed`,
+			},
+			"wrong method": {
+				request:  `{"method":"isEven","number":10}`,
+				response: `malformed`,
+			},
+		}
+
+		transports, err := server.Transports()
+		if err != nil {
+			t.Fatal("Error generating certificate:", err)
+		}
+
+		for transportName, transport := range transports {
+			t.Run(transportName, func(t *testing.T) {
+				listener, err := server.StartTLSListener(":0", handle, transport.Server)
+				if err != nil {
+					t.Fatal("Error starting server:", err)
+				}
+				defer listener.Close()
+
+				for _, tt := range testCases {
+					conn, err := server.Dial(listener.Addr().String(), transport.Client)
+					if err != nil {
+						t.Fatal("Error connecting to server:", err)
+					}
+					defer conn.Close()
+
+					conn.Write([]byte(tt.request + "\n"))
+
+					scanner := bufio.NewScanner(conn)
+					if !scanner.Scan() {
+						t.Fatal("No response from server")
+					}
+					if scanner.Text() != tt.response {
+						t.Errorf("Expected response %q, got %q", tt.response, scanner.Text())
+					}
+				}
+			})
+		}
+	}
+func TestServerUnderHostileSegmentation(t *testing.T) {
+	for name, faults := range server.HostileSegmentation() {
+		t.Run(name, func(t *testing.T) {
+			listener, err := server.StartPipeListener(handle, server.InjectFaults(faults))
+			if err != nil {
+				t.Fatal("Error starting server:", err)
+			}
+			defer listener.Close()
+
+			conn, _ := listener.Dial()
+			defer conn.Close()
+
+			// Several requests in a single write, so that the server has to
+			// split them into lines itself.
+			conn.Write([]byte(`{"method":"isPrime","number":7}` + "\n" +
+				`{"method":"isPrime","number":8}` + "\n" +
+				`{"method":"isPrime","number":9973}` + "\n"))
+
+			scanner := bufio.NewScanner(conn)
+			for _, expected := range []string{
+				`{"method":"isPrime","prime":true}`,
+				`{"method":"isPrime","prime":false}`,
+				`{"method":"isPrime","prime":true}`,
+			} {
+				if !scanner.Scan() {
+					t.Fatal("No response from server:", scanner.Err())
+				}
+				if scanner.Text() != expected {
+					t.Fatalf("Expected response %q, got %q", expected, scanner.Text())
+				}
+			}
+		})
+	}
+}
+
+func TestCheckHealth(t *testing.T) {
+	listener, err := server.StartPipeListener(handle)
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, _ := listener.Dial()
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if err := CheckHealth(conn); err != nil {
+		t.Fatal("Expected the service to be healthy:", err)
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// listenFdsStart is the first file descriptor passed by a socket-activating
+// supervisor such as systemd. See sd_listen_fds(3).
+const listenFdsStart = 3
+
+// activatedSocket is a socket the process inherited instead of binding it.
+// Exactly one of listener and packetConn is set.
+type activatedSocket struct {
+	name       string
+	listener   net.Listener
+	packetConn net.PacketConn
+	claimed    bool
+}
+
+// activatedSockets are handed out to servers as they start listening.
+type activatedSockets struct {
+	mu      sync.Mutex
+	sockets []*activatedSocket
+
+	// ready, if set, is closed once the first socket has been claimed, to
+	// tell the process that handed the sockets over that we are serving.
+	ready *os.File
+}
+
+// activation returns the sockets passed via LISTEN_FDS, read once per
+// process. The variables are unset afterwards so that child processes don't
+// mistake the sockets for their own.
+var activation = sync.OnceValue(func() *activatedSockets {
+	fds, names, err := listenFds(os.Getenv, os.Getpid(), os.Getppid())
+	ready := handoffReadyFile(os.Getenv)
+	for _, key := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES", handoffParentEnv, handoffReadyEnv} {
+		os.Unsetenv(key)
+	}
+	if err != nil {
+		slog.Error("Ignoring socket-activated listeners", "err", err)
+		return &activatedSockets{}
+	}
+	files := make([]*os.File, len(fds))
+	for i, fd := range fds {
+		files[i] = os.NewFile(uintptr(fd), "LISTEN_FDS")
+	}
+	sockets := adoptFiles(files, names)
+	sockets.ready = ready
+	return sockets
+})
+
+// listenFds interprets the LISTEN_PID, LISTEN_FDS and LISTEN_FDNAMES
+// variables for the process with the given pid and parent pid. Sockets
+// handed over by Handoff are addressed to the parent's child instead, since
+// the parent can't know the child's pid before starting it.
+func listenFds(getenv func(string) string, pid, ppid int) ([]int, []string, error) {
+	switch {
+	case getenv("LISTEN_PID") != "":
+		if listenPid, err := strconv.Atoi(getenv("LISTEN_PID")); err != nil || listenPid != pid {
+			return nil, nil, nil // Meant for another process
+		}
+	case getenv(handoffParentEnv) != "":
+		if parentPid, err := strconv.Atoi(getenv(handoffParentEnv)); err != nil || parentPid != ppid {
+			return nil, nil, nil
+		}
+	default:
+		return nil, nil, nil
+	}
+
+	count, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || count < 0 {
+		return nil, nil, fmt.Errorf("invalid LISTEN_FDS %q", getenv("LISTEN_FDS"))
+	}
+
+	var names []string
+	if fdNames := getenv("LISTEN_FDNAMES"); fdNames != "" {
+		names = strings.Split(fdNames, ":")
+	}
+
+	fds := make([]int, count)
+	for i := range fds {
+		fds[i] = listenFdsStart + i
+	}
+	return fds, names, nil
+}
+
+// adoptFiles turns inherited files into listeners or packet conns depending
+// on their socket type, and closes the originals.
+func adoptFiles(files []*os.File, names []string) *activatedSockets {
+	a := &activatedSockets{}
+	for i, f := range files {
+		socket := &activatedSocket{}
+		if i < len(names) {
+			socket.name = names[i]
+		}
+
+		fd := f.Fd()
+		var err error
+		if socket.listener, err = net.FileListener(f); err != nil {
+			socket.listener = nil
+			socket.packetConn, err = net.FilePacketConn(f)
+		}
+		f.Close() // The net package works on its own duplicate
+		if err != nil {
+			slog.Error("Ignoring unusable socket-activated file descriptor", "fd", fd, "name", socket.name, "err", err)
+			continue
+		}
+		a.sockets = append(a.sockets, socket)
+	}
+	return a
+}
+
+// listener hands out an inherited stream socket, preferring one named after
+// the service. It returns nil if there is none left.
+func (a *activatedSockets) listener(name string) net.Listener {
+	if socket := a.claim(name, func(s *activatedSocket) bool { return s.listener != nil }); socket != nil {
+		return socket.listener
+	}
+	return nil
+}
+
+// udpConn is like listener, but for UDP sockets.
+func (a *activatedSockets) udpConn(name string) *net.UDPConn {
+	isUdp := func(s *activatedSocket) bool {
+		_, ok := s.packetConn.(*net.UDPConn)
+		return ok
+	}
+	if socket := a.claim(name, isUdp); socket != nil {
+		return socket.packetConn.(*net.UDPConn)
+	}
+	return nil
+}
+
+func (a *activatedSockets) claim(name string, usable func(*activatedSocket) bool) *activatedSocket {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var fallback *activatedSocket
+	for _, socket := range a.sockets {
+		if socket.claimed || !usable(socket) {
+			continue
+		}
+		if name != "" && socket.name == name {
+			socket.claimed = true
+			a.signalReady()
+			return socket
+		}
+		if fallback == nil {
+			fallback = socket
+		}
+	}
+	if fallback != nil {
+		fallback.claimed = true
+		a.signalReady()
+	}
+	return fallback
+}
+
+func (a *activatedSockets) signalReady() {
+	if a.ready != nil {
+		a.ready.Write([]byte{1})
+		a.ready.Close()
+		a.ready = nil
+	}
+}
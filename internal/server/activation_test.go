@@ -0,0 +1,174 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestListenFds(t *testing.T) {
+	env := map[string]string{
+		"LISTEN_PID":     "42",
+		"LISTEN_FDS":     "2",
+		"LISTEN_FDNAMES": "smoketest:primetime",
+	}
+	fds, names, err := listenFds(func(key string) string { return env[key] }, 42, 1)
+	if err != nil || !slices.Equal(fds, []int{3, 4}) || !slices.Equal(names, []string{"smoketest", "primetime"}) {
+		t.Fatalf("Unexpected result %v %v (%v)", fds, names, err)
+	}
+
+	if fds, _, err := listenFds(func(key string) string { return env[key] }, 43, 1); err != nil || fds != nil {
+		t.Fatalf("Expected sockets meant for another process to be ignored, got %v (%v)", fds, err)
+	}
+
+	// Sockets handed off by a parent process are addressed by its pid
+	delete(env, "LISTEN_PID")
+	env[handoffParentEnv] = "1"
+	if fds, _, err := listenFds(func(key string) string { return env[key] }, 42, 1); err != nil || len(fds) != 2 {
+		t.Fatalf("Expected the sockets handed off by the parent, got %v (%v)", fds, err)
+	}
+
+	env["LISTEN_FDS"] = "many"
+	if _, _, err := listenFds(func(key string) string { return env[key] }, 42, 1); err == nil {
+		t.Fatal("Expected an error for an invalid LISTEN_FDS")
+	}
+}
+
+func TestAdoptFiles(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+
+	var files []*os.File
+	for _, f := range []interface{ File() (*os.File, error) }{tcp.(*net.TCPListener), tcp.(*net.TCPListener), udp} {
+		file, err := f.File()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	sockets := adoptFiles(files, []string{"first", "second", "udp"})
+
+	// The named socket is preferred, then the first one left
+	if l := sockets.listener("second"); l == nil || sockets.sockets[1].listener != l {
+		t.Fatal("Expected the socket named after the service")
+	}
+	if l := sockets.listener("other"); l == nil || sockets.sockets[0].listener != l {
+		t.Fatal("Expected the first unclaimed socket")
+	}
+	if l := sockets.listener(""); l != nil {
+		t.Fatal("Expected no stream sockets to be left")
+	}
+
+	conn := sockets.udpConn("")
+	if conn == nil || conn.LocalAddr().String() != udp.LocalAddr().String() {
+		t.Fatalf("Expected the inherited UDP socket, got %v", conn)
+	}
+	conn.Close()
+
+	// The adopted listener accepts on the original socket
+	s := &Server{Handler: echo}
+	s.listener = sockets.sockets[0].listener
+	go s.acceptLoop()
+	defer s.Shutdown(t.Context())
+
+	client, err := net.Dial("tcp", tcp.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer client.Close()
+	client.Write([]byte("hi"))
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(client, buf); err != nil || string(buf) != "hi" {
+		t.Fatalf("Expected an echo through the adopted listener, got %q (%v)", buf, err)
+	}
+	sockets.sockets[1].listener.Close()
+}
+
+func TestUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "echo.sock")
+
+	// Leave a stale socket file behind, as a crashed process would
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	s := NewServer("unix:"+path, echo)
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+
+	for i := range 2 {
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			t.Fatal("Error connecting to server:", err)
+		}
+		msg := []byte("hello " + strconv.Itoa(i))
+		conn.Write(msg)
+		buf := make([]byte, len(msg))
+		if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != string(msg) {
+			t.Fatalf("Expected an echo over the unix socket, got %q (%v)", buf, err)
+		}
+		defer conn.Close()
+	}
+
+	listener.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("Expected the socket file to be removed on close")
+	}
+}
+
+func TestUnixSocketDoesNotReplaceRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not-a-socket")
+	os.WriteFile(path, []byte("data"), 0o600)
+
+	if err := NewServer("unix:"+path, echo).Listen(); err == nil {
+		t.Fatal("Expected binding over a regular file to fail")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "data" {
+		t.Fatal("Expected the file to be left alone")
+	}
+}
+
+func TestUnixSocketInUseIsLeftAlone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "echo.sock")
+	s := NewServer("unix:"+path, echo)
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	err = NewServer("unix:"+path, echo).Listen()
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		t.Fatal("Expected a second server on the path to fail with address in use, got:", err)
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal("Expected the first server to stay reachable:", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("Expected an echo from the first server, got %q (%v)", buf, err)
+	}
+}
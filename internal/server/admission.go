@@ -0,0 +1,60 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+const (
+	minAcceptBackoff = 5 * time.Millisecond
+	maxAcceptBackoff = time.Second
+
+	// rejectTimeout bounds how long a refusal message may take to send, TLS
+	// handshake included, so a rejected client that doesn't read can't pin a
+	// goroutine.
+	rejectTimeout = time.Second
+)
+
+// admission is the outcome of offering a freshly accepted connection to the server.
+type admission int
+
+const (
+	admitted admission = iota
+	rejected           // Over MaxConns or MaxConnsPerIP
+	closing            // Server is shutting down
+)
+
+// reject sends the configured refusal message, if any, and closes conn. On
+// a TLS server the message is sent over TLS, as the client expects.
+func (s *Server) reject(conn net.Conn) {
+	if s.RejectMessage == nil {
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Now().Add(rejectTimeout))
+	if s.TLSConfig != nil {
+		conn = tls.Server(conn, s.TLSConfig)
+	}
+	defer conn.Close()
+	conn.Write(s.RejectMessage)
+}
+
+// nextAcceptBackoff doubles the delay between failed Accept calls, starting
+// at minAcceptBackoff and capped at maxAcceptBackoff.
+func nextAcceptBackoff(backoff time.Duration) time.Duration {
+	if backoff == 0 {
+		return minAcceptBackoff
+	}
+	return min(backoff*2, maxAcceptBackoff)
+}
+
+// sourceIP returns the IP address part of the connection's remote address.
+func sourceIP(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// holdOpen is a handler that keeps the connection open until the client
+// disconnects.
+func holdOpen(conn net.Conn) {
+	defer conn.Close()
+	io.Copy(io.Discard, conn)
+}
+
+func TestMaxConnsRejectsWithMessage(t *testing.T) {
+	s := NewServer(":0", holdOpen)
+	s.MaxConns = 1
+	s.RejectMessage = []byte("server full\n")
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	first, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	waitForConns(t, s, 1)
+
+	second, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer second.Close()
+
+	scanner := bufio.NewScanner(second)
+	if !scanner.Scan() || scanner.Text() != "server full" {
+		t.Fatalf("Expected refusal line, got %q", scanner.Text())
+	}
+	if scanner.Scan() {
+		t.Fatal("Expected the rejected connection to be closed")
+	}
+
+	// Once the first client leaves there is room again
+	first.Close()
+	waitForConns(t, s, 0)
+	third, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer third.Close()
+	waitForConns(t, s, 1)
+}
+
+func TestMaxConnsRejectsWithMessageOverTLS(t *testing.T) {
+	serverConfig, clientConfig, err := SelfSignedTLSConfig()
+	if err != nil {
+		t.Fatal("Error generating certificate:", err)
+	}
+	s := NewServer(":0", holdOpen)
+	s.MaxConns = 1
+	s.RejectMessage = []byte("server full\n")
+	s.TLSConfig = serverConfig
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	first, err := Dial(listener.Addr().String(), clientConfig)
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer first.Close()
+	waitForConns(t, s, 1)
+
+	second, err := Dial(listener.Addr().String(), clientConfig)
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer second.Close()
+	second.SetDeadline(time.Now().Add(2 * time.Second))
+
+	scanner := bufio.NewScanner(second)
+	if !scanner.Scan() || scanner.Text() != "server full" {
+		t.Fatalf("Expected refusal line over TLS, got %q (%v)", scanner.Text(), scanner.Err())
+	}
+}
+
+func TestMaxConnsPerIPClosesImmediately(t *testing.T) {
+	s := NewServer(":0", holdOpen)
+	s.MaxConnsPerIP = 2
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	for range 2 {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal("Error connecting to server:", err)
+		}
+		defer conn.Close()
+	}
+	waitForConns(t, s, 2)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if n, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("Expected the connection to be closed without a message, got %d bytes (%v)", n, err)
+	}
+}
+
+// failingListener fails every Accept until it is closed.
+type failingListener struct {
+	net.Listener
+	mu      sync.Mutex
+	accepts int
+	closed  chan struct{}
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	select {
+	case <-l.closed:
+		return nil, net.ErrClosed
+	default:
+	}
+	l.mu.Lock()
+	l.accepts++
+	l.mu.Unlock()
+	return nil, errors.New("accept: too many open files")
+}
+
+func (l *failingListener) Close() error {
+	close(l.closed)
+	return nil
+}
+
+func TestAcceptErrorsBackOff(t *testing.T) {
+	listener := &failingListener{closed: make(chan struct{})}
+	s := NewServer("", holdOpen)
+	s.listener = listener
+
+	done := make(chan struct{})
+	go func() {
+		s.acceptLoop()
+		close(done)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	listener.Close()
+	<-done
+
+	// 5ms, 10ms, 20ms, 40ms... fit at most a handful of retries in 100ms
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+	if listener.accepts > 10 {
+		t.Fatalf("Expected accept errors to back off, got %d attempts in 100ms", listener.accepts)
+	}
+}
+
+func TestNextAcceptBackoff(t *testing.T) {
+	backoff := time.Duration(0)
+	for _, expected := range []time.Duration{
+		5 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond,
+	} {
+		backoff = nextAcceptBackoff(backoff)
+		if backoff != expected {
+			t.Fatalf("Expected backoff %v, got %v", expected, backoff)
+		}
+	}
+
+	if backoff := nextAcceptBackoff(800 * time.Millisecond); backoff != time.Second {
+		t.Fatalf("Expected backoff to be capped at 1s, got %v", backoff)
+	}
+}
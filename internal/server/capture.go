@@ -0,0 +1,170 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TrafficEvent is a single event in a traffic recording. Recordings are
+// stored as JSON lines, one event per line, in the order they happened.
+type TrafficEvent struct {
+	Time time.Time `json:"time"`
+
+	// Network is "tcp" or "udp". Session identifies the client: the
+	// connection ID for TCP and the client's address for UDP.
+	Network string `json:"network"`
+	Session string `json:"session"`
+
+	// Event is "open" or "close" for the start and end of a TCP connection,
+	// "in" for bytes received from the client and "out" for bytes sent to it.
+	Event string `json:"event"`
+	Data  []byte `json:"data,omitempty"`
+
+	// Remote is the client's address, given on "open".
+	Remote string `json:"remote,omitempty"`
+}
+
+// Recorder writes traffic recordings. It is safe for concurrent use, so a
+// single Recorder can capture every connection of a server.
+type Recorder struct {
+	mu     sync.Mutex
+	enc    *json.Encoder
+	closer io.Closer
+
+	sessions atomic.Uint64 // For connections without a connection ID
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	r := &Recorder{enc: json.NewEncoder(w)}
+	if c, ok := w.(io.Closer); ok {
+		r.closer = c
+	}
+	return r
+}
+
+// OpenRecording creates (or truncates) the file at path and returns a
+// Recorder writing to it.
+func OpenRecording(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecorder(f), nil
+}
+
+// Close closes the underlying writer, if it can be closed.
+func (r *Recorder) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+func (r *Recorder) record(network, session, event string, data []byte, remote string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enc.Encode(TrafficEvent{
+		Time:    time.Now(),
+		Network: network,
+		Session: session,
+		Event:   event,
+		Data:    data,
+		Remote:  remote,
+	})
+}
+
+// ReadRecording reads every event from a recording.
+func ReadRecording(r io.Reader) ([]TrafficEvent, error) {
+	var events []TrafficEvent
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var event TrafficEvent
+		if err := dec.Decode(&event); err == io.EOF {
+			return events, nil
+		} else if err != nil {
+			return events, err
+		}
+		events = append(events, event)
+	}
+}
+
+// Record captures everything read from and written to each connection.
+func Record(r *Recorder) Middleware {
+	return func(next Handler) Handler {
+		return func(conn net.Conn) {
+			id := ConnID(conn)
+			if id == 0 {
+				id = r.sessions.Add(1)
+			}
+			rc := &recordingConn{Conn: conn, recorder: r, session: strconv.FormatUint(id, 10)}
+			r.record("tcp", rc.session, "open", nil, conn.RemoteAddr().String())
+			defer rc.recordClose()
+			next(rc)
+		}
+	}
+}
+
+type recordingConn struct {
+	net.Conn
+	recorder  *Recorder
+	session   string
+	closeOnce sync.Once
+}
+
+func (c *recordingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.recorder.record("tcp", c.session, "in", b[:n], "")
+	}
+	return n, err
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.recorder.record("tcp", c.session, "out", b[:n], "")
+	}
+	return n, err
+}
+
+func (c *recordingConn) Close() error {
+	c.recordClose()
+	return c.Conn.Close()
+}
+
+func (c *recordingConn) recordClose() {
+	c.closeOnce.Do(func() { c.recorder.record("tcp", c.session, "close", nil, "") })
+}
+
+func (c *recordingConn) Unwrap() net.Conn { return c.Conn }
+
+// RecordUdp captures every datagram a UdpServer receives and every reply its
+// handler sends.
+func RecordUdp(r *Recorder) UdpMiddleware {
+	return func(next UdpHandler) UdpHandler {
+		return func(conn UdpConn, buf []byte, n int, addr *net.UDPAddr) {
+			r.record("udp", addr.String(), "in", buf[:n], "")
+			next(&recordingUdpConn{UdpConn: conn, recorder: r}, buf, n, addr)
+		}
+	}
+}
+
+type recordingUdpConn struct {
+	UdpConn
+	recorder *Recorder
+}
+
+func (c *recordingUdpConn) WriteToUDP(b []byte, addr *net.UDPAddr) (int, error) {
+	n, err := c.UdpConn.WriteToUDP(b, addr)
+	if err == nil {
+		c.recorder.record("udp", addr.String(), "out", b[:n], "")
+	}
+	return n, err
+}
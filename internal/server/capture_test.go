@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRecordTcp(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewServer("127.0.0.1:0", echo)
+	s.Middleware = []Middleware{Record(NewRecorder(&buf))}
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	conn.Write([]byte("hello"))
+	io.ReadFull(conn, make([]byte, 5))
+	conn.Close()
+	waitForConns(t, s, 0)
+
+	records, err := ReadRecording(&buf)
+	if err != nil {
+		t.Fatal("Error reading recording:", err)
+	}
+	var events []string
+	for _, r := range records {
+		events = append(events, r.Event+":"+string(r.Data))
+		if r.Network != "tcp" || r.Session != records[0].Session {
+			t.Fatalf("Expected a single TCP session, got %+v", r)
+		}
+	}
+	expected := []string{"open:", "in:hello", "out:hello", "close:"}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected events %v, got %v", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Fatalf("Expected events %v, got %v", expected, events)
+		}
+	}
+	if records[0].Remote != conn.LocalAddr().String() {
+		t.Fatalf("Expected the client address on open, got %q", records[0].Remote)
+	}
+}
+
+func TestRecordUdp(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewUdpServer("127.0.0.1:0", udpEcho)
+	s.Middleware = []UdpMiddleware{RecordUdp(NewRecorder(&buf))}
+	if err := s.Start(); err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+
+	conn := dialUdp(t, s.LocalAddr())
+	defer conn.Close()
+	conn.Write([]byte("key=value"))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 100)); err != nil {
+		t.Fatal("Expected a reply:", err)
+	}
+	s.Close()
+
+	records, err := ReadRecording(&buf)
+	if err != nil {
+		t.Fatal("Error reading recording:", err)
+	}
+	if len(records) != 2 || records[0].Event != "in" || records[1].Event != "out" ||
+		string(records[1].Data) != "key=value" || records[1].Session != conn.LocalAddr().String() {
+		t.Fatalf("Unexpected recording %+v", records)
+	}
+}
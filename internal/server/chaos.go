@@ -0,0 +1,144 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Faults describes the misbehaviour of a hostile network, for checking that
+// a protocol's framing doesn't depend on how the bytes happen to arrive. The
+// zero value injects nothing.
+type Faults struct {
+	// FragmentWrites splits every write into single-byte writes, so a peer
+	// reading a socket with Nagle disabled sees one segment per byte.
+	FragmentWrites bool
+
+	// MaxReadSize caps the bytes returned by each read, splitting messages
+	// across reads. 1 delivers a single byte at a time. Zero means no cap.
+	MaxReadSize int
+
+	// CoalesceWindow is waited out before each read from the network, so
+	// that messages written separately pile up and are returned together by
+	// a single read (up to the caller's buffer size).
+	CoalesceWindow time.Duration
+
+	// ReadDelay is waited out before every read, including those served
+	// from bytes already received.
+	ReadDelay time.Duration
+
+	// ResetAfter, if positive, resets the connection once that many bytes
+	// have been read, which can be in the middle of a message. The read
+	// that hits the limit fails with ECONNRESET and the peer sees a reset.
+	ResetAfter int
+}
+
+// HostileSegmentation returns fault sets, by name, that only change how the
+// bytes on a connection are split into reads and writes. A protocol whose
+// framing is sound behaves the same under each of them, so tests can run
+// their scenarios once per set.
+func HostileSegmentation() map[string]Faults {
+	return map[string]Faults{
+		"single-byte reads":     {MaxReadSize: 1},
+		"coalesced reads":       {CoalesceWindow: 5 * time.Millisecond},
+		"single-byte writes":    {FragmentWrites: true},
+		"slow single-byte link": {MaxReadSize: 1, ReadDelay: time.Millisecond, FragmentWrites: true},
+	}
+}
+
+// InjectFaults wraps every connection so that it misbehaves as described by
+// faults.
+func InjectFaults(faults Faults) Middleware {
+	return func(next Handler) Handler {
+		return func(conn net.Conn) {
+			next(WithFaults(conn, faults))
+		}
+	}
+}
+
+// WithFaults returns conn wrapped so that it misbehaves as described by
+// faults, e.g. for a test client.
+func WithFaults(conn net.Conn, faults Faults) net.Conn {
+	return &faultyConn{Conn: conn, faults: faults}
+}
+
+// coalesceBufferSize is how much a faultyConn reads from the network at once,
+// which bounds how many messages one read can coalesce.
+const coalesceBufferSize = 64 * 1024
+
+type faultyConn struct {
+	net.Conn
+	faults Faults
+
+	pending    []byte // Read from Conn but not yet returned
+	pendingErr error  // Returned once pending is drained
+	read       int
+
+	writeMu sync.Mutex // Keeps concurrent fragmented writes from interleaving
+}
+
+// Read is not safe to call concurrently, like deadlineConn's.
+func (c *faultyConn) Read(b []byte) (int, error) {
+	if c.faults.ReadDelay > 0 {
+		time.Sleep(c.faults.ReadDelay)
+	}
+	if c.faults.ResetAfter > 0 && c.read >= c.faults.ResetAfter {
+		return 0, c.reset()
+	}
+
+	if len(c.pending) == 0 {
+		if err := c.pendingErr; err != nil {
+			c.pendingErr = nil
+			return 0, err
+		}
+		if c.faults.CoalesceWindow > 0 {
+			time.Sleep(c.faults.CoalesceWindow)
+		}
+		buf := make([]byte, max(len(b), coalesceBufferSize))
+		n, err := c.Conn.Read(buf)
+		if n == 0 {
+			return 0, err
+		}
+		c.pending, c.pendingErr = buf[:n], err
+	}
+
+	limit := len(b)
+	if c.faults.MaxReadSize > 0 {
+		limit = min(limit, c.faults.MaxReadSize)
+	}
+	if c.faults.ResetAfter > 0 {
+		limit = min(limit, c.faults.ResetAfter-c.read)
+	}
+	n := copy(b[:limit], c.pending)
+	c.pending = c.pending[n:]
+	c.read += n
+	return n, nil
+}
+
+// reset closes the connection such that the peer sees a reset rather than
+// an orderly close, where the transport allows it.
+func (c *faultyConn) reset() error {
+	if tcp, ok := find[*net.TCPConn](c.Conn); ok {
+		tcp.SetLinger(0)
+	}
+	c.Conn.Close()
+	return fmt.Errorf("injected fault after %d bytes: %w", c.read, syscall.ECONNRESET)
+}
+
+func (c *faultyConn) Write(b []byte) (int, error) {
+	if !c.faults.FragmentWrites {
+		return c.Conn.Write(b)
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	for i := range b {
+		if _, err := c.Conn.Write(b[i : i+1]); err != nil {
+			return i, err
+		}
+	}
+	return len(b), nil
+}
+
+func (c *faultyConn) Unwrap() net.Conn { return c.Conn }
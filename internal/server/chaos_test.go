@@ -0,0 +1,115 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// faultyPair returns both ends of a pipe connection, with the server end
+// wrapped in faults.
+func faultyPair(t *testing.T, faults Faults) (client *PipeConn, srv net.Conn) {
+	t.Helper()
+	listener := NewPipeListener()
+	t.Cleanup(func() { listener.Close() })
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := listener.Accept()
+		accepted <- conn
+	}()
+	client, err := listener.Dial()
+	if err != nil {
+		t.Fatal("Error connecting:", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, WithFaults(<-accepted, faults)
+}
+
+func TestFaultsMaxReadSize(t *testing.T) {
+	client, srv := faultyPair(t, Faults{MaxReadSize: 1})
+	client.Write([]byte("abc"))
+	client.Close()
+
+	buf := make([]byte, 16)
+	var reads []string
+	for {
+		n, err := srv.Read(buf)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		reads = append(reads, string(buf[:n]))
+	}
+	if len(reads) != 3 || reads[0] != "a" || reads[1] != "b" || reads[2] != "c" {
+		t.Fatalf("Expected one byte per read, got %q", reads)
+	}
+}
+
+func TestFaultsFragmentWrites(t *testing.T) {
+	client, srv := faultyPair(t, Faults{FragmentWrites: true})
+	srv.Write([]byte("hello\n"))
+
+	line, err := bufio.NewReader(client).ReadString('\n')
+	if err != nil || line != "hello\n" {
+		t.Fatalf("Expected fragmented write to arrive intact, got %q (%v)", line, err)
+	}
+}
+
+func TestFaultsCoalesceWindow(t *testing.T) {
+	client, srv := faultyPair(t, Faults{CoalesceWindow: 20 * time.Millisecond})
+	go func() {
+		client.Write([]byte("one\n"))
+		time.Sleep(time.Millisecond)
+		client.Write([]byte("two\n"))
+	}()
+
+	buf := make([]byte, 16)
+	n, err := srv.Read(buf)
+	if err != nil || string(buf[:n]) != "one\ntwo\n" {
+		t.Fatalf("Expected both writes in one read, got %q (%v)", buf[:n], err)
+	}
+}
+
+func TestFaultsResetAfter(t *testing.T) {
+	client, srv := faultyPair(t, Faults{ResetAfter: 4})
+	client.Write([]byte("halfway"))
+
+	data, err := io.ReadAll(srv)
+	if string(data) != "half" {
+		t.Fatalf("Expected reads to stop after 4 bytes, got %q", data)
+	}
+	if !errors.Is(err, syscall.ECONNRESET) {
+		t.Fatal("Expected a reset, got:", err)
+	}
+	if _, err := client.Write([]byte("more")); err == nil {
+		t.Fatal("Expected the connection to be closed")
+	}
+}
+
+func TestFaultsResetOverTcp(t *testing.T) {
+	listener, err := StartTcpListener("127.0.0.1:0", Chain(func(conn net.Conn) {
+		io.Copy(io.Discard, conn)
+	}, InjectFaults(Faults{ResetAfter: 3})))
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("half a message"))
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, syscall.ECONNRESET) {
+		t.Fatal("Expected the peer to see a reset, got:", err)
+	}
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// logLevel is the level of the default logger set up by Config, which can
+// change while the command runs.
+var logLevel slog.LevelVar
+
+// Config is the configuration the service commands have in common. Its
+// AddFlags methods register the flags that set it, so that every command
+// spells them, and their environment variables, the same way.
+type Config struct {
+	ConfigFile string
+
+	// Addr is the address the service listens on, and RecordFile the file
+	// to record its traffic to, if any.
+	Addr       string
+	RecordFile string
+
+	LogFormat string
+	LogLevel  slog.Level
+
+	// MetricsAddr and AdminAddr serve the metrics and the connection
+	// inventory over HTTP if they are set.
+	MetricsAddr string
+	AdminAddr   string
+
+	IPVersion     IPVersion
+	SocketOptions SocketOptions
+	ProxyProtocol ProxyProtocolMode
+	UdpGuard      UdpGuard
+
+	// TLSCertFile and TLSKeyFile, if set, make the TCP servers terminate TLS
+	// with the PEM encoded certificate and key in them, which Parse loads
+	// into tlsConfig.
+	TLSCertFile string
+	TLSKeyFile  string
+	tlsConfig   *tls.Config
+
+	// Limits override those the service's server comes with.
+	Limits Limits
+
+	// DrainTimeout bounds how long the TCP servers drain after a handoff.
+	DrainTimeout time.Duration
+
+	// Init makes SignalContext stay behind as init when the command is PID 1.
+	Init bool
+
+	// WebSocketAddr, if set, serves the TCP service to browsers on pages of
+	// WebSocketOrigins over WebSocket.
+	WebSocketAddr    string
+	WebSocketOrigins WebSocketOrigins
+}
+
+// AddFlags registers the flags every command takes.
+func (c *Config) AddFlags(f *Flags) {
+	f.ConfigFile(&c.ConfigFile)
+	f.String(&c.LogFormat, "log-format", "text", "log `format`, text or json")
+	f.Text(&c.LogLevel, "log-level", "minimum `level` to log: debug, info, warn or error")
+	f.EndpointAddr(&c.MetricsAddr, "metrics-addr", "", "`address` to serve Prometheus metrics on")
+	f.Text(&c.IPVersion, "ip-version", "IP `version` to listen on: dual, 4 or 6")
+	f.Text(&c.SocketOptions, "socket-options", "comma-separated socket `options`, such as keepalive=30s,nagle,reuseport")
+	f.Bool(&c.Init, "init", false, "if PID 1, as a container's entrypoint is, stay behind as init and serve from a child, so that a handoff doesn't stop the container")
+	f.Live("log-level")
+}
+
+// AddListenFlags registers the flags of a command that runs a single
+// service, listening on addr unless told otherwise.
+func (c *Config) AddListenFlags(f *Flags, addr string) {
+	f.ListenAddr(&c.Addr, "listen-addr", addr, "`address` to serve on, as host:port or unix:path")
+	f.String(&c.RecordFile, "record-file", "", "`file` to record every session to, for replay")
+}
+
+// AddLimitFlags registers the flags that override the limits of a command's
+// TCP server. Zero keeps the service's default and a negative value lifts
+// the limit or disables the timeout.
+func (c *Config) AddLimitFlags(f *Flags) {
+	f.Int(&c.Limits.MaxConns, "max-conns", 0, "maximum concurrent `connections`; 0 keeps the service's default, negative lifts it")
+	f.Int(&c.Limits.MaxConnsPerIP, "max-conns-per-ip", 0, "maximum concurrent `connections` from one source address; 0 keeps the service's default, negative lifts it")
+	f.Duration(&c.Limits.HandshakeTimeout, "handshake-timeout", 0, "how long a new client has to send its first bytes; 0 keeps the service's default, negative disables it")
+	f.Duration(&c.Limits.IdleTimeout, "idle-timeout", 0, "how long a client may stay silent; 0 keeps the service's default, negative disables it")
+	f.Duration(&c.Limits.WriteTimeout, "write-timeout", 0, "how long a write to a client may take; 0 keeps the service's default, negative disables it")
+	f.Live("max-conns", "max-conns-per-ip", "handshake-timeout", "idle-timeout", "write-timeout")
+}
+
+// AddTCPFlags registers the flags of a command that runs TCP services.
+func (c *Config) AddTCPFlags(f *Flags) {
+	f.EndpointAddr(&c.AdminAddr, "admin-addr", "", "`address` to serve the connection inventory on; keep it private")
+	f.Text(&c.ProxyProtocol, "proxy-protocol", "PROXY protocol `mode`: off, permissive or strict")
+	f.String(&c.TLSCertFile, "tls-cert", "", "PEM certificate `file` to terminate TLS with, along with -tls-key")
+	f.String(&c.TLSKeyFile, "tls-key", "", "PEM private key `file` for -tls-cert")
+	f.Duration(&c.DrainTimeout, "drain-timeout", DefaultDrainTimeout, "how long to keep serving connections after handing the sockets to a new process; negative waits for every client to leave")
+	f.Check(c.loadTLSConfig)
+}
+
+// AddWebSocketFlags registers the flags of a command that serves its TCP
+// service to browsers as well.
+func (c *Config) AddWebSocketFlags(f *Flags) {
+	f.EndpointAddr(&c.WebSocketAddr, "websocket-addr", "", "`address` to serve the service to browsers over WebSocket on")
+	f.Text(&c.WebSocketOrigins, "websocket-origins", "comma-separated `origins` of the pages that may use -websocket-addr, such as https://example.com, or * for any; only the endpoint's own host if empty")
+}
+
+// AddUdpFlags registers the flags of a command that runs UDP services.
+func (c *Config) AddUdpFlags(f *Flags) {
+	f.Text(&c.UdpGuard, "udp-guard", "UDP abuse `limits`, such as allow=10.0.0.0/8,rate=20,burst=40,amplification=2")
+}
+
+// SetupLogging makes the default logger write to stderr in the configured
+// format and at the configured level, and tags every record with the service
+// name unless it is empty.
+func (c *Config) SetupLogging(service string) error {
+	logLevel.Set(c.LogLevel)
+	logger, err := newLogger(os.Stderr, c.LogFormat, &logLevel)
+	if err != nil {
+		return err
+	}
+	if service != "" {
+		logger = logger.With("service", service)
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+// SignalContext is like the package's SignalContext, but first stays behind
+// as init if Init is set and the process is PID 1, returning only in the
+// child that serves.
+func (c *Config) SignalContext() (context.Context, context.CancelFunc) {
+	if c.Init {
+		becomeInit()
+	}
+	return SignalContext()
+}
+
+// ServeEndpoints serves the metrics and admin endpoints that are configured
+// in the background until ctx is cancelled.
+func (c *Config) ServeEndpoints(ctx context.Context) {
+	if c.MetricsAddr != "" {
+		go ServeMetrics(ctx, c.MetricsAddr)
+	}
+	if c.AdminAddr != "" {
+		go ServeAdmin(ctx, c.AdminAddr)
+	}
+}
+
+// Configure applies the socket, PROXY protocol, TLS, drain, WebSocket and
+// limit settings to srv.
+func (c *Config) Configure(srv *Server) {
+	srv.ProxyProtocol = c.ProxyProtocol
+	srv.TLSConfig = c.tlsConfig
+	srv.DrainTimeout = c.DrainTimeout
+	srv.WebSocketOrigins = c.WebSocketOrigins
+	srv.SocketOptions = c.socketOptions()
+	srv.SetLimits(c.Limits)
+}
+
+// Reconfigure applies the settings that can change while the command runs,
+// for WatchConfig: the log level and, unless srv is nil, its limits.
+func (c *Config) Reconfigure(srv *Server) {
+	logLevel.Set(c.LogLevel)
+	if srv != nil {
+		srv.SetLimits(c.Limits)
+	}
+}
+
+// ConfigureUdp applies the socket settings and the UDP guard to srv.
+func (c *Config) ConfigureUdp(srv *UdpServer) {
+	srv.SocketOptions = c.socketOptions()
+	srv.Middleware = append(srv.Middleware, c.UdpGuard.Middleware()...)
+}
+
+func (c *Config) socketOptions() SocketOptions {
+	options := c.SocketOptions
+	options.IPVersion = c.IPVersion
+	return options
+}
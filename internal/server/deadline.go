@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net"
+	"time"
+)
+
+// deadlineConn refreshes the connection's deadlines before every Read and
+// Write, so a client that stalls can't hold its handler goroutine forever.
+type deadlineConn struct {
+	net.Conn
+	handshakeDeadline time.Time
+	idleTimeout       time.Duration
+	writeTimeout      time.Duration
+	greeted           bool // Set once the client has sent its first bytes
+}
+
+func (s *Server) withDeadlines(conn net.Conn) net.Conn {
+	limits := s.limits()
+	if limits.HandshakeTimeout == 0 && limits.IdleTimeout == 0 && limits.WriteTimeout == 0 {
+		return conn
+	}
+
+	c := &deadlineConn{
+		Conn:         conn,
+		idleTimeout:  limits.IdleTimeout,
+		writeTimeout: limits.WriteTimeout,
+	}
+	if limits.HandshakeTimeout > 0 {
+		c.handshakeDeadline = time.Now().Add(limits.HandshakeTimeout)
+	}
+	return c
+}
+
+// Read is not safe to call concurrently, which matches how handlers use their
+// connections: a single goroutine reads while any number may write.
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	switch {
+	case !c.greeted && !c.handshakeDeadline.IsZero():
+		c.Conn.SetReadDeadline(c.handshakeDeadline)
+	case c.idleTimeout > 0:
+		c.Conn.SetReadDeadline(time.Now().Add(c.idleTimeout))
+	default:
+		c.Conn.SetReadDeadline(time.Time{})
+	}
+
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.greeted = true
+	}
+	return n, err
+}
+
+func (c *deadlineConn) Write(b []byte) (int, error) {
+	if c.writeTimeout > 0 {
+		c.Conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *deadlineConn) Unwrap() net.Conn { return c.Conn }
+
+// DisableIdleTimeout lets the client on conn, a connection from a Server,
+// stay silent for as long as it likes from then on. It is for protocols in
+// which a client may, once it has said what it is, only ever listen. Like
+// Read, it must be called from the goroutine that reads conn.
+func DisableIdleTimeout(conn net.Conn) {
+	if c, ok := find[*deadlineConn](conn); ok {
+		c.idleTimeout = 0
+	}
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// readUntilError records the error that ended the handler's read loop.
+func readUntilError(errs chan<- error) func(net.Conn) {
+	return func(conn net.Conn) {
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			conn.Write(append(scanner.Bytes(), '\n'))
+		}
+		errs <- scanner.Err()
+	}
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	errs := make(chan error, 1)
+	s := NewServer(":0", readUntilError(errs))
+	s.HandshakeTimeout = 50 * time.Millisecond
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Close()
+
+	// Never send anything
+	select {
+	case err := <-errs:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatal("Expected deadline exceeded, got:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Silent client was not timed out")
+	}
+}
+
+func TestIdleTimeoutIsRefreshedByTraffic(t *testing.T) {
+	errs := make(chan error, 1)
+	s := NewServer(":0", readUntilError(errs))
+	s.HandshakeTimeout = 50 * time.Millisecond
+	s.IdleTimeout = 100 * time.Millisecond
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Close()
+
+	// Keep talking for longer than both timeouts
+	scanner := bufio.NewScanner(conn)
+	for range 5 {
+		conn.Write([]byte("ping\n"))
+		if !scanner.Scan() {
+			t.Fatal("Connection closed while client was active:", scanner.Err())
+		}
+		time.Sleep(40 * time.Millisecond)
+	}
+
+	// Then go quiet, e.g. halfway through a line
+	conn.Write([]byte("pi"))
+	select {
+	case err := <-errs:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatal("Expected deadline exceeded, got:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Idle client was not timed out")
+	}
+}
+
+func TestDisableIdleTimeout(t *testing.T) {
+	s := NewServer(":0", func(conn net.Conn) {
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			if scanner.Text() == "listen" {
+				DisableIdleTimeout(conn)
+			}
+			conn.Write(append(scanner.Bytes(), '\n'))
+		}
+	})
+	s.IdleTimeout = 50 * time.Millisecond
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+
+	scanner := bufio.NewScanner(conn)
+	conn.Write([]byte("listen\n"))
+	scanner.Scan()
+	time.Sleep(200 * time.Millisecond) // Well past the idle timeout
+	conn.Write([]byte("ping\n"))
+	if !scanner.Scan() || scanner.Text() != "ping" {
+		t.Fatal("Expected a client that only listens to stay connected:", scanner.Err())
+	}
+}
+
+func TestWriteTimeoutUnblocksStalledReader(t *testing.T) {
+	errs := make(chan error, 1)
+	s := NewServer(":0", func(conn net.Conn) {
+		defer conn.Close()
+		chunk := make([]byte, 64*1024)
+		for {
+			if _, err := conn.Write(chunk); err != nil {
+				errs <- err
+				return
+			}
+		}
+	})
+	s.WriteTimeout = 50 * time.Millisecond
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	// Connect but never read, so the socket buffers eventually fill up
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Close()
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatal("Expected deadline exceeded, got:", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write to stalled client never timed out")
+	}
+}
+
+func TestNoTimeoutsLeaveConnectionUnwrapped(t *testing.T) {
+	s := NewServer(":0", nil)
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	if conn := s.withDeadlines(server); conn != server {
+		t.Fatalf("Expected the connection to be passed through, got %T", conn)
+	}
+}
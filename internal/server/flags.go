@@ -0,0 +1,332 @@
+package server
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Flags are the command-line flags of a command, each of which falls back to
+// an environment variable named after it: -metrics-addr can also be given as
+// METRICS_ADDR. A flag on the command line wins over the environment, which
+// wins over the config file, if there is one. Values from any of them are
+// validated the same way.
+type Flags struct {
+	set        *flag.FlagSet
+	configFile *string
+	live       map[string]bool
+	checks     []func() error
+
+	// healthcheck is whether the command line asks for a healthcheck.
+	healthcheck bool
+}
+
+// newFlags returns an empty set of flags for the named command, whose usage
+// lists every flag with its environment variable.
+func newFlags(command string, errorHandling flag.ErrorHandling) *Flags {
+	set := flag.NewFlagSet(command, errorHandling)
+	set.Usage = func() {
+		fmt.Fprintf(set.Output(), "Usage: %s [%s] [flags]\n\n", command, healthcheckCommand)
+		set.PrintDefaults()
+	}
+	return &Flags{set: set, live: make(map[string]bool)}
+}
+
+// envName returns the environment variable for the named flag.
+func envName(flagName string) string {
+	return strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// withEnv appends the flag's environment variable to its usage.
+func withEnv(name, usage string) string {
+	return fmt.Sprintf("%s ($%s)", usage, envName(name))
+}
+
+func (f *Flags) add(value flag.Value, name, usage string) {
+	f.set.Var(value, name, withEnv(name, usage))
+}
+
+// String defines a string flag with the given default.
+func (f *Flags) String(p *string, name, value, usage string) {
+	f.set.StringVar(p, name, value, withEnv(name, usage))
+}
+
+// Bool defines a boolean flag with the given default.
+func (f *Flags) Bool(p *bool, name string, value bool, usage string) {
+	f.set.BoolVar(p, name, value, withEnv(name, usage))
+}
+
+// Int defines an integer flag with the given default.
+func (f *Flags) Int(p *int, name string, value int, usage string) {
+	f.set.IntVar(p, name, value, withEnv(name, usage))
+}
+
+// Float defines a floating-point flag with the given default.
+func (f *Flags) Float(p *float64, name string, value float64, usage string) {
+	f.set.Float64Var(p, name, value, withEnv(name, usage))
+}
+
+// Duration defines a duration flag with the given default.
+func (f *Flags) Duration(p *time.Duration, name string, value time.Duration, usage string) {
+	f.set.DurationVar(p, name, value, withEnv(name, usage))
+}
+
+// Text defines a flag parsed by p's UnmarshalText, such as SocketOptions.
+// Whatever p holds is the default.
+func (f *Flags) Text(p encoding.TextUnmarshaler, name, usage string) {
+	f.add(&textValue{p: p}, name, usage)
+}
+
+// ConfigFile defines the -config-file flag, naming a JSON file that sets
+// any of the other flags. Its keys are flag names and its values strings,
+// numbers or booleans, as in {"listen-addr": ":9000", "idle-timeout": "5m"}.
+func (f *Flags) ConfigFile(p *string) {
+	f.String(p, "config-file", "", "JSON `file` of flag settings, reloaded on SIGHUP")
+	f.configFile = p
+}
+
+// Live marks the named flags as settings the command applies while it runs,
+// which WatchConfig reloads instead of asking for a restart.
+func (f *Flags) Live(names ...string) {
+	for _, name := range names {
+		f.live[name] = true
+	}
+}
+
+// Check adds a check that Parse runs once every flag is set, for constraints
+// that a single flag can't express.
+func (f *Flags) Check(check func() error) {
+	f.checks = append(f.checks, check)
+}
+
+// ListenAddr defines a flag for an address to listen on: "host:port", where
+// the host may be left out to listen on every interface, or "unix:path". An
+// empty default makes the flag optional, meaning the listener is disabled
+// unless it is set.
+func (f *Flags) ListenAddr(p *string, name, value, usage string) {
+	*p = value
+	f.add(&addrValue{p: p, optional: value == "", check: CheckListenAddr}, name, usage)
+}
+
+// EndpointAddr is like ListenAddr for HTTP endpoints, which don't support
+// unix domain sockets.
+func (f *Flags) EndpointAddr(p *string, name, value, usage string) {
+	*p = value
+	f.add(&addrValue{p: p, optional: value == "", check: checkHostPort}, name, usage)
+}
+
+// DialAddr defines a flag for a "host:port" address to connect to.
+func (f *Flags) DialAddr(p *string, name, value, usage string) {
+	*p = value
+	f.add(&addrValue{p: p, optional: value == "", check: checkDialAddr}, name, usage)
+}
+
+// Parse parses the command line, which must consist of flags and, anywhere
+// among them, at most the healthcheck subcommand. It then sets every flag
+// that wasn't on it from its environment variable, and those that weren't
+// set either way from the config file.
+func (f *Flags) Parse(args []string) error {
+	if err := f.set.Parse(args); err != nil {
+		return err
+	}
+	if f.set.Arg(0) == healthcheckCommand && !f.healthcheck {
+		f.healthcheck = true
+		if err := f.set.Parse(f.set.Args()[1:]); err != nil {
+			return err
+		}
+	}
+	if f.set.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", f.set.Arg(0))
+	}
+
+	set := make(map[string]bool)
+	f.set.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+
+	var errs []error
+	f.set.VisitAll(func(fl *flag.Flag) {
+		value, ok := os.LookupEnv(envName(fl.Name))
+		if !ok || set[fl.Name] {
+			return
+		}
+		set[fl.Name] = true
+		if err := f.set.Set(fl.Name, value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value %q for %s: %w", value, envName(fl.Name), err))
+		}
+	})
+	if len(errs) == 0 && f.configFile != nil && *f.configFile != "" {
+		errs = append(errs, f.readConfigFile(*f.configFile, set))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	for _, check := range f.checks {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Healthcheck reports whether the command line asks for a healthcheck, in
+// which case the command should check on the instance of itself that its
+// configuration describes, with CheckHealth, instead of starting one.
+func (f *Flags) Healthcheck() bool {
+	return f.healthcheck
+}
+
+// readConfigFile sets the flags named in the config file at path, except
+// for those that are already set.
+func (f *Flags) readConfigFile(path string, set map[string]bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var settings map[string]json.RawMessage
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(settings)) {
+		if f.set.Lookup(name) == nil || name == "config-file" {
+			errs = append(errs, fmt.Errorf("unknown setting %q in %s", name, path))
+			continue
+		}
+		if set[name] {
+			continue
+		}
+		value, err := settingValue(settings[name])
+		if err == nil {
+			err = f.set.Set(name, value)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid value for %q in %s: %w", name, path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// settingValue returns a value from the config file as a flag would be given
+// it on the command line.
+func settingValue(raw json.RawMessage) (string, error) {
+	var value any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", err
+	}
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case float64, bool:
+		return string(raw), nil
+	}
+	return "", errors.New("expected a string, number or boolean")
+}
+
+// changedSince returns the names of the flags whose values differ from
+// those of old, which must define the same flags.
+func (f *Flags) changedSince(old *Flags) []string {
+	var changed []string
+	f.set.VisitAll(func(fl *flag.Flag) {
+		if fl.Value.String() != old.set.Lookup(fl.Name).Value.String() {
+			changed = append(changed, fl.Name)
+		}
+	})
+	return changed
+}
+
+// value returns the named flag's value as it would be given on the command
+// line.
+func (f *Flags) value(name string) string {
+	return f.set.Lookup(name).Value.String()
+}
+
+// CheckListenAddr reports whether addr is a valid "host:port" or
+// "unix:path" address to listen on.
+func CheckListenAddr(addr string) error {
+	if path, ok := strings.CutPrefix(addr, unixPrefix); ok {
+		if path == "" {
+			return errors.New("missing unix socket path")
+		}
+		return nil
+	}
+	return checkHostPort(addr)
+}
+
+func checkHostPort(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+func checkDialAddr(addr string) error {
+	if err := checkHostPort(addr); err != nil {
+		return err
+	}
+	host, port, _ := net.SplitHostPort(addr)
+	if host == "" {
+		return errors.New("missing host")
+	}
+	if port == "0" {
+		return errors.New("port 0 can't be dialled")
+	}
+	return nil
+}
+
+type textValue struct {
+	p    encoding.TextUnmarshaler
+	text string // As last set, for values that can't describe themselves
+}
+
+// String shows defaults that have a name, such as a ProxyProtocolMode.
+func (v *textValue) String() string {
+	if stringer, ok := v.p.(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return v.text
+}
+
+func (v *textValue) Set(s string) error {
+	if err := v.p.UnmarshalText([]byte(s)); err != nil {
+		return err
+	}
+	v.text = s
+	return nil
+}
+
+type addrValue struct {
+	p        *string
+	optional bool
+	check    func(addr string) error
+}
+
+func (v *addrValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return *v.p
+}
+
+func (v *addrValue) Set(s string) error {
+	if s != "" || !v.optional {
+		if err := v.check(s); err != nil {
+			return err
+		}
+	}
+	*v.p = s
+	return nil
+}
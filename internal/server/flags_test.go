@@ -0,0 +1,135 @@
+package server
+
+import (
+	"flag"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testFlags returns flags for a Config that report errors instead of
+// exiting.
+func testFlags(config *Config) *Flags {
+	flags := newFlags("test", flag.ContinueOnError)
+	flags.set.SetOutput(io.Discard)
+	config.AddFlags(flags)
+	config.AddListenFlags(flags, ":8080")
+	config.AddLimitFlags(flags)
+	config.AddTCPFlags(flags)
+	return flags
+}
+
+// writeConfigFile writes a config file for the test and returns its path.
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal("Error writing config file:", err)
+	}
+	return path
+}
+
+func TestFlagsFallBackToEnvironment(t *testing.T) {
+	t.Setenv("LISTEN_ADDR", ":9000")
+	t.Setenv("METRICS_ADDR", ":9100")
+	t.Setenv("PROXY_PROTOCOL", "strict")
+	t.Setenv("SOCKET_OPTIONS", "keepalive=30s")
+	t.Setenv("INIT", "true")
+
+	var config Config
+	if err := testFlags(&config).Parse([]string{"-listen-addr", "127.0.0.1:9001", "-ip-version=6"}); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if config.Addr != "127.0.0.1:9001" {
+		t.Fatalf("Expected the command line to win over the environment, got %q", config.Addr)
+	}
+	if config.MetricsAddr != ":9100" || config.ProxyProtocol != ProxyProtocolStrict ||
+		config.SocketOptions.KeepAlive != 30*time.Second || !config.Init {
+		t.Fatalf("Expected settings from the environment, got %+v", config)
+	}
+	if config.AdminAddr != "" || config.LogFormat != "text" || config.DrainTimeout != DefaultDrainTimeout {
+		t.Fatalf("Expected defaults for the rest, got %+v", config)
+	}
+	if options := config.socketOptions(); options.IPVersion != IPv6Only || options.KeepAlive != 30*time.Second {
+		t.Fatalf("Expected the IP version to be added to the socket options, got %+v", options)
+	}
+}
+
+func TestFlagsReadConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `{
+		"listen-addr": ":9000",
+		"metrics-addr": ":9100",
+		"max-conns": 10,
+		"idle-timeout": "5m",
+		"log-level": "debug"
+	}`)
+	t.Setenv("METRICS_ADDR", ":9200")
+
+	var config Config
+	if err := testFlags(&config).Parse([]string{"-config-file", path, "-listen-addr", ":9001"}); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if config.Addr != ":9001" || config.MetricsAddr != ":9200" {
+		t.Fatalf("Expected the command line and environment to win over the file, got %+v", config)
+	}
+	if config.Limits.MaxConns != 10 || config.Limits.IdleTimeout != 5*time.Minute || config.LogLevel != slog.LevelDebug {
+		t.Fatalf("Expected settings from the file, got %+v", config)
+	}
+
+	for _, contents := range []string{
+		`{"listen-adr": ":9000"}`,
+		`{"max-conns": "many"}`,
+		`{"max-conns": [1]}`,
+		`{"config-file": "other.json"}`,
+		`not json`,
+	} {
+		var config Config
+		if err := testFlags(&config).Parse([]string{"-config-file", writeConfigFile(t, contents)}); err == nil {
+			t.Errorf("Expected an error for %s", contents)
+		}
+	}
+}
+
+func TestFlagsValidateValues(t *testing.T) {
+	tests := map[string]struct {
+		args []string
+		env  map[string]string
+	}{
+		"port out of range":    {args: []string{"-listen-addr", ":65536"}},
+		"missing port":         {args: []string{"-listen-addr", "localhost"}},
+		"missing socket path":  {args: []string{"-listen-addr", "unix:"}},
+		"required address":     {args: []string{"-listen-addr", ""}},
+		"unknown IP version":   {args: []string{"-ip-version", "5"}},
+		"positional argument":  {args: []string{"8080"}},
+		"invalid environment":  {env: map[string]string{"PROXY_PROTOCOL": "sometimes"}},
+		"unix metrics address": {env: map[string]string{"METRICS_ADDR": "unix:/tmp/metrics.sock"}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			var config Config
+			if err := testFlags(&config).Parse(tt.args); err == nil {
+				t.Fatalf("Expected an error, got %+v", config)
+			}
+		})
+	}
+}
+
+func TestCheckDialAddr(t *testing.T) {
+	for addr, valid := range map[string]bool{
+		"chat.protohackers.com:16963": true,
+		"[::1]:8080":                  true,
+		":8080":                       false,
+		"localhost:0":                 false,
+		"localhost":                   false,
+	} {
+		if err := checkDialAddr(addr); (err == nil) != valid {
+			t.Errorf("Address %q: expected valid %v, got %v", addr, valid, err)
+		}
+	}
+}
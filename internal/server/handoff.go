@@ -0,0 +1,70 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Environment variables, alongside LISTEN_FDS and LISTEN_FDNAMES, with which
+// Handoff passes its sockets to the new process.
+const (
+	handoffParentEnv = "HANDOFF_PARENT_PID"
+	handoffReadyEnv  = "HANDOFF_READY_FD"
+)
+
+// ErrHandedOff is the cause with which SignalContext cancels its context once
+// the process has handed its sockets to a new one, which makes Serve drain
+// its connections for DrainTimeout rather than ShutdownTimeout.
+//
+// Only the sockets are handed off: state a service keeps in memory, such as
+// the speed daemon's observations, starts out empty in the new process.
+var ErrHandedOff = errors.New("sockets handed off to a new process")
+
+// DefaultHandoffTimeout is how long Handoff waits for the new process to
+// start serving before giving up on it.
+const DefaultHandoffTimeout = 30 * time.Second
+
+// fileSocket is a listener or packet conn whose file descriptor can be passed
+// to another process, such as *net.TCPListener or *net.UDPConn.
+type fileSocket interface {
+	File() (*os.File, error)
+}
+
+// liveSockets are the sockets of the servers currently serving in this
+// process, keyed by server, which Handoff passes on.
+var liveSockets = struct {
+	sync.Mutex
+	m map[any]namedSocket
+}{m: make(map[any]namedSocket)}
+
+type namedSocket struct {
+	name   string
+	socket fileSocket
+}
+
+func registerSocket(owner any, name string, socket any) {
+	if fs, ok := socket.(fileSocket); ok {
+		liveSockets.Lock()
+		liveSockets.m[owner] = namedSocket{name, fs}
+		liveSockets.Unlock()
+	}
+}
+
+func unregisterSocket(owner any) {
+	liveSockets.Lock()
+	delete(liveSockets.m, owner)
+	liveSockets.Unlock()
+}
+
+// handoffReadyFile returns the pipe on which the process that handed us its
+// sockets waits for us to start serving, if any.
+func handoffReadyFile(getenv func(string) string) *os.File {
+	fd, err := strconv.Atoi(getenv(handoffReadyEnv))
+	if err != nil {
+		return nil
+	}
+	return os.NewFile(uintptr(fd), "handoff-ready")
+}
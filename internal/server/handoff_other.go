@@ -0,0 +1,18 @@
+//go:build !unix
+
+package server
+
+import (
+	"context"
+	"errors"
+)
+
+// Handoff is only supported on unix systems, which can pass file
+// descriptors to child processes.
+func Handoff() error {
+	return errors.New("handoff is not supported on this platform")
+}
+
+func handoffOnSignal(ctx context.Context, handedOff func()) {}
+
+func becomeInit() {}
@@ -0,0 +1,98 @@
+//go:build unix
+
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// TestHandoffChild is the new process started by TestHandoff. It serves a
+// single connection on the socket it was handed.
+func TestHandoffChild(t *testing.T) {
+	if os.Getenv("HANDOFF_TEST_CHILD") == "" {
+		t.Skip("Only runs as the new process in TestHandoff")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s := NewServer("127.0.0.1:0", func(conn net.Conn) {
+		replyWith("child")(conn)
+		cancel()
+	})
+	s.Name = "handoff_test"
+	s.Serve(ctx)
+}
+
+func replyWith(reply string) Handler {
+	return func(conn net.Conn) {
+		defer conn.Close()
+		conn.Write([]byte(reply))
+	}
+}
+
+func withHandoffCommand(t *testing.T, exe string, args ...string) {
+	original := handoffCommand
+	handoffCommand = func() (string, []string, error) { return exe, append([]string{exe}, args...), nil }
+	t.Cleanup(func() { handoffCommand = original })
+}
+
+func TestHandoff(t *testing.T) {
+	s := NewServer("127.0.0.1:0", replyWith("parent"))
+	s.Name = "handoff_test"
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	addr := listener.Addr().String()
+
+	t.Setenv("HANDOFF_TEST_CHILD", "1")
+	withHandoffCommand(t, os.Args[0], "-test.run=^TestHandoffChild$")
+	if err := Handoff(); err != nil {
+		t.Fatal("Handoff failed:", err)
+	}
+
+	if err := s.Shutdown(t.Context()); err != nil {
+		t.Fatal("Error shutting down the old server:", err)
+	}
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal("Expected the new process to accept on the same address:", err)
+	}
+	defer conn.Close()
+	if reply, _ := io.ReadAll(conn); string(reply) != "child" {
+		t.Fatalf("Expected the new process to serve the connection, got %q", reply)
+	}
+}
+
+func TestHandoffFailsIfNewProcessDoesNotServe(t *testing.T) {
+	s := NewServer("127.0.0.1:0", replyWith("parent"))
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	exe, err := exec.LookPath("true")
+	if err != nil {
+		t.Skip("No true command to start")
+	}
+	withHandoffCommand(t, exe)
+	if err := Handoff(); err == nil {
+		t.Fatal("Expected an error when the new process exits without serving")
+	}
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Expected the old process to keep serving:", err)
+	}
+	defer conn.Close()
+	if reply, _ := io.ReadAll(conn); string(reply) != "parent" {
+		t.Fatalf("Expected the old process to serve the connection, got %q", reply)
+	}
+}
@@ -0,0 +1,177 @@
+//go:build unix
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// HandoffSignal makes a process using SignalContext hand its sockets over
+// to a new copy of itself and then shut down.
+const HandoffSignal = syscall.SIGUSR2
+
+// handoffCommand returns the executable and arguments of the new process:
+// the running executable with the same arguments.
+var handoffCommand = func() (string, []string, error) {
+	exe, err := os.Executable()
+	return exe, os.Args, err
+}
+
+// Handoff starts a new copy of the running executable and passes it the
+// listening sockets of every server in this process, so that it can accept
+// on them without rebinding. It returns once the new process has adopted a
+// socket, after which the caller should shut its servers down to let them
+// drain. As both processes accept from the same sockets in the meantime, no
+// client is refused.
+//
+// The new process must outlive this one, so this only works where the
+// service isn't the process its supervisor watches, or where it is PID 1
+// and was started with -init, which keeps it behind as an init (see
+// Config.SignalContext). Only the sockets are passed on, not whatever state
+// the service keeps in memory.
+func Handoff() error {
+	liveSockets.Lock()
+	sockets := make([]namedSocket, 0, len(liveSockets.m))
+	for _, socket := range liveSockets.m {
+		sockets = append(sockets, socket)
+	}
+	liveSockets.Unlock()
+	if len(sockets) == 0 {
+		return errors.New("no sockets to hand off")
+	}
+
+	// The new process gets stdio, the sockets and the write end of a pipe
+	// on which it reports that it is serving.
+	fds := []uintptr{os.Stdin.Fd(), os.Stdout.Fd(), os.Stderr.Fd()}
+	names := make([]string, 0, len(sockets))
+	for _, socket := range sockets {
+		f, err := socket.socket.File()
+		if err != nil {
+			return fmt.Errorf("handing off %s: %w", socket.name, err)
+		}
+		defer f.Close()
+		fd, err := rawFd(f)
+		if err != nil {
+			return fmt.Errorf("handing off %s: %w", socket.name, err)
+		}
+		fds = append(fds, fd)
+		names = append(names, socket.name)
+	}
+
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyReader.Close()
+	fds = append(fds, readyWriter.Fd())
+
+	exe, args, err := handoffCommand()
+	if err != nil {
+		return err
+	}
+	env := append(environWithout(os.Environ(), "LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES", handoffParentEnv, handoffReadyEnv),
+		"LISTEN_FDS="+strconv.Itoa(len(sockets)),
+		"LISTEN_FDNAMES="+strings.Join(names, ":"),
+		handoffParentEnv+"="+strconv.Itoa(os.Getpid()),
+		handoffReadyEnv+"="+strconv.Itoa(listenFdsStart+len(sockets)),
+	)
+
+	// os/exec would switch the sockets to blocking mode by way of os.File.Fd,
+	// which our listeners would inherit as they share file status flags.
+	pid, err := syscall.ForkExec(exe, args, &syscall.ProcAttr{Env: env, Files: fds})
+	readyWriter.Close() // Only the child's copy remains, so we see EOF if it dies
+	if err != nil {
+		return err
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+
+	ready := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(readyReader, make([]byte, 1))
+		ready <- err
+	}()
+	select {
+	case err = <-ready:
+	case <-time.After(DefaultHandoffTimeout):
+		err = errors.New("timed out")
+	}
+	if err != nil {
+		process.Kill()
+		process.Wait()
+		return fmt.Errorf("new process did not start serving: %w", err)
+	}
+	go process.Wait()
+
+	for _, socket := range sockets {
+		if unix, ok := socket.socket.(*net.UnixListener); ok {
+			unix.SetUnlinkOnClose(false) // The socket file now belongs to the new process
+		}
+	}
+	slog.Info("Handed sockets off to new process", "pid", pid, "sockets", len(sockets))
+	return nil
+}
+
+// rawFd returns f's descriptor without the switch to blocking mode that
+// f.Fd() makes.
+func rawFd(f *os.File) (uintptr, error) {
+	raw, err := f.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var fd uintptr
+	err = raw.Control(func(sysfd uintptr) { fd = sysfd })
+	return fd, err
+}
+
+func environWithout(env []string, keys ...string) []string {
+	filtered := env[:0:0]
+	for _, kv := range env {
+		key, _, _ := strings.Cut(kv, "=")
+		if !slices.Contains(keys, key) {
+			filtered = append(filtered, kv)
+		}
+	}
+	return filtered
+}
+
+// handoffOnSignal calls Handoff whenever HandoffSignal arrives and calls
+// handedOff once it succeeds, which shuts the servers down.
+//
+// Once the process is on its way out, it ignores HandoffSignal and SIGHUP
+// from then on: an init signals every process in the group, and reloads and
+// handoffs are the business of the one that took over, while their default
+// action would kill this one before it has drained.
+func handoffOnSignal(ctx context.Context, handedOff func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, HandoffSignal)
+	defer signal.Ignore(syscall.SIGHUP, HandoffSignal)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+		}
+		if err := Handoff(); err != nil {
+			slog.Error("Handoff failed, carrying on serving", "err", err)
+			continue
+		}
+		handedOff()
+		return
+	}
+}
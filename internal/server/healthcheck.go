@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// healthcheckCommand is the subcommand that checks on a running instance of
+// a command instead of starting one, as in "smoketest healthcheck".
+const healthcheckCommand = "healthcheck"
+
+// healthcheckTimeout bounds a whole healthcheck, connecting included, unless
+// the check itself extends its connection's deadline.
+const healthcheckTimeout = 5 * time.Second
+
+// HealthCheck performs a protocol exchange with a running service over conn
+// and returns an error unless the service answers as it should. conn's
+// deadline is already set.
+type HealthCheck func(conn net.Conn) error
+
+// CheckHealth connects to the TCP service listening on addr, as a client on
+// the same host would, and runs check on the connection. A wildcard host, as
+// in ":8080", stands for the loopback address. If the service expects PROXY
+// protocol headers, the connection sends one that leaves its addresses as
+// they are, and if the service terminates TLS, the check runs over TLS.
+func (c *Config) CheckHealth(addr string, check HealthCheck) error {
+	network, addr := c.healthcheckTarget("tcp", addr)
+	return dialHealthCheck(network, addr, func(conn net.Conn) error {
+		if c.ProxyProtocol != ProxyProtocolOff {
+			if _, err := conn.Write([]byte("PROXY UNKNOWN\r\n")); err != nil {
+				return err
+			}
+		}
+		if c.tlsConfig != nil {
+			tlsConn := tls.Client(conn, c.healthcheckTLSConfig())
+			if err := tlsConn.Handshake(); err != nil {
+				return fmt.Errorf("TLS handshake: %w", err)
+			}
+			conn = tlsConn
+		}
+		return check(conn)
+	})
+}
+
+// CheckUdpHealth is like CheckHealth for a UDP service. conn sends and
+// receives a datagram per Write and Read.
+func (c *Config) CheckUdpHealth(addr string, check HealthCheck) error {
+	network, addr := c.healthcheckTarget("udp", addr)
+	return dialHealthCheck(network, addr, check)
+}
+
+func dialHealthCheck(network, addr string, check HealthCheck) error {
+	ctx, cancel := context.WithTimeout(context.Background(), healthcheckTimeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	if err := check(conn); err != nil {
+		return fmt.Errorf("%s %s: %w", network, addr, err)
+	}
+	return nil
+}
+
+// healthcheckTarget returns the network and address to dial to reach a
+// service listening on addr.
+func (c *Config) healthcheckTarget(network, addr string) (string, string) {
+	if path, ok := strings.CutPrefix(addr, unixPrefix); ok {
+		return "unix", path
+	}
+	network = c.socketOptions().network(network)
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return network, addr
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		switch {
+		case c.IPVersion == IPv6Only || (ip != nil && ip.To4() == nil):
+			host = "::1"
+		case c.IPVersion == IPv4Only || ip != nil:
+			host = "127.0.0.1"
+		default:
+			host = "localhost"
+		}
+	}
+	return network, net.JoinHostPort(host, port)
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestFlagsParseHealthcheck(t *testing.T) {
+	for _, args := range [][]string{
+		{"healthcheck", "-listen-addr", ":9000"},
+		{"-listen-addr", ":9000", "healthcheck"},
+	} {
+		var config Config
+		flags := testFlags(&config)
+		if err := flags.Parse(args); err != nil {
+			t.Fatalf("Unexpected error for %q: %v", args, err)
+		}
+		if !flags.Healthcheck() || config.Addr != ":9000" {
+			t.Fatalf("Expected a healthcheck of :9000 for %q, got %v and %q", args, flags.Healthcheck(), config.Addr)
+		}
+	}
+
+	var config Config
+	if err := testFlags(&config).Parse([]string{"healthcheck", "healthcheck"}); err == nil {
+		t.Fatal("Expected an error for a repeated subcommand")
+	}
+	flags := testFlags(&config)
+	if err := flags.Parse(nil); err != nil || flags.Healthcheck() {
+		t.Fatalf("Expected no healthcheck by default, got %v and %v", flags.Healthcheck(), err)
+	}
+}
+
+func TestHealthcheckTarget(t *testing.T) {
+	tests := []struct {
+		config  Config
+		addr    string
+		network string
+		target  string
+	}{
+		{Config{}, ":8080", "tcp", "localhost:8080"},
+		{Config{}, "0.0.0.0:8080", "tcp", "127.0.0.1:8080"},
+		{Config{}, "[::]:8080", "tcp", "[::1]:8080"},
+		{Config{}, "10.0.0.1:8080", "tcp", "10.0.0.1:8080"},
+		{Config{IPVersion: IPv4Only}, ":8080", "tcp4", "127.0.0.1:8080"},
+		{Config{IPVersion: IPv6Only}, ":8080", "tcp6", "[::1]:8080"},
+		{Config{}, "unix:/run/smoketest.sock", "unix", "/run/smoketest.sock"},
+	}
+	for _, tt := range tests {
+		network, target := tt.config.healthcheckTarget("tcp", tt.addr)
+		if network != tt.network || target != tt.target {
+			t.Errorf("Address %q with IP version %s: expected %s %s, got %s %s",
+				tt.addr, tt.config.IPVersion, tt.network, tt.target, network, target)
+		}
+	}
+}
+
+func TestCheckHealthSendsProxyHeader(t *testing.T) {
+	addr := startProxied(t, ProxyProtocolStrict)
+	_, port, _ := net.SplitHostPort(addr.String())
+
+	check := func(conn net.Conn) error {
+		conn.Write([]byte("hello\n"))
+		reader := bufio.NewReader(conn)
+		reader.ReadString('\n') // The address the server saw
+		echo, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if echo != "hello\n" {
+			return errors.New("unexpected echo " + echo)
+		}
+		return nil
+	}
+	config := Config{ProxyProtocol: ProxyProtocolStrict, IPVersion: IPv4Only}
+	if err := config.CheckHealth(":"+port, check); err != nil {
+		t.Fatal("Expected a healthy server:", err)
+	}
+	config.ProxyProtocol = ProxyProtocolOff
+	if err := config.CheckHealth(":"+port, check); err == nil {
+		t.Fatal("Expected a server that requires a PROXY header to reject a healthcheck without one")
+	}
+}
+
+func TestCheckUdpHealth(t *testing.T) {
+	s, err := StartUdpListener("127.0.0.1:0", udpEcho)
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer s.Close()
+
+	var config Config
+	err = config.CheckUdpHealth(s.LocalAddr().String(), func(conn net.Conn) error {
+		conn.Write([]byte("ping"))
+		buf := make([]byte, 16)
+		n, err := conn.Read(buf)
+		if err == nil && string(buf[:n]) != "ping" {
+			err = errors.New("unexpected reply " + string(buf[:n]))
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal("Expected a healthy server:", err)
+	}
+
+	err = config.CheckUdpHealth(s.LocalAddr().String(), func(net.Conn) error {
+		return errors.New("no version")
+	})
+	if err == nil || !strings.Contains(err.Error(), "no version") {
+		t.Fatalf("Expected the check's error, got %v", err)
+	}
+}
+
+func TestCheckUdpHealthPassesAllowlist(t *testing.T) {
+	var config Config
+	if err := config.UdpGuard.UnmarshalText([]byte("allow=10.0.0.0/8,rate=20")); err != nil {
+		t.Fatal("Error parsing UDP guard:", err)
+	}
+	s := NewUdpServer("127.0.0.1:0", udpEcho)
+	config.ConfigureUdp(s)
+	if err := s.Start(); err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer s.Close()
+
+	err := config.CheckUdpHealth(s.LocalAddr().String(), func(conn net.Conn) error {
+		conn.Write([]byte("ping"))
+		_, err := conn.Read(make([]byte, 16))
+		return err
+	})
+	if err != nil {
+		t.Fatal("Expected the healthcheck to get past the allowlist:", err)
+	}
+}
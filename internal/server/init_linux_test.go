@@ -0,0 +1,124 @@
+package server
+
+import (
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// prSetChildSubreaper makes the calling process adopt its orphaned
+// descendants, as PID 1 does, so that the test needn't run as PID 1.
+const prSetChildSubreaper = 36
+
+// TestInitHelper is the init started by TestInitKeepsServingThroughHandoff,
+// and the service that init starts, which replies to each connection with
+// its pid.
+func TestInitHelper(t *testing.T) {
+	path := os.Getenv("INIT_TEST_SOCKET")
+	switch os.Getenv("INIT_TEST_ROLE") {
+	case "init":
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 1, 0); errno != 0 {
+			t.Fatal("Error becoming a subreaper:", errno)
+		}
+		env := environWithout(os.Environ(), "INIT_TEST_ROLE")
+		os.Exit(runInit(os.Args[0], os.Args, append(env, "INIT_TEST_ROLE=service")))
+	case "service":
+		ctx, stop := SignalContext()
+		defer stop()
+		s := NewServer("unix:"+path, replyWith(strconv.Itoa(os.Getpid())))
+		s.Name = "init_test"
+		s.Serve(ctx)
+	default:
+		t.Skip("Only runs as a process started by TestInitKeepsServingThroughHandoff")
+	}
+}
+
+// askPid connects to the service on path and returns the pid it replies with.
+func askPid(path string) (string, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reply, err := io.ReadAll(conn)
+	return string(reply), err
+}
+
+func TestInitKeepsServingThroughHandoff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "init.sock")
+	initProcess := exec.Command(os.Args[0], "-test.run=^TestInitHelper$")
+	initProcess.Env = append(os.Environ(), "INIT_TEST_ROLE=init", "INIT_TEST_SOCKET="+path)
+	if err := initProcess.Start(); err != nil {
+		t.Fatal("Error starting init:", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- initProcess.Wait() }()
+	defer initProcess.Process.Kill()
+
+	var first string
+	for deadline := time.Now().Add(10 * time.Second); first == ""; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Service never started serving")
+		}
+		first, _ = askPid(path)
+	}
+
+	// Keep connecting throughout the handoff, as clients would
+	var refused atomic.Int64
+	var lastErr atomic.Value
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if _, err := askPid(path); err != nil {
+				refused.Add(1)
+				lastErr.Store(err)
+			}
+		}
+	}()
+
+	initProcess.Process.Signal(HandoffSignal)
+	var next string
+	for deadline := time.Now().Add(10 * time.Second); next == "" || next == first; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("New process never took over")
+		}
+		next, _ = askPid(path)
+	}
+	time.Sleep(200 * time.Millisecond) // Let the old process finish draining
+	close(done)
+	<-stopped
+
+	if n := refused.Load(); n > 0 {
+		t.Fatalf("%d connections failed during the handoff, the last with: %v", n, lastErr.Load())
+	}
+	select {
+	case err := <-exited:
+		t.Fatal("Init exited with the process that handed off:", err)
+	default:
+	}
+
+	initProcess.Process.Signal(syscall.SIGTERM)
+	select {
+	case err := <-exited:
+		if err != nil {
+			t.Fatal("Expected init to exit cleanly once the service stopped:", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Init did not exit after SIGTERM")
+	}
+}
@@ -0,0 +1,72 @@
+//go:build unix
+
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// becomeInit keeps a process that is PID 1, as a container's entrypoint is,
+// behind as the container's init while a copy of itself serves, and exits
+// with the copy's status without returning. Otherwise it does nothing.
+//
+// The container lives as long as PID 1 does, so without this a Handoff would
+// stop the container, and the new process with it, as soon as the old one
+// exits.
+func becomeInit() {
+	if os.Getpid() != 1 {
+		return
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		slog.Error("Error starting the service as a child of init", "err", err)
+		os.Exit(1)
+	}
+	os.Exit(runInit(exe, os.Args, os.Environ()))
+}
+
+// runInit starts exe in a process group of its own and forwards the signals
+// that SignalContext and WatchConfig handle to that group, which the new
+// processes that handoffs start inherit. It reaps the children it starts and,
+// as PID 1 or a subreaper, the orphans that each handoff leaves behind, and
+// returns the exit code of the last of them once none are left.
+func runInit(exe string, args, env []string) int {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, HandoffSignal)
+	defer signal.Stop(signals)
+
+	pid, err := syscall.ForkExec(exe, args, &syscall.ProcAttr{
+		Env:   env,
+		Files: []uintptr{os.Stdin.Fd(), os.Stdout.Fd(), os.Stderr.Fd()},
+		Sys:   &syscall.SysProcAttr{Setpgid: true},
+	})
+	if err != nil {
+		slog.Error("Error starting the service as a child of init", "err", err)
+		return 1
+	}
+	go func() {
+		for sig := range signals {
+			syscall.Kill(-pid, sig.(syscall.Signal))
+		}
+	}()
+
+	code := 0
+	for {
+		var status syscall.WaitStatus
+		_, err := syscall.Wait4(-1, &status, 0, nil)
+		switch {
+		case errors.Is(err, syscall.EINTR):
+			continue
+		case err != nil: // ECHILD, once every process is gone
+			return code
+		case status.Signaled():
+			code = 128 + int(status.Signal())
+		default:
+			code = status.ExitStatus()
+		}
+	}
+}
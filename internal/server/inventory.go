@@ -0,0 +1,141 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ConnInfo describes a live connection.
+type ConnInfo struct {
+	ID           uint64    `json:"id"`
+	Service      string    `json:"service"`
+	RemoteAddr   string    `json:"remote_addr"`
+	Label        string    `json:"label,omitempty"`
+	Started      time.Time `json:"started"`
+	LastActivity time.Time `json:"last_activity"`
+	BytesRead    int64     `json:"bytes_read"`
+	BytesWritten int64     `json:"bytes_written"`
+}
+
+// liveConns are the connections being handled by the servers in this
+// process, keyed by connection ID.
+var liveConns = struct {
+	sync.Mutex
+	m map[uint64]*liveConn
+}{m: make(map[uint64]*liveConn)}
+
+type liveConn struct {
+	service string
+	conn    net.Conn // As passed to the handler
+	started time.Time
+	label   string
+}
+
+// trackConn adds conn, as passed to the handler, to the live connections
+// until the returned function is called.
+func trackConn(service string, conn net.Conn) (untrack func()) {
+	id := ConnID(conn)
+	liveConns.Lock()
+	liveConns.m[id] = &liveConn{service: service, conn: conn, started: time.Now()}
+	liveConns.Unlock()
+
+	return func() {
+		liveConns.Lock()
+		delete(liveConns.m, id)
+		liveConns.Unlock()
+	}
+}
+
+// SetConnLabel attaches a label to a live connection, such as the name of a
+// chat user, to tell it apart in Conns.
+func SetConnLabel(conn net.Conn, label string) {
+	liveConns.Lock()
+	defer liveConns.Unlock()
+	if live, ok := liveConns.m[ConnID(conn)]; ok {
+		live.label = label
+	}
+}
+
+// Conns lists the live connections of every server in the process, oldest
+// first.
+func Conns() []ConnInfo {
+	liveConns.Lock()
+	defer liveConns.Unlock()
+
+	conns := make([]ConnInfo, 0, len(liveConns.m))
+	for id, live := range liveConns.m {
+		info := ConnInfo{
+			ID:           id,
+			Service:      live.service,
+			RemoteAddr:   live.conn.RemoteAddr().String(),
+			Label:        live.label,
+			Started:      live.started,
+			LastActivity: live.started,
+		}
+		if counting, ok := find[*countingConn](live.conn); ok {
+			info.BytesRead, info.BytesWritten = counting.read.Load(), counting.written.Load()
+			if active := counting.lastActive(); active.After(info.LastActivity) {
+				info.LastActivity = active
+			}
+		}
+		conns = append(conns, info)
+	}
+	slices.SortFunc(conns, func(a, b ConnInfo) int { return cmp.Compare(a.ID, b.ID) })
+	return conns
+}
+
+// CloseConn forcibly closes the live connection with the given ID, which
+// makes its handler's reads and writes fail. It reports whether there was
+// such a connection.
+func CloseConn(id uint64) bool {
+	liveConns.Lock()
+	live, ok := liveConns.m[id]
+	liveConns.Unlock()
+	if !ok {
+		return false
+	}
+	Logger(live.conn).Warn("Closing connection on request")
+	live.conn.Close()
+	return true
+}
+
+// AdminHandler serves the live connections: GET /connections lists them as
+// JSON, optionally only those of ?service=, and DELETE /connections/{id}
+// closes one.
+func AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /connections", func(w http.ResponseWriter, r *http.Request) {
+		conns := Conns()
+		if service := r.URL.Query().Get("service"); service != "" {
+			conns = slices.DeleteFunc(conns, func(c ConnInfo) bool { return c.Service != service })
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(conns)
+	})
+	mux.HandleFunc("DELETE /connections/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid connection ID", http.StatusBadRequest)
+			return
+		}
+		if !CloseConn(id) {
+			http.Error(w, "No such connection", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+// ServeAdmin serves AdminHandler on addr until ctx is cancelled. Anyone who
+// can reach it can disconnect clients, so bind it to a private address.
+func ServeAdmin(ctx context.Context, addr string) error {
+	return ServeEndpoint(ctx, "admin", addr, AdminHandler())
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// listConns fetches the live connections of service from the admin handler.
+func listConns(t *testing.T, admin http.Handler, service string) []ConnInfo {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/connections?service="+service, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rec.Code, rec.Body)
+	}
+	var conns []ConnInfo
+	if err := json.NewDecoder(rec.Body).Decode(&conns); err != nil {
+		t.Fatal("Error decoding connections:", err)
+	}
+	return conns
+}
+
+func TestAdminListsAndClosesConns(t *testing.T) {
+	closed := make(chan struct{})
+	s := NewServer("127.0.0.1:0", func(conn net.Conn) {
+		defer close(closed)
+		scanner := bufio.NewScanner(conn)
+		scanner.Scan()
+		SetConnLabel(conn, scanner.Text())
+		conn.Write([]byte("welcome\n"))
+		for scanner.Scan() {
+		}
+	})
+	s.Name = "inventory_test"
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("alice\n"))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+		t.Fatal("Expected a welcome:", err)
+	}
+
+	admin := AdminHandler()
+	conns := listConns(t, admin, "inventory_test")
+	if len(conns) != 1 {
+		t.Fatalf("Expected one connection, got %+v", conns)
+	}
+	info := conns[0]
+	if info.Label != "alice" || info.RemoteAddr != conn.LocalAddr().String() ||
+		info.BytesRead != 6 || info.BytesWritten != 8 || info.LastActivity.Before(info.Started) {
+		t.Fatalf("Unexpected connection info %+v", info)
+	}
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/connections/"+strconv.FormatUint(info.ID, 10), nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 No Content, got %d: %s", rec.Code, rec.Body)
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the handler to return once its connection was closed")
+	}
+	waitForConns(t, s, 0)
+	if conns := listConns(t, admin, "inventory_test"); len(conns) != 0 {
+		t.Fatalf("Expected the connection to be gone, got %+v", conns)
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/connections/"+strconv.FormatUint(info.ID, 10), nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 for a closed connection, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import "time"
+
+// Limits are a Server's connection limits and timeouts: the settings that
+// SetLimits can change while it runs.
+type Limits struct {
+	MaxConns         int
+	MaxConnsPerIP    int
+	HandshakeTimeout time.Duration
+	IdleTimeout      time.Duration
+	WriteTimeout     time.Duration
+}
+
+// SetLimits overrides the server's limits while it runs, such as when its
+// configuration is reloaded. Positive fields of l take the place of the
+// Server's fields of the same name, negative ones lift the limit or disable
+// the timeout, and zero ones leave the Server's own. Connections accepted
+// from then on get the new limits; those already being handled keep theirs.
+func (s *Server) SetLimits(l Limits) {
+	s.overrides.Store(&l)
+}
+
+// limits returns the limits in effect.
+func (s *Server) limits() Limits {
+	if s.parent != nil {
+		return s.parent.limits()
+	}
+	l := Limits{
+		MaxConns:         s.MaxConns,
+		MaxConnsPerIP:    s.MaxConnsPerIP,
+		HandshakeTimeout: s.HandshakeTimeout,
+		IdleTimeout:      s.IdleTimeout,
+		WriteTimeout:     s.WriteTimeout,
+	}
+	if o := s.overrides.Load(); o != nil {
+		l.MaxConns = override(l.MaxConns, o.MaxConns)
+		l.MaxConnsPerIP = override(l.MaxConnsPerIP, o.MaxConnsPerIP)
+		l.HandshakeTimeout = override(l.HandshakeTimeout, o.HandshakeTimeout)
+		l.IdleTimeout = override(l.IdleTimeout, o.IdleTimeout)
+		l.WriteTimeout = override(l.WriteTimeout, o.WriteTimeout)
+	}
+	return l
+}
+
+func override[T int | time.Duration](value, override T) T {
+	switch {
+	case override > 0:
+		return override
+	case override < 0:
+		return 0
+	}
+	return value
+}
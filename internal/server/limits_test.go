@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSetLimitsOverridesServer(t *testing.T) {
+	s := NewServer("", func(conn net.Conn) {
+		conn.Read(make([]byte, 1))
+		conn.Close()
+	})
+	s.MaxConns = 1
+	s.IdleTimeout = time.Minute
+	s.WriteTimeout = time.Second
+
+	s.SetLimits(Limits{MaxConns: 5, IdleTimeout: -1})
+	limits := s.limits()
+	if limits.MaxConns != 5 || limits.IdleTimeout != 0 || limits.WriteTimeout != time.Second {
+		t.Fatalf("Unexpected limits %+v", limits)
+	}
+
+	s.SetLimits(Limits{})
+	if limits := s.limits(); limits.MaxConns != 1 || limits.IdleTimeout != time.Minute {
+		t.Fatalf("Expected the server's own limits back, got %+v", limits)
+	}
+}
+
+func TestSetLimitsWhileRunning(t *testing.T) {
+	s := NewServer("127.0.0.1:0", func(conn net.Conn) {
+		conn.Read(make([]byte, 1))
+		conn.Close()
+	})
+	s.MaxConns = 1
+	s.RejectMessage = []byte("busy\n")
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer s.Shutdown(t.Context())
+
+	var conns []net.Conn
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	dial := func() {
+		t.Helper()
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal("Error connecting to server:", err)
+		}
+		conns = append(conns, conn)
+	}
+	dial()
+	waitForConns(t, s, 1)
+
+	s.SetLimits(Limits{MaxConns: 2})
+	dial()
+	waitForConns(t, s, 2)
+}
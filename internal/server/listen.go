@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// unixPrefix marks an address as the path of a unix domain socket, as in
+// "unix:/run/protohackers/chat.sock".
+const unixPrefix = "unix:"
+
+// listenStream binds a TCP or unix domain socket listener on addr.
+func (o SocketOptions) listenStream(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, unixPrefix); ok {
+		if err := removeStaleSocket(path); err != nil {
+			return nil, err
+		}
+		return o.listenConfig().Listen(context.Background(), "unix", path)
+	}
+	return o.listenConfig().Listen(context.Background(), o.network("tcp"), addr)
+}
+
+// removeStaleSocket removes a socket file left behind by a process that
+// didn't get to close its listener, which is one that refuses connections.
+// A socket that a running server accepts connections on is left to it, and
+// is reported as an address in use. Anything other than a socket is left
+// alone, so that binding fails instead of deleting someone's file.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode().Type() != fs.ModeSocket {
+		return nil
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	switch {
+	case err == nil:
+		conn.Close()
+		return fmt.Errorf("unix socket %s: %w", path, syscall.EADDRINUSE)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return os.Remove(path)
+	}
+	return fmt.Errorf("checking whether unix socket %s is in use: %w", path, err)
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync/atomic"
+)
+
+// nextConnID numbers connections across every server in the process, so IDs
+// stay unique even when several services share one log stream.
+var nextConnID atomic.Uint64
+
+// NewLogger returns a logger that writes to w in the given format ("text" or
+// "json") and drops records below the given level ("debug", "info", "warn"
+// or "error"). Empty values default to text and info.
+func NewLogger(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if level != "" {
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("invalid log level %q", level)
+		}
+	}
+	return newLogger(w, format, lvl)
+}
+
+func newLogger(w io.Writer, format string, level slog.Leveler) (*slog.Logger, error) {
+	options := &slog.HandlerOptions{Level: level}
+
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+}
+
+// Logger returns the logger for the connection, which attaches its ID and
+// remote address to every record. Connections that weren't accepted by a
+// Server get the default logger.
+func Logger(conn net.Conn) *slog.Logger {
+	if logged, ok := find[*loggedConn](conn); ok {
+		return logged.logger
+	}
+	return slog.Default()
+}
+
+// ConnID returns the ID the Server assigned to the connection, or 0.
+func ConnID(conn net.Conn) uint64 {
+	if logged, ok := find[*loggedConn](conn); ok {
+		return logged.id
+	}
+	return 0
+}
+
+type loggedConn struct {
+	net.Conn
+	id     uint64
+	logger *slog.Logger
+}
+
+func (s *Server) withLogger(conn net.Conn) net.Conn {
+	id := nextConnID.Add(1)
+	return &loggedConn{
+		Conn:   conn,
+		id:     id,
+		logger: s.logger().With("conn_id", id, "remote_addr", conn.RemoteAddr().String()),
+	}
+}
+
+func (s *Server) logger() *slog.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return slog.Default()
+}
+
+func (c *loggedConn) Unwrap() net.Conn { return c.Conn }
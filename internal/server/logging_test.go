@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, "json", "warn")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	logger.Info("dropped")
+	logger.Warn("kept", "key", "value")
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a single JSON record, got %q", buf.String())
+	}
+	if record["msg"] != "kept" || record["key"] != "value" {
+		t.Fatalf("Unexpected record %v", record)
+	}
+
+	if _, err := NewLogger(&buf, "xml", ""); err == nil {
+		t.Fatal("Expected an error for an unknown format")
+	}
+	if _, err := NewLogger(&buf, "", "loud"); err == nil {
+		t.Fatal("Expected an error for an unknown level")
+	}
+}
+
+func TestConnectionLoggerHasConnectionAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := NewLogger(&buf, "text", "debug")
+
+	logged := make(chan uint64, 1)
+	s := NewServer(":0", func(conn net.Conn) {
+		defer conn.Close()
+		Logger(conn).Info("hello from handler")
+		logged <- ConnID(conn)
+	})
+	s.Logger = logger
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Close()
+
+	id := <-logged
+	if id == 0 {
+		t.Fatal("Expected the connection to have an ID")
+	}
+
+	var line string
+	for l := range strings.Lines(buf.String()) {
+		if strings.Contains(l, "hello from handler") {
+			line = l
+		}
+	}
+	if !strings.Contains(line, "conn_id=") || !strings.Contains(line, "remote_addr="+conn.LocalAddr().String()) {
+		t.Fatalf("Expected connection attributes in %q", line)
+	}
+}
+
+func TestLoggerFallsBackToDefault(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	if Logger(server) == nil {
+		t.Fatal("Expected the default logger for unmanaged connections")
+	}
+	if ConnID(server) != 0 {
+		t.Fatal("Expected no ID for unmanaged connections")
+	}
+}
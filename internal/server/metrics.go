@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRegistry holds the metrics created with NewCounter, NewGauge and
+// NewGaugeFunc, and is what ServeMetrics exposes.
+var DefaultRegistry = NewRegistry()
+
+// Registry is a set of metrics that can be rendered in the Prometheus text
+// exposition format. Metrics are identified by their name and labels, and
+// asking for the same one twice returns the existing metric.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]*metric
+}
+
+type metric struct {
+	name   string
+	help   string
+	kind   string // "counter" or "gauge"
+	labels string // Rendered label set, e.g. {service="primetime"}
+	value  func() float64
+	impl   any // *Counter or *Gauge, nil for function-backed gauges
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]*metric)}
+}
+
+// Counter is a monotonically increasing integer value.
+type Counter struct{ v atomic.Int64 }
+
+func (c *Counter) Inc()           { c.v.Add(1) }
+func (c *Counter) Add(n int64)    { c.v.Add(n) }
+func (c *Counter) Value() int64   { return c.v.Load() }
+func (c *Counter) float() float64 { return float64(c.v.Load()) }
+
+// Gauge is an integer value that can go up and down.
+type Gauge struct{ v atomic.Int64 }
+
+func (g *Gauge) Inc()           { g.v.Add(1) }
+func (g *Gauge) Dec()           { g.v.Add(-1) }
+func (g *Gauge) Set(n int64)    { g.v.Store(n) }
+func (g *Gauge) Value() int64   { return g.v.Load() }
+func (g *Gauge) float() float64 { return float64(g.v.Load()) }
+
+// NewCounter returns the counter with the given name and labels from the
+// default registry, creating it if needed. Labels are key-value pairs.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return DefaultRegistry.Counter(name, help, labels...)
+}
+
+// NewGauge is like NewCounter, but for gauges.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return DefaultRegistry.Gauge(name, help, labels...)
+}
+
+// NewGaugeFunc registers a gauge whose value is computed by f at scrape time,
+// for values such as map sizes that are cheaper to read than to track.
+func NewGaugeFunc(name, help string, f func() float64, labels ...string) {
+	DefaultRegistry.GaugeFunc(name, help, f, labels...)
+}
+
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	m := r.register(name, help, "counter", labels, func() *metric {
+		c := &Counter{}
+		return &metric{value: c.float, impl: c}
+	})
+	return m.impl.(*Counter)
+}
+
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	m := r.register(name, help, "gauge", labels, func() *metric {
+		g := &Gauge{}
+		return &metric{value: g.float, impl: g}
+	})
+	return m.impl.(*Gauge)
+}
+
+// GaugeFunc registers f as the value of the gauge, replacing any function
+// previously registered under the same name and labels.
+func (r *Registry) GaugeFunc(name, help string, f func() float64, labels ...string) {
+	m := r.register(name, help, "gauge", labels, func() *metric {
+		return &metric{value: f}
+	})
+	r.mu.Lock()
+	m.value = f
+	r.mu.Unlock()
+}
+
+func (r *Registry) register(name, help, kind string, labels []string, create func() *metric) *metric {
+	rendered := renderLabels(labels)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := name + rendered
+	if m, ok := r.metrics[key]; ok {
+		if m.kind != kind {
+			panic(fmt.Sprintf("metric %s registered as both %s and %s", key, m.kind, kind))
+		}
+		return m
+	}
+
+	m := create()
+	m.name, m.help, m.kind, m.labels = name, help, kind, rendered
+	r.metrics[key] = m
+	return m
+}
+
+// WriteTo renders every metric in the Prometheus text exposition format,
+// grouping metrics that share a name under a single HELP and TYPE header.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := make([]*metric, 0, len(r.metrics))
+	values := make(map[*metric]func() float64, len(r.metrics))
+	for _, m := range r.metrics {
+		metrics = append(metrics, m)
+		values[m] = m.value
+	}
+	r.mu.Unlock()
+
+	slices.SortFunc(metrics, func(a, b *metric) int {
+		if c := strings.Compare(a.name, b.name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.labels, b.labels)
+	})
+
+	var sb strings.Builder
+	for i, m := range metrics {
+		if i == 0 || metrics[i-1].name != m.name {
+			fmt.Fprintf(&sb, "# HELP %s %s\n", m.name, escapeHelp(m.help))
+			fmt.Fprintf(&sb, "# TYPE %s %s\n", m.name, m.kind)
+		}
+		fmt.Fprintf(&sb, "%s%s %s\n", m.name, m.labels, formatValue(values[m]()))
+	}
+
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+// ServeHTTP serves the registry's metrics to a Prometheus scraper.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+// ServeMetrics serves the default registry on addr under /metrics until ctx
+// is cancelled.
+func ServeMetrics(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", DefaultRegistry)
+	return ServeEndpoint(ctx, "metrics", addr, mux)
+}
+
+// ServeEndpoint runs an auxiliary HTTP listener, such as the metrics endpoint,
+// for as long as ctx is alive.
+func ServeEndpoint(ctx context.Context, name, addr string, handler http.Handler) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		slog.Error("HTTP endpoint stopped", "endpoint", name, "addr", addr, "err", err)
+		return err
+	}
+	return serveEndpoint(ctx, name, listener, handler)
+}
+
+// serveEndpoint is like ServeEndpoint on a listener that is already bound.
+func serveEndpoint(ctx context.Context, name string, listener net.Listener, handler http.Handler) error {
+	httpServer := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	addr := listener.Addr().String()
+	slog.Info("HTTP endpoint is listening", "endpoint", name, "addr", addr)
+	err := httpServer.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	slog.Error("HTTP endpoint stopped", "endpoint", name, "addr", addr, "err", err)
+	return err
+}
+
+func renderLabels(labels []string) string {
+	if len(labels)%2 != 0 {
+		panic("metric labels must be key-value pairs")
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+`="`+escapeLabelValue(labels[i+1])+`"`)
+	}
+	slices.Sort(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var (
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabelValue(s string) string { return labelValueEscaper.Replace(s) }
+func escapeHelp(s string) string       { return helpEscaper.Replace(s) }
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("requests_total", "Requests served.", "service", "b").Add(3)
+	r.Counter("requests_total", "Requests served.", "service", "a").Inc()
+	r.Gauge("users", "Users online.").Set(7)
+	r.GaugeFunc("keys", "Keys \\ stored.\nSecond line.", func() float64 { return 2.5 })
+
+	// Asking again returns the same counter
+	r.Counter("requests_total", "Requests served.", "service", "a").Inc()
+
+	var sb strings.Builder
+	r.WriteTo(&sb)
+
+	expected := `# HELP keys Keys \\ stored.\nSecond line.
+# TYPE keys gauge
+keys 2.5
+# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{service="a"} 2
+requests_total{service="b"} 3
+# HELP users Users online.
+# TYPE users gauge
+users 7
+`
+	if sb.String() != expected {
+		t.Fatalf("Unexpected exposition:\n%s\nexpected:\n%s", sb.String(), expected)
+	}
+}
+
+func TestRenderLabelsEscapesValues(t *testing.T) {
+	got := renderLabels([]string{"z", "1", "a", "quote\" slash\\ newline\n"})
+	expected := `{a="quote\" slash\\ newline\n",z="1"}`
+	if got != expected {
+		t.Fatalf("Expected %s, got %s", expected, got)
+	}
+}
+
+func TestServerMetrics(t *testing.T) {
+	s := NewServer(":0", echo)
+	s.Name = fmt.Sprint("metrics_test_", time.Now().UnixNano()) // Fresh series on every run
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	conn.Write([]byte("hello"))
+	io.ReadFull(conn, make([]byte, 5))
+
+	labels := []string{"service", s.Name}
+	if v := NewGauge("server_connections_active", "", labels...).Value(); v != 1 {
+		t.Fatalf("Expected 1 active connection, got %d", v)
+	}
+	if v := NewCounter("server_bytes_read_total", "", labels...).Value(); v != 5 {
+		t.Fatalf("Expected 5 bytes read, got %d", v)
+	}
+	if v := NewCounter("server_bytes_written_total", "", labels...).Value(); v != 5 {
+		t.Fatalf("Expected 5 bytes written, got %d", v)
+	}
+
+	conn.Close()
+	waitForConns(t, s, 0)
+	if v := NewCounter("server_connections_accepted_total", "", labels...).Value(); v != 1 {
+		t.Fatalf("Expected 1 accepted connection, got %d", v)
+	}
+	if v := NewGauge("server_connections_active", "", labels...).Value(); v != 0 {
+		t.Fatalf("Expected no active connections, got %d", v)
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	name := fmt.Sprint("serve_metrics_test_", time.Now().UnixNano(), "_total")
+	NewCounter(name, "Test counter.").Inc()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- ServeMetrics(ctx, addr) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	var resp *http.Response
+	for range 100 {
+		if resp, err = http.Get("http://" + addr + "/metrics"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal("Error scraping metrics:", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), name+" 1\n") {
+		t.Fatalf("Expected test counter in scrape, got:\n%s", body)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("Unexpected content type %q", ct)
+	}
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"maps"
+	"net"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Handler serves a single client connection.
+type Handler func(net.Conn)
+
+// Middleware wraps a Handler with behaviour that isn't specific to any one
+// service, such as logging or panic recovery.
+type Middleware func(Handler) Handler
+
+// Chain wraps handle in the given middleware. The first middleware is the
+// outermost one, i.e. it sees the connection first.
+func Chain(handle Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handle = middleware[i](handle)
+	}
+	return handle
+}
+
+// Recover stops a panicking handler from taking down the whole process. The
+// panic is logged with its stack trace and the connection is closed.
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return func(conn net.Conn) {
+			defer func() {
+				if r := recover(); r != nil {
+					Logger(conn).Error("Recovered from panic in handler", "panic", r, "stack", string(debug.Stack()))
+					conn.Close()
+				}
+			}()
+			next(conn)
+		}
+	}
+}
+
+// AccessLog logs when a client connects and, when it disconnects, how long
+// the connection lasted and how many bytes went each way.
+func AccessLog() Middleware {
+	return func(next Handler) Handler {
+		return CountBytes()(func(conn net.Conn) {
+			logger := Logger(conn)
+			for key, value := range Tags(conn) {
+				logger = logger.With(key, value)
+			}
+
+			start := time.Now()
+			logger.Info("Connection opened")
+			defer func() {
+				read, written, _ := ConnStats(conn)
+				logger.Info("Connection closed", "duration", time.Since(start).Round(time.Millisecond),
+					"bytes_read", read, "bytes_written", written)
+			}()
+			next(conn)
+		})
+	}
+}
+
+// CountBytes counts the bytes read from and written to the connection. The
+// totals are available to inner handlers through ConnStats. Connections
+// accepted by a Server are always counted, so this is only needed for
+// handlers served some other way.
+func CountBytes() Middleware {
+	return func(next Handler) Handler {
+		return func(conn net.Conn) {
+			if _, ok := find[*countingConn](conn); ok {
+				next(conn) // Already counted further out
+				return
+			}
+			next(&countingConn{Conn: conn})
+		}
+	}
+}
+
+// Tag attaches a key-value pair to the connection, e.g. the service name,
+// which inner handlers and middleware can read back with Tags.
+func Tag(key, value string) Middleware {
+	return func(next Handler) Handler {
+		return func(conn net.Conn) {
+			tagged, ok := find[*taggedConn](conn)
+			if !ok {
+				tagged = &taggedConn{Conn: conn, tags: make(map[string]string)}
+				conn = tagged
+			}
+			tagged.mu.Lock()
+			tagged.tags[key] = value
+			tagged.mu.Unlock()
+			next(conn)
+		}
+	}
+}
+
+// ConnStats returns the number of bytes read from and written to conn so
+// far. It reports false if no CountBytes middleware is counting conn.
+func ConnStats(conn net.Conn) (read, written int64, ok bool) {
+	counting, ok := find[*countingConn](conn)
+	if !ok {
+		return 0, 0, false
+	}
+	return counting.read.Load(), counting.written.Load(), true
+}
+
+// Tags returns a copy of the tags attached to conn by the Tag middleware.
+func Tags(conn net.Conn) map[string]string {
+	tagged, ok := find[*taggedConn](conn)
+	if !ok {
+		return nil
+	}
+	tagged.mu.Lock()
+	defer tagged.mu.Unlock()
+	return maps.Clone(tagged.tags)
+}
+
+type countingConn struct {
+	net.Conn
+	read    atomic.Int64
+	written atomic.Int64
+	active  atomic.Int64 // Unix nanoseconds of the last read or write of any bytes
+
+	// Server-wide totals to add to as well, if set
+	totalRead    *Counter
+	totalWritten *Counter
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.read.Add(int64(n))
+	c.touch(n)
+	if c.totalRead != nil {
+		c.totalRead.Add(int64(n))
+	}
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.written.Add(int64(n))
+	c.touch(n)
+	if c.totalWritten != nil {
+		c.totalWritten.Add(int64(n))
+	}
+	return n, err
+}
+
+func (c *countingConn) touch(n int) {
+	if n > 0 {
+		c.active.Store(time.Now().UnixNano())
+	}
+}
+
+// lastActive returns when bytes last went either way, or the zero time if
+// none have.
+func (c *countingConn) lastActive() time.Time {
+	if nanos := c.active.Load(); nanos != 0 {
+		return time.Unix(0, nanos)
+	}
+	return time.Time{}
+}
+
+func (c *countingConn) Unwrap() net.Conn { return c.Conn }
+
+type taggedConn struct {
+	net.Conn
+	mu   sync.Mutex
+	tags map[string]string
+}
+
+func (c *taggedConn) Unwrap() net.Conn { return c.Conn }
+
+// find walks down the chain of connection wrappers until it finds one of
+// type T. Wrappers expose what they wrap through Unwrap, or NetConn in the
+// case of *tls.Conn.
+func find[T net.Conn](conn net.Conn) (T, bool) {
+	for conn != nil {
+		if c, ok := conn.(T); ok {
+			return c, true
+		}
+		switch c := conn.(type) {
+		case interface{ Unwrap() net.Conn }:
+			conn = c.Unwrap()
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			conn = nil
+		}
+	}
+	var zero T
+	return zero, false
+}
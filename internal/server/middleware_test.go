@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(conn net.Conn) {
+				calls = append(calls, name)
+				next(conn)
+			}
+		}
+	}
+
+	handle := Chain(func(net.Conn) { calls = append(calls, "handler") }, record("outer"), record("inner"))
+	handle(nil)
+
+	if got := strings.Join(calls, ","); got != "outer,inner,handler" {
+		t.Fatalf("Expected outer,inner,handler, got %s", got)
+	}
+}
+
+func TestRecoverKeepsServerRunning(t *testing.T) {
+	s := NewServer(":0", func(conn net.Conn) {
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		if line == "panic\n" {
+			panic("handler exploded")
+		}
+		conn.Write([]byte(line))
+	})
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("panic\n"))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatal("Expected the panicking handler's connection to be closed, got:", err)
+	}
+
+	conn, err = net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server after panic:", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("hello\n"))
+	reply, _ := bufio.NewReader(conn).ReadString('\n')
+	if reply != "hello\n" {
+		t.Fatalf("Expected echo after panic, got %q", reply)
+	}
+}
+
+func TestCountBytes(t *testing.T) {
+	client, serverConn := net.Pipe()
+	defer client.Close()
+
+	stats := make(chan [2]int64, 1)
+	handle := Chain(func(conn net.Conn) {
+		defer conn.Close()
+		buf := make([]byte, 5)
+		io.ReadFull(conn, buf)
+		conn.Write([]byte("hi"))
+		read, written, ok := ConnStats(conn)
+		if !ok {
+			t.Error("Expected connection to be counted")
+		}
+		stats <- [2]int64{read, written}
+	}, CountBytes(), CountBytes())
+
+	go handle(serverConn)
+	client.Write([]byte("hello"))
+	io.ReadFull(client, make([]byte, 2))
+
+	if got := <-stats; got != [2]int64{5, 2} {
+		t.Fatalf("Expected 5 bytes read and 2 written, got %v", got)
+	}
+}
+
+func TestTagsAreVisibleThroughWrappers(t *testing.T) {
+	serverConfig, clientConfig, err := SelfSignedTLSConfig()
+	if err != nil {
+		t.Fatal("Error generating certificate:", err)
+	}
+
+	tags := make(chan map[string]string, 1)
+	s := NewServer("127.0.0.1:0", func(conn net.Conn) {
+		defer conn.Close()
+		conn.Write([]byte("ok")) // Completes the TLS handshake
+		tags <- Tags(conn)
+	})
+	s.TLSConfig = serverConfig
+	s.Middleware = []Middleware{Tag("service", "test"), CountBytes(), Tag("role", "client")}
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, err := Dial(listener.Addr().String(), clientConfig)
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Close()
+
+	got := <-tags
+	if got["service"] != "test" || got["role"] != "client" || len(got) != 2 {
+		t.Fatalf("Expected service and role tags, got %v", got)
+	}
+}
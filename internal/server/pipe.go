@@ -0,0 +1,265 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PipeListener is an in-memory net.Listener for tests. Each Dial hands the
+// server one end of a pipe and returns the other, so handlers run exactly as
+// they would over TCP without binding a port.
+//
+// Unlike net.Pipe the pipes are buffered: writes never block, so a handler
+// broadcasting to clients that aren't reading yet doesn't stall.
+type PipeListener struct {
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+	dialed    atomic.Uint64
+}
+
+func NewPipeListener() *PipeListener {
+	return &PipeListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+// StartPipeListener starts a Server with default settings and the given
+// middleware on a new PipeListener, which clients connect to with Dial.
+// Closing the listener stops accepting new connections.
+func StartPipeListener(handle Handler, middleware ...Middleware) (*PipeListener, error) {
+	listener := NewPipeListener()
+	srv := NewServer("", handle)
+	srv.Listener = listener
+	srv.Middleware = middleware
+	if _, err := srv.Start(); err != nil {
+		return nil, err
+	}
+	return listener, nil
+}
+
+func (l *PipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *PipeListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *PipeListener) Addr() net.Addr { return pipeAddr("pipe") }
+
+// Dial connects to the listener, blocking until the connection is accepted.
+func (l *PipeListener) Dial() (*PipeConn, error) {
+	id := l.dialed.Add(1)
+	toServer, toClient := newPipeBuffer(), newPipeBuffer()
+	serverEnd := &PipeConn{
+		r:      toServer,
+		w:      toClient,
+		local:  pipeAddr("pipe"),
+		remote: pipeAddr(fmt.Sprintf("pipe:%d", id)),
+	}
+	clientEnd := &PipeConn{
+		r:      toClient,
+		w:      toServer,
+		local:  serverEnd.remote,
+		remote: serverEnd.local,
+	}
+
+	select {
+	case l.conns <- serverEnd:
+		return clientEnd, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// PipeConn is one end of a connection made by PipeListener.Dial.
+type PipeConn struct {
+	r, w          *pipeBuffer
+	local, remote net.Addr
+	closeOnce     sync.Once
+}
+
+func (c *PipeConn) Read(b []byte) (int, error)  { return c.r.read(b) }
+func (c *PipeConn) Write(b []byte) (int, error) { return c.w.write(b) }
+
+// Close makes reads on the other end return io.EOF once they have drained
+// what was written, and writes on it fail.
+func (c *PipeConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.w.closeWrite()
+		c.r.closeRead()
+	})
+	return nil
+}
+
+func (c *PipeConn) LocalAddr() net.Addr  { return c.local }
+func (c *PipeConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *PipeConn) SetDeadline(t time.Time) error {
+	c.r.setReadDeadline(t)
+	c.w.setWriteDeadline(t)
+	return nil
+}
+
+func (c *PipeConn) SetReadDeadline(t time.Time) error {
+	c.r.setReadDeadline(t)
+	return nil
+}
+
+func (c *PipeConn) SetWriteDeadline(t time.Time) error {
+	c.w.setWriteDeadline(t)
+	return nil
+}
+
+// AwaitProcessed blocks until the other end has read everything written to
+// it and is waiting for more, or has been closed. For a handler that reads a
+// message, acts on it and reads again, that means it has finished with every
+// message sent so far, which tests can wait for instead of sleeping.
+func (c *PipeConn) AwaitProcessed(timeout time.Duration) error {
+	b := c.w
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for len(b.data) > 0 || !(b.readerWaiting || b.readerClosed) {
+		changed := b.changed
+		b.mu.Unlock()
+		select {
+		case <-changed:
+		case <-timer.C:
+			b.mu.Lock()
+			return fmt.Errorf("other end did not process %d pending bytes within %s", len(b.data), timeout)
+		}
+		b.mu.Lock()
+	}
+	return nil
+}
+
+// pipeBuffer carries the bytes for one direction of a PipeConn.
+type pipeBuffer struct {
+	mu            sync.Mutex
+	data          []byte
+	writerClosed  bool
+	readerClosed  bool
+	readerWaiting bool // A read is blocked on the buffer being empty
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	// changed is closed and replaced whenever any of the above changes.
+	changed chan struct{}
+}
+
+func newPipeBuffer() *pipeBuffer {
+	return &pipeBuffer{changed: make(chan struct{})}
+}
+
+func (b *pipeBuffer) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func (b *pipeBuffer) read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for {
+		switch {
+		case b.readerClosed:
+			return 0, net.ErrClosed
+		case len(b.data) > 0:
+			n := copy(p, b.data)
+			b.data = b.data[n:]
+			b.notify()
+			return n, nil
+		case b.writerClosed:
+			return 0, io.EOF
+		case !b.readDeadline.IsZero() && !time.Now().Before(b.readDeadline):
+			return 0, os.ErrDeadlineExceeded
+		}
+
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if !b.readDeadline.IsZero() {
+			timer = time.NewTimer(time.Until(b.readDeadline))
+			expired = timer.C
+		}
+		b.readerWaiting = true
+		b.notify()
+		changed := b.changed
+		b.mu.Unlock()
+		select {
+		case <-changed:
+		case <-expired:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		b.mu.Lock()
+		b.readerWaiting = false
+	}
+}
+
+func (b *pipeBuffer) write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case b.writerClosed:
+		return 0, net.ErrClosed
+	case b.readerClosed:
+		return 0, io.ErrClosedPipe
+	case !b.writeDeadline.IsZero() && !time.Now().Before(b.writeDeadline):
+		return 0, os.ErrDeadlineExceeded
+	}
+	b.data = append(b.data, p...)
+	b.notify()
+	return len(p), nil
+}
+
+func (b *pipeBuffer) closeWrite() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.writerClosed = true
+	b.notify()
+}
+
+func (b *pipeBuffer) closeRead() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.readerClosed = true
+	b.data = nil
+	b.notify()
+}
+
+// setReadDeadline also wakes a blocked read so that it honours t.
+func (b *pipeBuffer) setReadDeadline(t time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.readDeadline = t
+	b.notify()
+}
+
+func (b *pipeBuffer) setWriteDeadline(t time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.writeDeadline = t
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPipeListener(t *testing.T) {
+	listener, err := StartPipeListener(func(conn net.Conn) {
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			conn.Write([]byte(strings.ToUpper(scanner.Text()) + "\n"))
+		}
+	})
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, err := listener.Dial()
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("hello\n"))
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || reply != "HELLO\n" {
+		t.Fatalf("Expected %q, got %q (%v)", "HELLO\n", reply, err)
+	}
+
+	conn.Close()
+	listener.Close()
+	if _, err := listener.Dial(); !errors.Is(err, net.ErrClosed) {
+		t.Fatal("Expected dialling a closed listener to fail, got:", err)
+	}
+}
+
+func TestPipeAwaitProcessed(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	listener, err := StartPipeListener(func(conn net.Conn) {
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			time.Sleep(10 * time.Millisecond) // Slow enough that the test would race without waiting
+			mu.Lock()
+			lines = append(lines, scanner.Text())
+			mu.Unlock()
+		}
+	})
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, _ := listener.Dial()
+	defer conn.Close()
+
+	for _, line := range []string{"one", "two", "three"} {
+		conn.Write([]byte(line + "\n"))
+	}
+	if err := conn.AwaitProcessed(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(lines, ",") != "one,two,three" {
+		t.Fatalf("Expected all lines processed, got %q", lines)
+	}
+}
+
+func TestPipeAwaitProcessedTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	listener, _ := StartPipeListener(func(conn net.Conn) {
+		defer conn.Close()
+		<-release
+	})
+	defer listener.Close()
+	defer close(release)
+
+	conn, _ := listener.Dial()
+	defer conn.Close()
+	conn.Write([]byte("ignored"))
+
+	if err := conn.AwaitProcessed(20 * time.Millisecond); err == nil {
+		t.Fatal("Expected a timeout while the handler isn't reading")
+	}
+}
+
+func TestPipeConnCloseAndDeadlines(t *testing.T) {
+	listener := NewPipeListener()
+	defer listener.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := listener.Accept()
+		accepted <- conn
+	}()
+	client, _ := listener.Dial()
+	srv := <-accepted
+
+	client.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := client.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatal("Expected a deadline error, got:", err)
+	}
+
+	// Bytes written before Close are still delivered, then EOF.
+	srv.Write([]byte("bye"))
+	srv.Close()
+	client.SetReadDeadline(time.Time{})
+	data, err := io.ReadAll(client)
+	if err != nil || string(data) != "bye" {
+		t.Fatalf("Expected %q then EOF, got %q (%v)", "bye", data, err)
+	}
+	if _, err := client.Write([]byte("x")); err == nil {
+		t.Fatal("Expected writing to a closed peer to fail")
+	}
+	if err := client.AwaitProcessed(time.Second); err != nil {
+		t.Fatal("Expected a closed peer to count as processed, got:", err)
+	}
+}
@@ -0,0 +1,264 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProxyProtocolMode controls whether a Server expects connections to start
+// with a PROXY protocol (v1 or v2) header, as sent by HAProxy and similar
+// load balancers to pass on the real client address.
+//
+// Only enable it behind a trusted proxy: the header is taken at its word, so
+// a client connecting directly could claim any address it likes.
+type ProxyProtocolMode int
+
+const (
+	// ProxyProtocolOff treats every byte as application data.
+	ProxyProtocolOff ProxyProtocolMode = iota
+
+	// ProxyProtocolPermissive uses a header if one is present and otherwise
+	// serves the connection as is. Since a header can only be detected once
+	// the client sends something, a direct client of a protocol where the
+	// server speaks first waits up to ProxyHeaderTimeout for its greeting.
+	ProxyProtocolPermissive
+
+	// ProxyProtocolStrict closes connections that don't start with a valid
+	// header within ProxyHeaderTimeout.
+	ProxyProtocolStrict
+)
+
+var proxyProtocolModeNames = []string{"off", "permissive", "strict"}
+
+func (m ProxyProtocolMode) String() string {
+	if int(m) < len(proxyProtocolModeNames) {
+		return proxyProtocolModeNames[m]
+	}
+	return fmt.Sprintf("ProxyProtocolMode(%d)", int(m))
+}
+
+// UnmarshalText parses "off", "permissive" or "strict". Empty text means off.
+func (m *ProxyProtocolMode) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*m = ProxyProtocolOff
+		return nil
+	}
+	for i, name := range proxyProtocolModeNames {
+		if strings.EqualFold(string(text), name) {
+			*m = ProxyProtocolMode(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown PROXY protocol mode %q", text)
+}
+
+// DefaultProxyHeaderTimeout is how long a Server waits for a PROXY protocol
+// header unless ProxyHeaderTimeout is set.
+const DefaultProxyHeaderTimeout = 5 * time.Second
+
+var (
+	proxyV1Prefix    = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// proxyV1MaxLength is the longest possible v1 header, including CRLF.
+const proxyV1MaxLength = 107
+
+var errNoProxyHeader = errors.New("connection did not start with a PROXY protocol header")
+
+// proxyConn is a connection whose addresses were taken from a PROXY protocol
+// header. Bytes read while looking for a header that turned out not to be
+// there are replayed to the handler first.
+type proxyConn struct {
+	net.Conn
+	remoteAddr net.Addr
+	localAddr  net.Addr
+	pending    []byte
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	if len(c.pending) > 0 {
+		n := copy(b, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr { return c.remoteAddr }
+func (c *proxyConn) LocalAddr() net.Addr  { return c.localAddr }
+func (c *proxyConn) Unwrap() net.Conn     { return c.Conn }
+
+// readProxyHeader consumes the PROXY protocol header at the start of conn, if
+// the server expects one, and returns a connection reporting the addresses
+// it carried.
+func (s *Server) readProxyHeader(conn net.Conn) (net.Conn, error) {
+	if s.ProxyProtocol == ProxyProtocolOff {
+		return conn, nil
+	}
+
+	timeout := s.ProxyHeaderTimeout
+	if timeout == 0 {
+		timeout = DefaultProxyHeaderTimeout
+	}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	proxied, err := parseProxyHeader(conn)
+	if err == nil {
+		return proxied, nil
+	}
+
+	var missing *missingHeaderError
+	if s.ProxyProtocol == ProxyProtocolPermissive && errors.As(err, &missing) {
+		return &proxyConn{
+			Conn:       conn,
+			remoteAddr: conn.RemoteAddr(),
+			localAddr:  conn.LocalAddr(),
+			pending:    missing.consumed,
+		}, nil
+	}
+	return nil, err
+}
+
+// missingHeaderError reports that a connection doesn't start with a header,
+// along with the bytes that were read to find that out.
+type missingHeaderError struct {
+	consumed []byte
+}
+
+func (e *missingHeaderError) Error() string { return errNoProxyHeader.Error() }
+func (e *missingHeaderError) Unwrap() error { return errNoProxyHeader }
+
+// parseProxyHeader reads a v1 or v2 header from conn. It reads one byte at
+// a time until it knows which version it is looking at, so that nothing past
+// the header is consumed.
+func parseProxyHeader(conn net.Conn) (net.Conn, error) {
+	var prefix []byte
+	for {
+		b := make([]byte, 1)
+		if _, err := io.ReadFull(conn, b); err != nil {
+			if len(prefix) == 0 && errors.Is(err, os.ErrDeadlineExceeded) {
+				return nil, &missingHeaderError{} // Client is waiting for us to speak first
+			}
+			return nil, err
+		}
+		prefix = append(prefix, b[0])
+
+		switch {
+		case bytes.Equal(prefix, proxyV1Prefix):
+			return parseProxyV1(conn)
+		case bytes.Equal(prefix, proxyV2Signature):
+			return parseProxyV2(conn)
+		case !bytes.HasPrefix(proxyV1Prefix, prefix) && !bytes.HasPrefix(proxyV2Signature, prefix):
+			return nil, &missingHeaderError{consumed: prefix}
+		}
+	}
+}
+
+// parseProxyV1 parses the human-readable header, whose "PROXY " prefix has
+// already been consumed, e.g. "TCP4 192.0.2.1 198.51.100.1 56324 443\r\n".
+func parseProxyV1(conn net.Conn) (net.Conn, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line)+len(proxyV1Prefix) >= proxyV1MaxLength {
+			return nil, errors.New("PROXY v1 header is too long")
+		}
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return nil, err
+		}
+		line = append(line, b[0])
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) > 0 && fields[0] == "UNKNOWN" {
+		return &proxyConn{Conn: conn, remoteAddr: conn.RemoteAddr(), localAddr: conn.LocalAddr()}, nil
+	}
+	if len(fields) != 5 || (fields[0] != "TCP4" && fields[0] != "TCP6") {
+		return nil, fmt.Errorf("malformed PROXY v1 header %q", line)
+	}
+
+	src, err := parseProxyV1Addr(fields[0], fields[1], fields[3])
+	if err != nil {
+		return nil, err
+	}
+	dst, err := parseProxyV1Addr(fields[0], fields[2], fields[4])
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{Conn: conn, remoteAddr: src, localAddr: dst}, nil
+}
+
+func parseProxyV1Addr(family, host, port string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil || (family == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("invalid %s address %q in PROXY v1 header", family, host)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q in PROXY v1 header", port)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+// parseProxyV2 parses the binary header, whose 12 byte signature has
+// already been consumed.
+func parseProxyV2(conn net.Conn) (net.Conn, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+
+	version, command := header[0]>>4, header[0]&0x0f
+	family := header[1]
+	length := binary.BigEndian.Uint16(header[2:4])
+	if version != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version %d", version)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return nil, err
+	}
+
+	unproxied := &proxyConn{Conn: conn, remoteAddr: conn.RemoteAddr(), localAddr: conn.LocalAddr()}
+	switch command {
+	case 0x0: // LOCAL, e.g. the proxy's own health checks
+		return unproxied, nil
+	case 0x1: // PROXY
+	default:
+		return nil, fmt.Errorf("unsupported PROXY v2 command %#x", command)
+	}
+
+	var ipLen int
+	switch family {
+	case 0x11: // TCP over IPv4
+		ipLen = net.IPv4len
+	case 0x21: // TCP over IPv6
+		ipLen = net.IPv6len
+	default:
+		return unproxied, nil // Unspecified or non-TCP: keep the real addresses
+	}
+
+	if len(payload) < 2*ipLen+4 {
+		return nil, errors.New("PROXY v2 address block is too short")
+	}
+	src := &net.TCPAddr{
+		IP:   net.IP(payload[:ipLen]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen:])),
+	}
+	dst := &net.TCPAddr{
+		IP:   net.IP(payload[ipLen : 2*ipLen]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen+2:])),
+	}
+	return &proxyConn{Conn: conn, remoteAddr: src, localAddr: dst}, nil
+}
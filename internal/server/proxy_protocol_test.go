@@ -0,0 +1,212 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// reportAddr writes the client's address on a line of its own and then
+// echoes whatever the client sends.
+func reportAddr(conn net.Conn) {
+	defer conn.Close()
+	conn.Write([]byte(conn.RemoteAddr().String() + "\n"))
+	io.Copy(conn, conn)
+}
+
+func startProxied(t *testing.T, mode ProxyProtocolMode) net.Addr {
+	t.Helper()
+	s := NewServer("127.0.0.1:0", reportAddr)
+	s.ProxyProtocol = mode
+	s.ProxyHeaderTimeout = 100 * time.Millisecond
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	return listener.Addr()
+}
+
+// exchange sends header followed by "hello\n" and returns the address the
+// server reported and the echoed line.
+func exchange(t *testing.T, addr net.Addr, header []byte) (string, string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	conn.Write(append(header, "hello\n"...))
+	reader := bufio.NewReader(conn)
+	remote, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal("Error reading reported address:", err)
+	}
+	echoed, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal("Error reading echo:", err)
+	}
+	return remote[:len(remote)-1], echoed
+}
+
+func proxyV2Header(command, family byte, addresses []byte) []byte {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x20|command, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(addresses)))
+	return append(header, addresses...)
+}
+
+func TestProxyProtocolV1(t *testing.T) {
+	addr := startProxied(t, ProxyProtocolStrict)
+
+	remote, echoed := exchange(t, addr, []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"))
+	if remote != "192.0.2.1:56324" || echoed != "hello\n" {
+		t.Fatalf("Expected the proxied client address and an intact stream, got %s and %q", remote, echoed)
+	}
+
+	remote, _ = exchange(t, addr, []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"))
+	if remote != "[2001:db8::1]:56324" {
+		t.Fatalf("Expected the proxied IPv6 client address, got %s", remote)
+	}
+}
+
+func TestProxyProtocolV2(t *testing.T) {
+	addr := startProxied(t, ProxyProtocolStrict)
+
+	ipv4 := []byte{192, 0, 2, 1, 198, 51, 100, 1, 0xdc, 0x04, 0x01, 0xbb}
+	ipv4 = append(ipv4, 0x04, 0x00, 0x01, 'x') // A TLV, which is skipped
+	remote, echoed := exchange(t, addr, proxyV2Header(0x1, 0x11, ipv4))
+	if remote != "192.0.2.1:56324" || echoed != "hello\n" {
+		t.Fatalf("Expected the proxied client address and an intact stream, got %s and %q", remote, echoed)
+	}
+
+	ipv6 := append(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")...)
+	ipv6 = append(ipv6, 0xdc, 0x04, 0x01, 0xbb)
+	remote, _ = exchange(t, addr, proxyV2Header(0x1, 0x21, ipv6))
+	if remote != "[2001:db8::1]:56324" {
+		t.Fatalf("Expected the proxied IPv6 client address, got %s", remote)
+	}
+
+	// LOCAL connections come from the proxy itself and keep their address
+	remote, _ = exchange(t, addr, proxyV2Header(0x0, 0x00, nil))
+	if host, _, _ := net.SplitHostPort(remote); host != "127.0.0.1" {
+		t.Fatalf("Expected the real address for a LOCAL connection, got %s", remote)
+	}
+}
+
+func TestProxyProtocolStrictRejectsMissingHeader(t *testing.T) {
+	addr := startProxied(t, ProxyProtocolStrict)
+
+	for _, prefix := range []string{"hello\n", "PROXY TCP4 not-an-address\r\n", ""} {
+		conn, err := net.Dial("tcp", addr.String())
+		if err != nil {
+			t.Fatal("Error connecting to server:", err)
+		}
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+		conn.Write([]byte(prefix))
+
+		// Unread bytes make the close a reset rather than an EOF
+		if n, err := conn.Read(make([]byte, 100)); n > 0 || err == nil || os.IsTimeout(err) {
+			t.Fatalf("Expected the connection to be closed for %q, got %d bytes (%v)", prefix, n, err)
+		}
+		conn.Close()
+	}
+}
+
+func TestProxyProtocolPermissive(t *testing.T) {
+	addr := startProxied(t, ProxyProtocolPermissive)
+
+	remote, _ := exchange(t, addr, []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"))
+	if remote != "192.0.2.1:56324" {
+		t.Fatalf("Expected the proxied client address, got %s", remote)
+	}
+
+	// "PROXY" is a prefix of the header, so this exercises the replay of
+	// bytes read while looking for one
+	for _, data := range []string{"hello\n", "PROXIMITY\n"} {
+		remote, echoed := exchange(t, addr, []byte(data))
+		if host, _, _ := net.SplitHostPort(remote); host != "127.0.0.1" || echoed != data {
+			t.Fatalf("Expected a direct client to be served as is, got %s and %q", remote, echoed)
+		}
+	}
+
+	// A client waiting for the server to speak first gets its greeting once
+	// the header timeout has passed
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+		t.Fatal("Expected a greeting without sending anything:", err)
+	}
+}
+
+func TestProxyProtocolAddressIsUsedForConnectionLimits(t *testing.T) {
+	s := NewServer("127.0.0.1:0", reportAddr)
+	s.ProxyProtocol = ProxyProtocolStrict
+	s.MaxConnsPerIP = 1
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	// Both connections come from 127.0.0.1, but on behalf of different clients
+	for _, client := range []string{"192.0.2.1", "192.0.2.2"} {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal("Error connecting to server:", err)
+		}
+		defer conn.Close()
+		conn.Write([]byte("PROXY TCP4 " + client + " 198.51.100.1 56324 443\r\n"))
+	}
+	waitForConns(t, s, 2)
+}
+
+func TestShutdownWaitsForProxyHeader(t *testing.T) {
+	s := NewServer("127.0.0.1:0", reportAddr)
+	s.ProxyProtocol = ProxyProtocolStrict
+	s.ProxyHeaderTimeout = time.Minute
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		s.mu.Lock()
+		reading := len(s.headers)
+		s.mu.Unlock()
+		if reading == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the server to be reading a PROXY header")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("Expected Shutdown to wait for the PROXY header, got:", err)
+	}
+	if n, err := conn.Read(make([]byte, 100)); n > 0 || err == nil || os.IsTimeout(err) {
+		t.Fatalf("Expected the connection to be closed, got %d bytes (%v)", n, err)
+	}
+}
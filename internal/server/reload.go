@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// LoadConfig defines a command's flags on a new configuration with define
+// and parses them from the command line, the environment and the config
+// file. It exits if the command line is invalid or asks for -help.
+func LoadConfig[T any](command string, define func(config *T, f *Flags)) (*T, *Flags, error) {
+	return loadConfig(command, define, os.Args[1:], flag.ExitOnError)
+}
+
+func loadConfig[T any](command string, define func(*T, *Flags), args []string, errorHandling flag.ErrorHandling) (*T, *Flags, error) {
+	config := new(T)
+	f := newFlags(command, errorHandling)
+	define(config, f)
+	return config, f, f.Parse(args)
+}
+
+// WatchConfig reloads the configuration loaded by LoadConfig whenever the
+// process receives SIGHUP, until ctx is cancelled. Since the command line and
+// the environment stay the same, that picks up changes to the config file.
+//
+// A configuration that doesn't parse is logged and the current one kept.
+// Otherwise every setting that changed is logged, and apply is called with
+// the new configuration if any of them are Live. The others only take effect
+// on restart, which is logged as a warning.
+func WatchConfig[T any](ctx context.Context, command string, current *Flags, define func(*T, *Flags), apply func(next *T)) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangups:
+			current = reloadConfig(command, current, define, os.Args[1:], apply)
+		}
+	}
+}
+
+// reloadConfig parses the configuration afresh and applies it, returning the
+// flags now in effect.
+func reloadConfig[T any](command string, current *Flags, define func(*T, *Flags), args []string, apply func(*T)) *Flags {
+	next, flags, err := loadConfig(command, define, args, flag.ContinueOnError)
+	if err != nil {
+		slog.Error("Rejected configuration reload, keeping the current configuration", "err", err)
+		return current
+	}
+
+	changed := flags.changedSince(current)
+	live := false
+	for _, name := range changed {
+		old, new := current.value(name), flags.value(name)
+		if flags.live[name] {
+			live = true
+			slog.Info("Setting changed", "setting", name, "old", old, "new", new)
+		} else {
+			slog.Warn("Setting changed, but only takes effect on restart", "setting", name, "old", old, "new", new)
+		}
+	}
+	if live {
+		apply(next)
+	}
+	slog.Info("Configuration reloaded", "changed", len(changed))
+	return flags
+}
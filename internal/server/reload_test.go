@@ -0,0 +1,49 @@
+package server
+
+import (
+	"flag"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReloadConfig(t *testing.T) {
+	path := writeConfigFile(t, `{"idle-timeout": "5m"}`)
+	args := []string{"-config-file", path}
+	define := func(config *Config, f *Flags) {
+		f.set.SetOutput(io.Discard)
+		config.AddFlags(f)
+		config.AddListenFlags(f, ":8080")
+		config.AddLimitFlags(f)
+	}
+	_, current, err := loadConfig("test", define, args, flag.ContinueOnError)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	var applied *Config
+	reload := func(contents string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal("Error writing config file:", err)
+		}
+		applied = nil
+		current = reloadConfig("test", current, define, args, func(next *Config) { applied = next })
+	}
+
+	reload(`{"idle-timeout": "1m", "listen-addr": ":9000"}`)
+	if applied == nil || applied.Limits.IdleTimeout != time.Minute {
+		t.Fatalf("Expected the new idle timeout to be applied, got %+v", applied)
+	}
+
+	reload(`{"idle-timeout": "1m", "listen-addr": ":9001"}`)
+	if applied != nil {
+		t.Fatal("Expected a change that needs a restart not to be applied")
+	}
+
+	reload(`{"idle-timeout": "forever"}`)
+	if applied != nil || current.value("idle-timeout") != "1m0s" {
+		t.Fatalf("Expected an invalid configuration to be rejected, got idle timeout %s", current.value("idle-timeout"))
+	}
+}
@@ -0,0 +1,9 @@
+//go:build aix || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package server
+
+import "syscall"
+
+func setReusePort(fd uintptr) error {
+	return syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEPORT, 1)
+}
@@ -0,0 +1,13 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+
+package server
+
+import "syscall"
+
+// The syscall package predates SO_REUSEPORT on Linux, so its value is spelled
+// out here. It differs on MIPS, which falls back to reuseport_other.go.
+const soReusePort = 0xf
+
+func setReusePort(fd uintptr) error {
+	return syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+}
@@ -0,0 +1,9 @@
+//go:build !(linux && !mips && !mipsle && !mips64 && !mips64le) && !aix && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package server
+
+import "errors"
+
+func setReusePort(fd uintptr) error {
+	return errors.New("SO_REUSEPORT is not supported on this platform")
+}
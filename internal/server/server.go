@@ -0,0 +1,445 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"maps"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultShutdownTimeout is how long Serve waits for in-flight connections
+// to finish after its context is cancelled, unless ShutdownTimeout is set.
+const DefaultShutdownTimeout = 10 * time.Second
+
+// DefaultDrainTimeout is how long Serve keeps serving connections after a
+// handoff, unless DrainTimeout is set. It is longer than
+// DefaultShutdownTimeout, as the process is not being asked to stop, but
+// bounded, so that an old process doesn't linger for as long as its clients
+// stay connected.
+const DefaultDrainTimeout = 5 * time.Minute
+
+// Server accepts TCP connections on Addr and runs Handler for each of them in
+// its own goroutine. Unlike a bare listener it keeps track of the connections
+// it has handed out, so that Shutdown can wait for them to drain.
+type Server struct {
+	// Name identifies the service in metrics. It may be left empty.
+	Name string
+
+	// Addr is a TCP address such as ":8080", or the path of a unix domain
+	// socket prefixed with "unix:". Clients on a unix socket all count as the
+	// same source for MaxConnsPerIP.
+	Addr    string
+	Handler Handler
+
+	// Listener, if set, is served instead of binding Addr, such as a
+	// PipeListener in tests.
+	Listener net.Listener
+
+	// Middleware wraps Handler, outermost first. Recover is always applied
+	// outside of it, so a panicking handler only drops its own connection.
+	Middleware []Middleware
+
+	// Logger is used for the server's own messages and as the parent of each
+	// connection's logger (see Logger). Nil means slog.Default().
+	Logger *slog.Logger
+
+	// ShutdownTimeout bounds how long Serve drains connections once its
+	// context is cancelled. Zero means DefaultShutdownTimeout.
+	ShutdownTimeout time.Duration
+
+	// DrainTimeout instead bounds the drain once the process has handed its
+	// sockets to a new one (see ErrHandedOff). Zero means
+	// DefaultDrainTimeout, and a negative value waits for every client to
+	// leave, which clients that never disconnect on their own, such as the
+	// speed daemon's cameras, may never do.
+	DrainTimeout time.Duration
+
+	// MaxConns caps the number of concurrent connections and MaxConnsPerIP
+	// the number of concurrent connections from a single source address.
+	// Zero means unlimited.
+	MaxConns      int
+	MaxConnsPerIP int
+
+	// RejectMessage is written to connections turned away by MaxConns or
+	// MaxConnsPerIP before they are closed. If nil they are closed immediately.
+	RejectMessage []byte
+
+	// TLSConfig, if set, makes the server terminate TLS on every accepted
+	// connection, so handlers read and write plaintext as usual.
+	TLSConfig *tls.Config
+
+	// HandshakeTimeout is how long a new client has to send its first
+	// bytes (including any TLS handshake). After that, IdleTimeout bounds
+	// every wait for more input and WriteTimeout every write to the client.
+	// Zero disables the respective timeout.
+	HandshakeTimeout time.Duration
+	IdleTimeout      time.Duration
+	WriteTimeout     time.Duration
+
+	// ProxyProtocol makes the server read a PROXY protocol header from
+	// every connection, so that handlers, logs and MaxConnsPerIP see the
+	// client behind a load balancer via RemoteAddr. ProxyHeaderTimeout bounds
+	// the wait for it and defaults to DefaultProxyHeaderTimeout.
+	ProxyProtocol      ProxyProtocolMode
+	ProxyHeaderTimeout time.Duration
+
+	// SocketOptions tunes the listening socket and every accepted connection.
+	SocketOptions SocketOptions
+
+	// WebSocketOrigins are the pages that may use the service through
+	// ServeWebSocket.
+	WebSocketOrigins WebSocketOrigins
+
+	overrides atomic.Pointer[Limits]
+	parent    *Server // Whose limits apply, for a WebSocket front end
+	metrics   *serverMetrics
+	mu        sync.Mutex
+	listener  net.Listener
+	conns     map[net.Conn]struct{}
+	ipConns   map[string]int
+	headers   map[net.Conn]struct{} // Still sending their PROXY header
+	handlers  sync.WaitGroup
+	closing   bool
+}
+
+func NewServer(addr string, handle Handler) *Server {
+	return &Server{
+		Addr:    addr,
+		Handler: handle,
+	}
+}
+
+// Listen binds the server's listener. It is called implicitly by Start and
+// Serve, but calling it first lets the caller learn the bound address.
+//
+// If the process was passed listening sockets by a socket-activating
+// supervisor (LISTEN_FDS), Listen adopts one of them instead of binding
+// Addr: the one whose LISTEN_FDNAMES entry is the server's Name, or else the
+// first stream socket not claimed by another server.
+func (s *Server) Listen() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listener != nil {
+		return nil
+	}
+
+	if s.Listener != nil {
+		s.listener = s.Listener
+		registerSocket(s, s.Name, s.Listener)
+		return nil
+	}
+
+	if listener := activation().listener(s.Name); listener != nil {
+		s.listener = listener
+		registerSocket(s, s.Name, listener)
+		s.logger().Info("Server is listening on an inherited socket", "addr", listener.Addr().String())
+		return nil
+	}
+
+	listener, err := s.SocketOptions.listenStream(s.Addr)
+	if err != nil {
+		s.logger().Error("Error starting server", "addr", s.Addr, "err", err)
+		return err
+	}
+	s.listener = listener
+	registerSocket(s, s.Name, listener)
+
+	s.logger().Info("Server is listening", "addr", listener.Addr().String())
+	return nil
+}
+
+// Start binds the listener and accepts connections in the background until
+// the listener is closed or the server is shut down.
+func (s *Server) Start() (net.Listener, error) {
+	if err := s.Listen(); err != nil {
+		return nil, err
+	}
+	go s.acceptLoop()
+	return s.listener, nil
+}
+
+// Serve accepts connections until ctx is cancelled, then shuts the server
+// down, giving in-flight connections up to ShutdownTimeout to finish.
+//
+// If ctx was cancelled with ErrHandedOff, the connections get DrainTimeout
+// instead, and Serve returns nil even if some of them had to be closed: the
+// new process serves their clients once they reconnect.
+func (s *Server) Serve(ctx context.Context) error {
+	if err := s.Listen(); err != nil {
+		return err
+	}
+
+	accepting := make(chan struct{})
+	go func() {
+		s.acceptLoop()
+		close(accepting)
+	}()
+
+	select {
+	case <-accepting:
+		return nil // Listener was closed by someone else
+	case <-ctx.Done():
+	}
+
+	if errors.Is(context.Cause(ctx), ErrHandedOff) {
+		return s.drain()
+	}
+
+	timeout := s.ShutdownTimeout
+	if timeout == 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.Shutdown(shutdownCtx)
+}
+
+// drain shuts the server down after a handoff, waiting up to DrainTimeout
+// for its connections to finish.
+func (s *Server) drain() error {
+	drainCtx := context.Background()
+	timeout := s.DrainTimeout
+	if timeout == 0 {
+		timeout = DefaultDrainTimeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		drainCtx, cancel = context.WithTimeout(drainCtx, timeout)
+		defer cancel()
+	}
+
+	s.logger().Info("Draining connections after handoff")
+	if err := s.Shutdown(drainCtx); err != nil {
+		s.logger().Warn("Closed connections still open after handoff", "drain_timeout", timeout)
+	}
+	return nil
+}
+
+// Shutdown stops accepting new connections and waits for the tracked
+// handlers to return. If ctx expires first, the remaining connections are
+// force-closed and ctx's error is returned once their handlers have exited.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+	if s.listener != nil {
+		unregisterSocket(s)
+		s.listener.Close()
+	}
+	s.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		s.logger().Info("All connections drained")
+		return nil
+	case <-ctx.Done():
+	}
+
+	// Closing a conn can block, a TLS or WebSocket one on its close
+	// message, so close them without holding the lock that track, untrack
+	// and the inventory need.
+	s.mu.Lock()
+	conns := slices.Collect(maps.Keys(s.conns))
+	conns = slices.AppendSeq(conns, maps.Keys(s.headers))
+	s.mu.Unlock()
+
+	s.logger().Warn("Shutdown deadline exceeded, closing remaining connections", "conns", len(conns))
+	for _, conn := range conns {
+		conn.Close()
+	}
+
+	<-drained
+	return ctx.Err()
+}
+
+func (s *Server) acceptLoop() {
+	handle := Chain(s.Handler, append([]Middleware{Recover()}, s.Middleware...)...)
+	s.metrics = newServerMetrics(s.Name)
+
+	var backoff time.Duration
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			// Check if the listener was closed
+			if errors.Is(err, net.ErrClosed) {
+				unregisterSocket(s)
+				return // Exit the goroutine gracefully
+			}
+			// Errors such as EMFILE persist until some connections go away,
+			// so back off instead of spinning on them.
+			backoff = nextAcceptBackoff(backoff)
+			s.logger().Error("Error accepting connection", "err", err, "retry_in", backoff)
+			time.Sleep(backoff)
+			continue
+		}
+		backoff = 0
+
+		if err := s.SocketOptions.applyConn(conn); err != nil {
+			s.logger().Warn("Error setting socket options", "remote_addr", conn.RemoteAddr().String(), "err", err)
+		}
+
+		if s.ProxyProtocol == ProxyProtocolOff {
+			s.admit(conn, handle)
+			continue
+		}
+
+		// The PROXY header carries the address that connection limits apply
+		// to, so it is read before admission, off the accept loop. Until
+		// then the connection is tracked apart from admitted ones, so that
+		// Shutdown waits for the read and can cut it short.
+		if !s.trackHeader(conn) {
+			conn.Close()
+			continue
+		}
+		go func() {
+			defer s.untrackHeader(conn)
+			proxied, err := s.readProxyHeader(conn)
+			if err != nil {
+				s.logger().Warn("Rejecting connection, invalid PROXY protocol header", "remote_addr", conn.RemoteAddr().String(), "err", err)
+				conn.Close()
+				return
+			}
+			s.admit(proxied, handle)
+		}()
+	}
+}
+
+// admit hands conn to the handler in a new goroutine if the server can take
+// it, and turns it away otherwise.
+func (s *Server) admit(conn net.Conn, handle Handler) {
+	switch s.track(conn) {
+	case admitted:
+	case rejected:
+		go s.reject(conn)
+		return
+	default:
+		conn.Close()
+		return
+	}
+
+	go func() {
+		defer s.untrack(conn)
+		wrapped := s.wrap(conn)
+		defer trackConn(s.Name, wrapped)()
+		handle(wrapped)
+	}()
+}
+
+// wrap layers the configured transport features over a tracked connection
+// before it is passed to the handler.
+func (s *Server) wrap(conn net.Conn) net.Conn {
+	conn = s.withDeadlines(conn)
+	if s.TLSConfig != nil {
+		conn = tls.Server(conn, s.TLSConfig)
+	}
+	conn = &countingConn{Conn: conn, totalRead: s.metrics.bytesRead, totalWritten: s.metrics.bytesWritten}
+	return s.withLogger(conn)
+}
+
+// track registers conn as in flight, unless the server is shutting down or
+// the connection limits have been reached.
+func (s *Server) track(conn net.Conn) admission {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closing {
+		return closing
+	}
+
+	ip := sourceIP(conn)
+	limits := s.limits()
+	if limits.MaxConns > 0 && len(s.conns) >= limits.MaxConns {
+		s.logger().Warn("Rejecting connection, server is at its connection limit", "remote_ip", ip, "max_conns", limits.MaxConns)
+		s.metrics.rejected.Inc()
+		return rejected
+	}
+	if limits.MaxConnsPerIP > 0 && s.ipConns[ip] >= limits.MaxConnsPerIP {
+		s.logger().Warn("Rejecting connection, source is at its connection limit", "remote_ip", ip, "max_conns_per_ip", limits.MaxConnsPerIP)
+		s.metrics.rejected.Inc()
+		return rejected
+	}
+
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]struct{})
+		s.ipConns = make(map[string]int)
+	}
+	s.conns[conn] = struct{}{}
+	s.ipConns[ip]++
+	s.handlers.Add(1)
+	s.metrics.accepted.Inc()
+	s.metrics.active.Inc()
+	return admitted
+}
+
+// trackHeader registers conn as in flight while its PROXY header is read,
+// unless the server is shutting down. It counts towards neither connection
+// limit, as the header is what says which client it is.
+func (s *Server) trackHeader(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closing {
+		return false
+	}
+	if s.headers == nil {
+		s.headers = make(map[net.Conn]struct{})
+	}
+	s.headers[conn] = struct{}{}
+	s.handlers.Add(1)
+	return true
+}
+
+// untrackHeader is called once conn has been admitted or turned away, after
+// admit has tracked it in its own right if need be.
+func (s *Server) untrackHeader(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.headers, conn)
+	s.mu.Unlock()
+	s.handlers.Done()
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	ip := sourceIP(conn)
+	if s.ipConns[ip]--; s.ipConns[ip] <= 0 {
+		delete(s.ipConns, ip)
+	}
+	s.metrics.active.Dec()
+	s.mu.Unlock()
+	s.handlers.Done()
+}
+
+type serverMetrics struct {
+	accepted     *Counter
+	rejected     *Counter
+	active       *Gauge
+	bytesRead    *Counter
+	bytesWritten *Counter
+}
+
+func newServerMetrics(name string) *serverMetrics {
+	var labels []string
+	if name != "" {
+		labels = []string{"service", name}
+	}
+	return &serverMetrics{
+		accepted:     NewCounter("server_connections_accepted_total", "Connections accepted and handed to a handler.", labels...),
+		rejected:     NewCounter("server_connections_rejected_total", "Connections turned away by connection limits.", labels...),
+		active:       NewGauge("server_connections_active", "Connections currently being handled.", labels...),
+		bytesRead:    NewCounter("server_bytes_read_total", "Bytes read from clients.", labels...),
+		bytesWritten: NewCounter("server_bytes_written_total", "Bytes written to clients.", labels...),
+	}
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestShutdownWaitsForHandlers(t *testing.T) {
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	s := NewServer(":0", func(conn net.Conn) {
+		defer conn.Close()
+		<-release
+		conn.Write([]byte("bye\n"))
+		close(finished)
+	})
+
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Close()
+	waitForConns(t, s, 1)
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- s.Shutdown(context.Background())
+	}()
+
+	select {
+	case err := <-shutdownErr:
+		t.Fatal("Shutdown returned before the handler finished:", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-shutdownErr; err != nil {
+		t.Fatal("Expected clean shutdown, got:", err)
+	}
+	<-finished
+
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "bye\n" {
+		t.Fatalf("Expected in-flight write to complete, got %q (%v)", buf, err)
+	}
+
+	if _, err := net.Dial("tcp", listener.Addr().String()); err == nil {
+		t.Fatal("Expected new connections to be refused after shutdown")
+	}
+}
+
+func TestShutdownForceClosesAfterDeadline(t *testing.T) {
+	s := NewServer(":0", func(conn net.Conn) {
+		defer conn.Close()
+		io.Copy(io.Discard, conn) // Blocks until the connection is closed
+	})
+
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Close()
+	waitForConns(t, s, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("Expected deadline exceeded, got:", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatal("Expected the server to close the connection, got:", err)
+	}
+}
+
+func TestServeShutsDownWhenContextIsCancelled(t *testing.T) {
+	s := NewServer(":0", func(conn net.Conn) { conn.Close() })
+	s.ShutdownTimeout = time.Second
+	if err := s.Listen(); err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(ctx)
+	}()
+
+	cancel()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatal("Expected clean shutdown, got:", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Serve did not return after the context was cancelled")
+	}
+}
+
+// serveHandedOff serves s with a client that never leaves on its own, like
+// a camera, and cancels Serve's context as a handoff does. It returns the
+// client and Serve's result.
+func serveHandedOff(t *testing.T, s *Server) (net.Conn, <-chan error) {
+	t.Helper()
+	if err := s.Listen(); err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	t.Cleanup(func() { cancel(nil) })
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(ctx)
+	}()
+
+	conn, err := net.Dial("tcp", s.listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	waitForConns(t, s, 1)
+	cancel(ErrHandedOff)
+	return conn, served
+}
+
+func TestServeDrainsWithoutBoundAfterHandoffIfDrainTimeoutIsNegative(t *testing.T) {
+	s := NewServer("127.0.0.1:0", holdOpen)
+	s.ShutdownTimeout = 10 * time.Millisecond
+	s.DrainTimeout = -1
+	conn, served := serveHandedOff(t, s)
+
+	select {
+	case err := <-served:
+		t.Fatal("Serve returned while a client was still connected:", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	conn.Close()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatal("Expected clean shutdown, got:", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Serve did not return once the client left")
+	}
+}
+
+func TestServeReportsNoErrorWhenHandoffDrainTimesOut(t *testing.T) {
+	s := NewServer("127.0.0.1:0", holdOpen)
+	s.DrainTimeout = 50 * time.Millisecond
+	conn, served := serveHandedOff(t, s)
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatal("Expected a planned exit after handoff, got:", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Serve did not return after DrainTimeout")
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatal("Expected the server to close the connection, got:", err)
+	}
+}
+
+// waitForConns waits until the server is tracking n connections.
+func waitForConns(t *testing.T, s *Server, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		tracked := len(s.conns)
+		s.mu.Unlock()
+		if tracked == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Expected %d tracked connections", n)
+}
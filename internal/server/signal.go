@@ -0,0 +1,30 @@
+package server
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// SignalContext returns a context that is cancelled when the process is asked
+// to stop with SIGINT or SIGTERM (e.g. by docker-compose), or once it has
+// handed its sockets to a new process after a HandoffSignal, in which case
+// its cause is ErrHandedOff. From then on SIGINT and SIGTERM kill the
+// process outright, as it may be draining for a while.
+//
+// A container stops when its PID 1 exits, and with it the process a handoff
+// started. Config.SignalContext can keep PID 1 behind as init to prevent
+// that.
+func SignalContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	ctx, cancel := context.WithCancelCause(ctx)
+	go handoffOnSignal(ctx, func() {
+		cancel(ErrHandedOff)
+		stop() // Let SIGINT and SIGTERM cut the drain short
+	})
+	return ctx, func() {
+		cancel(nil)
+		stop()
+	}
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// SocketOptions tunes the sockets of a Server or UdpServer. The zero value
+// keeps Go's and the operating system's defaults. Options that only make
+// sense for TCP are ignored by UdpServer.
+type SocketOptions struct {
+	// KeepAlive is the TCP keepalive period. Zero means Go's default of 15
+	// seconds and a negative value disables keepalives.
+	KeepAlive time.Duration
+
+	// Nagle enables Nagle's algorithm by clearing TCP_NODELAY, which Go sets
+	// on every connection. It trades latency for fewer small packets.
+	Nagle bool
+
+	// Linger sets SO_LINGER, how long closing a connection may block to
+	// flush unsent data. Zero leaves the default of flushing in the
+	// background, and a negative value discards unsent data and resets the
+	// connection.
+	Linger time.Duration
+
+	// ReadBuffer and WriteBuffer set SO_RCVBUF and SO_SNDBUF in bytes. Zero
+	// leaves the operating system's default.
+	ReadBuffer  int
+	WriteBuffer int
+
+	// ReusePort sets SO_REUSEPORT, letting several processes bind the same
+	// address and share its traffic. It is not available on every platform.
+	ReusePort bool
+
+	// IPVersion restricts a socket bound to a wildcard address or host name
+	// to IPv4 or IPv6. The default binds both where the system allows it.
+	IPVersion IPVersion
+}
+
+// IPVersion selects the IP versions a socket accepts.
+type IPVersion int
+
+const (
+	// IPDualStack accepts IPv4 and IPv6, the latter as IPv4-mapped
+	// addresses on a single socket where the system supports it.
+	IPDualStack IPVersion = iota
+
+	// IPv4Only accepts IPv4 only.
+	IPv4Only
+
+	// IPv6Only accepts IPv6 only, setting IPV6_V6ONLY on wildcard sockets.
+	IPv6Only
+)
+
+var ipVersionNames = []string{"dual", "4", "6"}
+
+func (v IPVersion) String() string {
+	if int(v) < len(ipVersionNames) {
+		return ipVersionNames[v]
+	}
+	return fmt.Sprintf("IPVersion(%d)", int(v))
+}
+
+// UnmarshalText parses "dual", "4" or "6". Empty text means dual.
+func (v *IPVersion) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*v = IPDualStack
+		return nil
+	}
+	for i, name := range ipVersionNames {
+		if strings.EqualFold(strings.TrimPrefix(strings.ToLower(string(text)), "ipv"), name) {
+			*v = IPVersion(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown IP version %q, expected dual, 4 or 6", text)
+}
+
+// network returns the network to bind for base, which is "tcp" or "udp".
+func (o SocketOptions) network(base string) string {
+	switch o.IPVersion {
+	case IPv4Only:
+		return base + "4"
+	case IPv6Only:
+		return base + "6"
+	}
+	return base
+}
+
+// listenConfig applies the options that have to be set before binding.
+func (o SocketOptions) listenConfig() *net.ListenConfig {
+	return &net.ListenConfig{
+		KeepAlive: o.KeepAlive,
+		Control:   o.control,
+	}
+}
+
+func (o SocketOptions) control(network, address string, c syscall.RawConn) error {
+	if !o.ReusePort {
+		return nil
+	}
+	var err error
+	if controlErr := c.Control(func(fd uintptr) { err = setReusePort(fd) }); controlErr != nil {
+		return controlErr
+	}
+	if err != nil {
+		return fmt.Errorf("setting SO_REUSEPORT: %w", err)
+	}
+	return nil
+}
+
+// applyConn sets the per-connection options on an accepted TCP connection.
+func (o SocketOptions) applyConn(conn net.Conn) error {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	if o.Nagle {
+		if err := tcpConn.SetNoDelay(false); err != nil {
+			return err
+		}
+	}
+	if o.Linger != 0 {
+		seconds := 0 // Reset on close
+		if o.Linger > 0 {
+			seconds = int((o.Linger + time.Second - 1) / time.Second)
+		}
+		if err := tcpConn.SetLinger(seconds); err != nil {
+			return err
+		}
+	}
+	return o.applyBuffers(tcpConn)
+}
+
+func (o SocketOptions) applyBuffers(conn interface {
+	SetReadBuffer(int) error
+	SetWriteBuffer(int) error
+}) error {
+	if o.ReadBuffer > 0 {
+		if err := conn.SetReadBuffer(o.ReadBuffer); err != nil {
+			return err
+		}
+	}
+	if o.WriteBuffer > 0 {
+		if err := conn.SetWriteBuffer(o.WriteBuffer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnmarshalText parses a comma-separated list of options, such as
+// "keepalive=30s,nagle,linger=-1s,rcvbuf=65536,sndbuf=65536,reuseport".
+// Boolean options may be given as a bare name or as name=true/false.
+func (o *SocketOptions) UnmarshalText(text []byte) error {
+	var parsed SocketOptions
+	for option := range strings.SplitSeq(string(text), ",") {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+		key, value, hasValue := strings.Cut(option, "=")
+
+		var err error
+		switch strings.ToLower(key) {
+		case "keepalive":
+			parsed.KeepAlive, err = time.ParseDuration(value)
+		case "nagle":
+			parsed.Nagle, err = parseFlag(value, hasValue)
+		case "linger":
+			parsed.Linger, err = time.ParseDuration(value)
+		case "rcvbuf":
+			parsed.ReadBuffer, err = strconv.Atoi(value)
+		case "sndbuf":
+			parsed.WriteBuffer, err = strconv.Atoi(value)
+		case "reuseport":
+			parsed.ReusePort, err = parseFlag(value, hasValue)
+		default:
+			return fmt.Errorf("unknown socket option %q", key)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value for socket option %q: %w", key, err)
+		}
+	}
+	*o = parsed
+	return nil
+}
+
+func parseFlag(value string, hasValue bool) (bool, error) {
+	if !hasValue {
+		return true, nil
+	}
+	return strconv.ParseBool(value)
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// acceptedSocket connects to s and returns the file descriptor of the
+// connection the server accepted, once it has echoed a message.
+func acceptedSocket(t *testing.T, s *Server) syscall.RawConn {
+	t.Helper()
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("Expected an echo with socket options set, got %q (%v)", buf, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for accepted := range s.conns {
+		raw, err := accepted.(*net.TCPConn).SyscallConn()
+		if err != nil {
+			t.Fatal("Error getting the accepted socket:", err)
+		}
+		return raw
+	}
+	t.Fatal("Expected the server to track the accepted connection")
+	return nil
+}
+
+// getsockoptLinger reads SO_LINGER, which syscall has no getter for.
+func getsockoptLinger(fd int) (syscall.Linger, error) {
+	var linger syscall.Linger
+	size := uint32(unsafe.Sizeof(linger))
+	_, _, errno := syscall.Syscall6(syscall.SYS_GETSOCKOPT, uintptr(fd), syscall.SOL_SOCKET, syscall.SO_LINGER,
+		uintptr(unsafe.Pointer(&linger)), uintptr(unsafe.Pointer(&size)), 0)
+	if errno != 0 {
+		return linger, errno
+	}
+	return linger, nil
+}
+
+func TestSocketOptionsAreApplied(t *testing.T) {
+	tests := []struct {
+		options   SocketOptions
+		keepAlive int // SO_KEEPALIVE
+		keepIdle  int // TCP_KEEPIDLE in seconds, if keepalives are on
+		noDelay   int
+		linger    syscall.Linger
+	}{
+		{
+			options:   SocketOptions{KeepAlive: time.Minute, Nagle: true, Linger: -1, ReadBuffer: 40000, WriteBuffer: 30000},
+			keepAlive: 1, keepIdle: 60, noDelay: 0, linger: syscall.Linger{Onoff: 1, Linger: 0},
+		},
+		{
+			options:   SocketOptions{KeepAlive: -1, Linger: 2500 * time.Millisecond},
+			keepAlive: 0, noDelay: 1, linger: syscall.Linger{Onoff: 1, Linger: 3},
+		},
+	}
+	for _, tt := range tests {
+		s := NewServer("127.0.0.1:0", echo)
+		s.SocketOptions = tt.options
+		raw := acceptedSocket(t, s)
+
+		var errs []error
+		get := func(level, option int) int {
+			var value int
+			raw.Control(func(fd uintptr) {
+				var err error
+				value, err = syscall.GetsockoptInt(int(fd), level, option)
+				errs = append(errs, err)
+			})
+			return value
+		}
+		check := func(name string, got, want int) {
+			if got != want {
+				t.Errorf("Options %+v: expected %s %d, got %d", tt.options, name, want, got)
+			}
+		}
+
+		check("SO_KEEPALIVE", get(syscall.SOL_SOCKET, syscall.SO_KEEPALIVE), tt.keepAlive)
+		if tt.keepAlive == 1 {
+			check("TCP_KEEPIDLE", get(syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE), tt.keepIdle)
+		}
+		check("TCP_NODELAY", get(syscall.IPPROTO_TCP, syscall.TCP_NODELAY), tt.noDelay)
+		// Linux doubles the requested buffer sizes to leave room for its
+		// bookkeeping, and reports the doubled size.
+		if tt.options.ReadBuffer > 0 {
+			check("SO_RCVBUF", get(syscall.SOL_SOCKET, syscall.SO_RCVBUF), 2*tt.options.ReadBuffer)
+		}
+		if tt.options.WriteBuffer > 0 {
+			check("SO_SNDBUF", get(syscall.SOL_SOCKET, syscall.SO_SNDBUF), 2*tt.options.WriteBuffer)
+		}
+		raw.Control(func(fd uintptr) {
+			linger, err := getsockoptLinger(int(fd))
+			errs = append(errs, err)
+			if linger != tt.linger {
+				t.Errorf("Options %+v: expected SO_LINGER %+v, got %+v", tt.options, tt.linger, linger)
+			}
+		})
+		for _, err := range errs {
+			if err != nil {
+				t.Fatal("Error reading socket option:", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestSocketOptionsUnmarshalText(t *testing.T) {
+	var o SocketOptions
+	err := o.UnmarshalText([]byte("keepalive=30s, nagle,linger=-1s,rcvbuf=65536,sndbuf=32768,reuseport=false"))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	expected := SocketOptions{
+		KeepAlive:   30 * time.Second,
+		Nagle:       true,
+		Linger:      -time.Second,
+		ReadBuffer:  65536,
+		WriteBuffer: 32768,
+	}
+	if o != expected {
+		t.Fatalf("Expected %+v, got %+v", expected, o)
+	}
+
+	for _, text := range []string{"nodelay", "keepalive=forever", "rcvbuf"} {
+		if err := o.UnmarshalText([]byte(text)); err == nil {
+			t.Fatalf("Expected an error for %q", text)
+		}
+	}
+}
+
+func TestReusePortSharesAddress(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("SO_REUSEPORT semantics are only tested on Linux")
+	}
+	options := SocketOptions{ReusePort: true}
+
+	first := NewServer("127.0.0.1:0", echo)
+	first.SocketOptions = options
+	listener, err := first.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	second := NewServer(listener.Addr().String(), echo)
+	second.SocketOptions = options
+	if err := second.Listen(); err != nil {
+		t.Fatal("Expected a second TCP server on the same address:", err)
+	}
+	second.Shutdown(t.Context())
+
+	udp := NewUdpServer("127.0.0.1:0", udpEcho)
+	udp.SocketOptions = options
+	if err := udp.Listen(); err != nil {
+		t.Fatal("Error starting UDP server:", err)
+	}
+	defer udp.Close()
+
+	sharing := NewUdpServer(udp.LocalAddr().String(), udpEcho)
+	sharing.SocketOptions = options
+	if err := sharing.Listen(); err != nil {
+		t.Fatal("Expected a second UDP server on the same address:", err)
+	}
+	sharing.Close()
+}
+
+func TestListenIPv4Only(t *testing.T) {
+	s := NewServer("localhost:0", func(conn net.Conn) { conn.Close() })
+	s.SocketOptions.IPVersion = IPv4Only
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer s.Shutdown(t.Context())
+
+	if addr := listener.Addr().(*net.TCPAddr); addr.IP.To4() == nil {
+		t.Fatalf("Expected an IPv4 listener, got %s", addr)
+	}
+}
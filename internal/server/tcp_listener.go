@@ -1,36 +1,20 @@
 package server
 
 import (
-	"errors"
-	"log"
+	"crypto/tls"
 	"net"
 )
 
+// StartTcpListener starts a Server with default settings on addr and returns
+// its listener. Closing the listener stops accepting new connections.
 func StartTcpListener(addr string, handle func(net.Conn)) (net.Listener, error) {
-	listener, err := net.Listen("tcp", addr)
-	if err != nil {
-		log.Println("Error starting server:", err)
-		return nil, err
-	}
+	return NewServer(addr, handle).Start()
+}
 
-	go func() {
-		for {
-			conn, err := listener.Accept()
-			if err != nil {
-                // Check if the listener was closed
-                if errors.Is(err, net.ErrClosed) {
-                    return // Exit the goroutine gracefully
-                }
-                log.Println("Error accepting connection:", err)
-                continue
-            }
-
-			go handle(conn)
-		}
-	}()
-
-	log.Println("********************************")
-	log.Println("Server is listening on", listener.Addr().String())
-	log.Println("********************************")
-	return listener, nil
-}
\ No newline at end of file
+// StartTLSListener is like StartTcpListener, but the server terminates TLS
+// with config unless it is nil.
+func StartTLSListener(addr string, handle func(net.Conn), config *tls.Config) (net.Listener, error) {
+	srv := NewServer(addr, handle)
+	srv.TLSConfig = config
+	return srv.Start()
+}
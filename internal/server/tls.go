@@ -0,0 +1,162 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+)
+
+// LoadTLSConfig builds a server TLS config from a PEM encoded certificate
+// and private key on disk.
+func LoadTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// loadTLSConfig loads the certificate and key the config names, if any, for
+// Configure to hand to its servers.
+func (c *Config) loadTLSConfig() error {
+	c.tlsConfig = nil
+	if c.TLSCertFile == "" && c.TLSKeyFile == "" {
+		return nil
+	}
+	if c.TLSCertFile == "" || c.TLSKeyFile == "" {
+		return errors.New("-tls-cert and -tls-key must be set together")
+	}
+	config, err := LoadTLSConfig(c.TLSCertFile, c.TLSKeyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	c.tlsConfig = config
+	return nil
+}
+
+// healthcheckTLSConfig is the client side of the config's TLS settings, for
+// a healthcheck. It trusts exactly the certificate the service is configured
+// with, since the healthcheck dials a loopback address that the certificate
+// need not name.
+func (c *Config) healthcheckTLSConfig() *tls.Config {
+	want := c.tlsConfig.Certificates[0].Certificate[0]
+	return &tls.Config{
+		InsecureSkipVerify: true, // VerifyConnection checks the certificate instead
+		VerifyConnection: func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 || !bytes.Equal(state.PeerCertificates[0].Raw, want) {
+				return errors.New("the service presented a certificate other than the configured one")
+			}
+			return nil
+		},
+		MinVersion: tls.VersionTLS12,
+	}
+}
+
+// SelfSignedTLSConfig generates an in-memory self-signed certificate for the
+// given hosts (localhost by default) and returns a server config using it
+// along with a client config that trusts it. It is meant for tests.
+func SelfSignedTLSConfig(hosts ...string) (serverConfig, clientConfig *tls.Config, err error) {
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1", "::1"}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"go_protohackers"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+
+	serverConfig = &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{der},
+			PrivateKey:  key,
+			Leaf:        leaf,
+		}},
+		MinVersion: tls.VersionTLS12,
+	}
+	clientConfig = &tls.Config{
+		RootCAs:    roots,
+		ServerName: hosts[0],
+		MinVersion: tls.VersionTLS12,
+	}
+	return serverConfig, clientConfig, nil
+}
+
+// Dial connects to a TCP server at addr, over TLS if config is non-nil, so
+// tests can exercise the same handler with and without TLS.
+func Dial(addr string, config *tls.Config) (net.Conn, error) {
+	if config == nil {
+		return net.Dial("tcp", addr)
+	}
+	conn, err := tls.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, err // Not a nil *tls.Conn, which isn't a nil net.Conn
+	}
+	return conn, nil
+}
+
+// Transport is a way for tests to reach a TCP service: Server is the config
+// to start it with, as by StartTLSListener, and Client the config to Dial it
+// with. Both are nil for plain TCP.
+type Transport struct {
+	Server, Client *tls.Config
+}
+
+// Transports returns the transports that service tests run over, by name:
+// plain TCP, and TLS with a self-signed certificate.
+func Transports() (map[string]Transport, error) {
+	serverConfig, clientConfig, err := SelfSignedTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]Transport{
+		"plain": {},
+		"tls":   {Server: serverConfig, Client: clientConfig},
+	}, nil
+}
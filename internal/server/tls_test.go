@@ -0,0 +1,187 @@
+package server
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func echo(conn net.Conn) {
+	defer conn.Close()
+	io.Copy(conn, conn)
+}
+
+func TestTLSEcho(t *testing.T) {
+	serverConfig, clientConfig, err := SelfSignedTLSConfig()
+	if err != nil {
+		t.Fatal("Error generating certificate:", err)
+	}
+
+	s := NewServer("127.0.0.1:0", echo)
+	s.TLSConfig = serverConfig
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, err := Dial(listener.Addr().String(), clientConfig)
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("Hello, TLS!\n"))
+	scanner := bufio.NewScanner(conn)
+	if !scanner.Scan() || scanner.Text() != "Hello, TLS!" {
+		t.Fatalf("Expected echo over TLS, got %q (%v)", scanner.Text(), scanner.Err())
+	}
+}
+
+func TestTLSRejectsPlaintextClient(t *testing.T) {
+	serverConfig, _, err := SelfSignedTLSConfig()
+	if err != nil {
+		t.Fatal("Error generating certificate:", err)
+	}
+
+	s := NewServer("127.0.0.1:0", echo)
+	s.TLSConfig = serverConfig
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, err := Dial(listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("Hello, plaintext!\n"))
+	reply, _ := io.ReadAll(conn)
+	if string(reply) == "Hello, plaintext!\n" {
+		t.Fatal("Expected plaintext to be refused by the TLS server")
+	}
+}
+
+func TestTLSDialErrorReturnsNilConn(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening:", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	conn, err := Dial(addr, &tls.Config{})
+	if err == nil {
+		t.Fatal("Expected dialing a closed port to fail")
+	}
+	if conn != nil {
+		t.Fatalf("Expected a nil conn, got %#v", conn)
+	}
+}
+
+// writeCertificate writes the certificate and key of a server TLS config to
+// PEM files for the test and returns their paths.
+func writeCertificate(t *testing.T, config *tls.Config) (certFile, keyFile string) {
+	t.Helper()
+	cert := config.Certificates[0]
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal("Error encoding key:", err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key})
+	if err := os.WriteFile(certFile, certPEM, 0o644); err != nil {
+		t.Fatal("Error writing certificate:", err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal("Error writing key:", err)
+	}
+	return certFile, keyFile
+}
+
+func TestConfigTerminatesTLS(t *testing.T) {
+	serverConfig, clientConfig, err := SelfSignedTLSConfig()
+	if err != nil {
+		t.Fatal("Error generating certificate:", err)
+	}
+	certFile, keyFile := writeCertificate(t, serverConfig)
+
+	var config Config
+	if err := testFlags(&config).Parse([]string{"-tls-cert", certFile, "-tls-key", keyFile}); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	s := NewServer("127.0.0.1:0", echo)
+	config.Configure(s)
+	listener, err := s.Start()
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+	addr := listener.Addr().String()
+
+	conn, err := Dial(addr, clientConfig)
+	if err != nil {
+		t.Fatal("Error connecting to server over TLS:", err)
+	}
+	conn.Close()
+
+	check := func(conn net.Conn) error {
+		conn.Write([]byte("hello\n"))
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err == nil && line != "hello\n" {
+			err = errors.New("unexpected echo " + line)
+		}
+		return err
+	}
+	if err := config.CheckHealth(addr, check); err != nil {
+		t.Fatal("Expected a healthcheck over TLS to pass:", err)
+	}
+	if err := new(Config).CheckHealth(addr, check); err == nil {
+		t.Fatal("Expected a plaintext healthcheck of a TLS server to fail")
+	}
+
+	otherConfig, _, err := SelfSignedTLSConfig()
+	if err != nil {
+		t.Fatal("Error generating certificate:", err)
+	}
+	otherCert, otherKey := writeCertificate(t, otherConfig)
+	var other Config
+	if err := testFlags(&other).Parse([]string{"-tls-cert", otherCert, "-tls-key", otherKey}); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err := other.CheckHealth(addr, check); err == nil {
+		t.Fatal("Expected a healthcheck to reject a certificate other than the configured one")
+	}
+}
+
+func TestConfigTLSErrors(t *testing.T) {
+	serverConfig, _, err := SelfSignedTLSConfig()
+	if err != nil {
+		t.Fatal("Error generating certificate:", err)
+	}
+	certFile, keyFile := writeCertificate(t, serverConfig)
+
+	for _, args := range [][]string{
+		{"-tls-cert", certFile},
+		{"-tls-key", keyFile},
+		{"-tls-cert", keyFile, "-tls-key", certFile},
+		{"-tls-cert", filepath.Join(t.TempDir(), "missing.pem"), "-tls-key", keyFile},
+	} {
+		var config Config
+		if err := testFlags(&config).Parse(args); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+}
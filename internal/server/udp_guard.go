@@ -0,0 +1,304 @@
+package server
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UdpGuard protects a UDP service from abuse, in particular from being used
+// to reflect and amplify traffic towards a spoofed source address. The zero
+// value lets everything through.
+type UdpGuard struct {
+	// Allow, if not empty, restricts the service to sources within these
+	// prefixes, and loopback.
+	Allow []netip.Prefix
+
+	// Rate is the sustained number of datagrams per second accepted from a
+	// single source IP, and Burst how many it may send at once. Zero Rate
+	// means unlimited, and zero Burst means Rate rounded up.
+	Rate  float64
+	Burst int
+
+	// MaxAmplification caps the bytes sent in reply to a datagram at this
+	// multiple of its size. Replies that would exceed it are dropped. Zero
+	// means unlimited.
+	MaxAmplification float64
+
+	// Log logs every datagram and reply at debug level.
+	Log bool
+}
+
+// Middleware returns the middleware that enforces the guard, or nil if it
+// lets everything through.
+func (g UdpGuard) Middleware() []UdpMiddleware {
+	var middleware []UdpMiddleware
+	if g.Log {
+		middleware = append(middleware, LogUdp())
+	}
+	if len(g.Allow) > 0 {
+		middleware = append(middleware, AllowUdpSources(g.Allow...))
+	}
+	if g.Rate > 0 {
+		middleware = append(middleware, RateLimitUdp(g.Rate, g.Burst))
+	}
+	if g.MaxAmplification > 0 {
+		middleware = append(middleware, LimitAmplification(g.MaxAmplification))
+	}
+	return middleware
+}
+
+// UnmarshalText parses a comma-separated list of guard settings, such as
+// "allow=10.0.0.0/8|::1,rate=20,burst=40,amplification=10,log". An empty
+// string lets everything through.
+func (g *UdpGuard) UnmarshalText(text []byte) error {
+	var parsed UdpGuard
+	for option := range strings.SplitSeq(string(text), ",") {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+		key, value, hasValue := strings.Cut(option, "=")
+
+		var err error
+		switch strings.ToLower(key) {
+		case "allow":
+			parsed.Allow, err = parsePrefixes(value)
+		case "rate":
+			parsed.Rate, err = strconv.ParseFloat(value, 64)
+		case "burst":
+			parsed.Burst, err = strconv.Atoi(value)
+		case "amplification":
+			parsed.MaxAmplification, err = strconv.ParseFloat(value, 64)
+		case "log":
+			parsed.Log, err = parseFlag(value, hasValue)
+		default:
+			return fmt.Errorf("unknown UDP guard setting %q", key)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value for UDP guard setting %q: %w", key, err)
+		}
+	}
+	*g = parsed
+	return nil
+}
+
+// parsePrefixes parses a "|"-separated list of prefixes, where a bare
+// address stands for itself.
+func parsePrefixes(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for s := range strings.SplitSeq(value, "|") {
+		if prefix, err := netip.ParsePrefix(s); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither a prefix nor an address", s)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+const datagramsRefusedHelp = "Datagrams and replies refused by a UDP guard."
+
+var (
+	refusedByAllowlist     = NewCounter("server_datagrams_refused_total", datagramsRefusedHelp, "reason", "allowlist")
+	refusedByRateLimit     = NewCounter("server_datagrams_refused_total", datagramsRefusedHelp, "reason", "rate_limit")
+	refusedByAmplification = NewCounter("server_datagrams_refused_total", datagramsRefusedHelp, "reason", "amplification")
+)
+
+// sourceAddr returns the IP a datagram came from, with IPv4-mapped IPv6
+// addresses unmapped so that either form matches IPv4 prefixes.
+func sourceAddr(addr *net.UDPAddr) netip.Addr {
+	return addr.AddrPort().Addr().Unmap()
+}
+
+// LogUdp logs every datagram and every reply at debug level.
+func LogUdp() UdpMiddleware {
+	return func(next UdpHandler) UdpHandler {
+		return func(conn UdpConn, buf []byte, n int, addr *net.UDPAddr) {
+			slog.Debug("Datagram received", "remote_addr", addr.String(), "bytes", n)
+			next(&loggedUdpConn{UdpConn: conn}, buf, n, addr)
+		}
+	}
+}
+
+type loggedUdpConn struct {
+	UdpConn
+}
+
+func (c *loggedUdpConn) WriteToUDP(b []byte, addr *net.UDPAddr) (int, error) {
+	n, err := c.UdpConn.WriteToUDP(b, addr)
+	slog.Debug("Datagram sent", "remote_addr", addr.String(), "bytes", n, "err", err)
+	return n, err
+}
+
+// AllowUdpSources drops datagrams from sources outside the given prefixes.
+// Loopback sources are always allowed, as datagrams from them can only come
+// from the host itself, such as the service's own healthcheck.
+func AllowUdpSources(prefixes ...netip.Prefix) UdpMiddleware {
+	return func(next UdpHandler) UdpHandler {
+		return func(conn UdpConn, buf []byte, n int, addr *net.UDPAddr) {
+			source := sourceAddr(addr)
+			if source.IsLoopback() {
+				next(conn, buf, n, addr)
+				return
+			}
+			for _, prefix := range prefixes {
+				if prefix.Contains(source) {
+					next(conn, buf, n, addr)
+					return
+				}
+			}
+			slog.Debug("Refusing datagram, source is not allowed", "remote_addr", addr.String())
+			refusedByAllowlist.Inc()
+		}
+	}
+}
+
+// RateLimitUdp drops datagrams from sources that send more than rate per
+// second on average, or more than burst at once, using a token bucket per
+// source IP. A burst of zero means rate rounded up.
+func RateLimitUdp(rate float64, burst int) UdpMiddleware {
+	if burst <= 0 {
+		burst = int(math.Ceil(rate))
+	}
+	buckets := newTokenBuckets(rate, burst, time.Now)
+	return func(next UdpHandler) UdpHandler {
+		return func(conn UdpConn, buf []byte, n int, addr *net.UDPAddr) {
+			if !buckets.take(sourceAddr(addr)) {
+				slog.Debug("Refusing datagram, source is over its rate limit", "remote_addr", addr.String())
+				refusedByRateLimit.Inc()
+				return
+			}
+			next(conn, buf, n, addr)
+		}
+	}
+}
+
+const (
+	// maxTokenBuckets bounds the memory a flood of spoofed sources can make
+	// a rate limiter use. Once that many sources are being tracked, the one
+	// heard from least recently is forgotten to make room for a new one, so
+	// that the flood can't lock legitimate clients out.
+	maxTokenBuckets = 1 << 16
+
+	// tokenBucketSweepInterval is how often idle sources are forgotten.
+	tokenBucketSweepInterval = time.Minute
+)
+
+type tokenBuckets struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[netip.Addr]*list.Element
+	recent    *list.List // Of *tokenBucket, least recently used first
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type tokenBucket struct {
+	source  netip.Addr
+	tokens  float64
+	updated time.Time
+}
+
+func newTokenBuckets(rate float64, burst int, now func() time.Time) *tokenBuckets {
+	return &tokenBuckets{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[netip.Addr]*list.Element),
+		recent:    list.New(),
+		lastSweep: now(),
+		now:       now,
+	}
+}
+
+// take reports whether source may send a datagram now, using up a token if
+// so.
+func (b *tokenBuckets) take(source netip.Addr) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if now.Sub(b.lastSweep) >= tokenBucketSweepInterval {
+		b.sweep(now)
+	}
+
+	element, ok := b.buckets[source]
+	if ok {
+		b.recent.MoveToBack(element)
+	} else {
+		if len(b.buckets) >= maxTokenBuckets {
+			b.forget(b.recent.Front())
+		}
+		element = b.recent.PushBack(&tokenBucket{source: source, tokens: b.burst, updated: now})
+		b.buckets[source] = element
+	}
+
+	bucket := element.Value.(*tokenBucket)
+	bucket.tokens = min(b.burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*b.rate)
+	bucket.updated = now
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// sweep forgets the sources whose buckets have refilled, as they are no
+// different from sources never seen.
+func (b *tokenBuckets) sweep(now time.Time) {
+	for _, element := range b.buckets {
+		bucket := element.Value.(*tokenBucket)
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*b.rate >= b.burst {
+			b.forget(element)
+		}
+	}
+	b.lastSweep = now
+}
+
+func (b *tokenBuckets) forget(element *list.Element) {
+	delete(b.buckets, element.Value.(*tokenBucket).source)
+	b.recent.Remove(element)
+}
+
+// errAmplification is returned by WriteToUDP for replies that
+// LimitAmplification drops.
+var errAmplification = errors.New("reply dropped, it would exceed the amplification limit")
+
+// LimitAmplification drops replies once the bytes sent in response to a
+// datagram would exceed ratio times its size, so that the service can't be
+// used to multiply traffic sent with a spoofed source address.
+func LimitAmplification(ratio float64) UdpMiddleware {
+	return func(next UdpHandler) UdpHandler {
+		return func(conn UdpConn, buf []byte, n int, addr *net.UDPAddr) {
+			next(&amplificationConn{UdpConn: conn, budget: int(ratio * float64(n))}, buf, n, addr)
+		}
+	}
+}
+
+type amplificationConn struct {
+	UdpConn
+	budget int // Bytes that may still be sent
+}
+
+func (c *amplificationConn) WriteToUDP(b []byte, addr *net.UDPAddr) (int, error) {
+	if len(b) > c.budget {
+		slog.Debug("Refusing reply, it would exceed the amplification limit", "remote_addr", addr.String(), "bytes", len(b))
+		refusedByAmplification.Inc()
+		return 0, errAmplification
+	}
+	c.budget -= len(b)
+	return c.UdpConn.WriteToUDP(b, addr)
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// repliesConn records the replies sent through it.
+type repliesConn struct {
+	replies [][]byte
+}
+
+func (c *repliesConn) WriteToUDP(b []byte, addr *net.UDPAddr) (int, error) {
+	c.replies = append(c.replies, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func (c *repliesConn) LocalAddr() net.Addr { return &net.UDPAddr{} }
+
+// sendDatagram hands data from source to handle and returns the replies.
+func sendDatagram(handle UdpHandler, source string, data string) [][]byte {
+	conn := &repliesConn{}
+	addr := net.UDPAddrFromAddrPort(netip.MustParseAddrPort(source))
+	handle(conn, []byte(data), len(data), addr)
+	return conn.replies
+}
+
+func TestAllowUdpSources(t *testing.T) {
+	handle := ChainUdp(udpEcho, AllowUdpSources(netip.MustParsePrefix("10.0.0.0/8")))
+
+	tests := []struct {
+		source  string
+		allowed bool
+	}{
+		{"10.1.2.3:5000", true},
+		{"[::ffff:10.1.2.3]:5000", true},
+		{"192.168.1.1:5000", false},
+		{"[2001:db8::1]:5000", false},
+		{"127.0.0.1:5000", true},
+		{"[::1]:5000", true},
+	}
+	for _, tt := range tests {
+		replies := sendDatagram(handle, tt.source, "ping")
+		if allowed := len(replies) == 1; allowed != tt.allowed {
+			t.Errorf("Source %s: expected allowed %v, got %v", tt.source, tt.allowed, allowed)
+		}
+	}
+}
+
+func TestTokenBuckets(t *testing.T) {
+	now := time.Unix(0, 0)
+	buckets := newTokenBuckets(2, 3, func() time.Time { return now })
+	a := netip.MustParseAddr("10.0.0.1")
+	b := netip.MustParseAddr("10.0.0.2")
+
+	for i := range 3 {
+		if !buckets.take(a) {
+			t.Fatalf("Expected datagram %d of the burst to be allowed", i+1)
+		}
+	}
+	if buckets.take(a) {
+		t.Fatal("Expected the datagram after the burst to be refused")
+	}
+	if !buckets.take(b) {
+		t.Fatal("Expected another source to have its own bucket")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if !buckets.take(a) {
+		t.Fatal("Expected a token to have been refilled after half a second")
+	}
+	if buckets.take(a) {
+		t.Fatal("Expected only one token to have been refilled")
+	}
+
+	now = now.Add(tokenBucketSweepInterval)
+	buckets.take(b)
+	if _, ok := buckets.buckets[a]; ok {
+		t.Fatal("Expected the idle source to have been forgotten")
+	}
+}
+
+func TestTokenBucketsMakeRoomForNewSources(t *testing.T) {
+	now := time.Unix(0, 0)
+	buckets := newTokenBuckets(0.001, 1, func() time.Time { return now })
+	limited := netip.MustParseAddr("192.168.0.1")
+	buckets.take(limited)
+
+	// A flood from spoofed sources, none of which is idle long enough to be
+	// swept, fills the table
+	for i := range maxTokenBuckets {
+		spoofed := netip.AddrFrom4([4]byte{10, byte(i >> 16), byte(i >> 8), byte(i)})
+		if !buckets.take(spoofed) {
+			t.Fatalf("Expected spoofed source %d to be allowed its first datagram", i)
+		}
+	}
+
+	fresh := netip.MustParseAddr("172.16.0.1")
+	if !buckets.take(fresh) {
+		t.Fatal("Expected a new source to get through while the table is full")
+	}
+	if len(buckets.buckets) > maxTokenBuckets {
+		t.Fatalf("Expected at most %d tracked sources, got %d", maxTokenBuckets, len(buckets.buckets))
+	}
+	if _, ok := buckets.buckets[fresh]; !ok {
+		t.Fatal("Expected the new source to be tracked")
+	}
+	if _, ok := buckets.buckets[limited]; ok {
+		t.Fatal("Expected the source heard from least recently to have been forgotten")
+	}
+}
+
+func TestLimitAmplification(t *testing.T) {
+	handle := ChainUdp(func(conn UdpConn, buf []byte, n int, addr *net.UDPAddr) {
+		conn.WriteToUDP(make([]byte, 10), addr)
+		conn.WriteToUDP(make([]byte, 10), addr)
+		conn.WriteToUDP(make([]byte, 1), addr)
+	}, LimitAmplification(3))
+
+	// A 4-byte request allows 12 bytes of replies.
+	replies := sendDatagram(handle, "10.0.0.1:5000", "ping")
+	if len(replies) != 2 || len(replies[0]) != 10 || len(replies[1]) != 1 {
+		t.Fatalf("Expected the second reply to be dropped, got %d replies", len(replies))
+	}
+}
+
+func TestUdpGuardUnmarshalText(t *testing.T) {
+	var guard UdpGuard
+	if err := guard.UnmarshalText([]byte("allow=10.0.0.0/8|::1, rate=20,burst=40,amplification=2.5,log")); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if len(guard.Allow) != 2 || guard.Allow[0] != netip.MustParsePrefix("10.0.0.0/8") ||
+		guard.Allow[1] != netip.MustParsePrefix("::1/128") {
+		t.Fatalf("Unexpected allowlist %v", guard.Allow)
+	}
+	if guard.Rate != 20 || guard.Burst != 40 || guard.MaxAmplification != 2.5 || !guard.Log {
+		t.Fatalf("Unexpected guard %+v", guard)
+	}
+	if len(guard.Middleware()) != 4 {
+		t.Fatalf("Expected four middleware, got %d", len(guard.Middleware()))
+	}
+
+	for _, text := range []string{"rate=fast", "allow=10.0.0.0/33", "allow=", "ttl=5"} {
+		if err := guard.UnmarshalText([]byte(text)); err == nil {
+			t.Errorf("Expected an error for %q", text)
+		}
+	}
+
+	if err := guard.UnmarshalText(nil); err != nil || guard.Middleware() != nil {
+		t.Fatalf("Expected an empty guard to let everything through, got %+v (%v)", guard, err)
+	}
+}
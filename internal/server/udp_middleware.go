@@ -0,0 +1,33 @@
+package server
+
+import (
+	"log/slog"
+	"net"
+	"runtime/debug"
+)
+
+// UdpMiddleware wraps a UdpHandler, like Middleware does for connections.
+type UdpMiddleware func(UdpHandler) UdpHandler
+
+// ChainUdp wraps handle in the given middleware, outermost first.
+func ChainUdp(handle UdpHandler, middleware ...UdpMiddleware) UdpHandler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handle = middleware[i](handle)
+	}
+	return handle
+}
+
+// RecoverUdp stops a panicking handler from taking down the whole process.
+// The panic is logged with its stack trace and the datagram is dropped.
+func RecoverUdp() UdpMiddleware {
+	return func(next UdpHandler) UdpHandler {
+		return func(conn UdpConn, buf []byte, n int, addr *net.UDPAddr) {
+			defer func() {
+				if r := recover(); r != nil {
+					slog.Error("Recovered from panic in handler", "remote_addr", addr.String(), "panic", r, "stack", string(debug.Stack()))
+				}
+			}()
+			next(conn, buf, n, addr)
+		}
+	}
+}
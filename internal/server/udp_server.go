@@ -0,0 +1,275 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"log/slog"
+	"net"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// DefaultMaxDatagramSize is the largest datagram a UdpServer accepts unless
+// MaxDatagramSize is set. Protohackers requests are under 1000 bytes.
+const DefaultMaxDatagramSize = 999
+
+// udpQueueSize is how many datagrams may wait for each worker before the
+// read loop blocks and the kernel's socket buffer takes over.
+const udpQueueSize = 64
+
+// UdpConn is what a UdpHandler replies through. It is satisfied by
+// *net.UDPConn, and middleware may wrap it to observe or limit replies.
+type UdpConn interface {
+	WriteToUDP(b []byte, addr *net.UDPAddr) (int, error)
+	LocalAddr() net.Addr
+}
+
+// UdpHandler handles a single datagram of n bytes from addr. buf is only
+// valid until the handler returns, as it is reused for later datagrams.
+type UdpHandler func(conn UdpConn, buf []byte, n int, addr *net.UDPAddr)
+
+// UdpServer reads datagrams on Addr and hands them to a pool of workers
+// running Handler. Datagrams from the same source address always go to the
+// same worker, so each client's requests are still handled in order.
+//
+// A started UdpServer is stopped with Close, which also waits for the
+// datagrams already being handled.
+type UdpServer struct {
+	// Name identifies the service in metrics. It may be left empty.
+	Name    string
+	Addr    string
+	Handler UdpHandler
+
+	// Middleware wraps Handler, outermost first. RecoverUdp is always
+	// applied outside of it, so a panicking handler only drops its datagram.
+	Middleware []UdpMiddleware
+
+	// Workers is the number of datagrams handled concurrently. Zero means
+	// runtime.GOMAXPROCS(0).
+	Workers int
+
+	// MaxDatagramSize is the largest datagram passed to Handler. Larger ones
+	// are dropped. Zero means DefaultMaxDatagramSize.
+	MaxDatagramSize int
+
+	// Logger is used for the server's own messages. Nil means slog.Default().
+	Logger *slog.Logger
+
+	// SocketOptions tunes the server's socket. Only ReadBuffer, WriteBuffer
+	// and ReusePort apply to UDP.
+	SocketOptions SocketOptions
+
+	conn      *net.UDPConn
+	buffers   sync.Pool
+	metrics   *udpMetrics
+	running   sync.WaitGroup // Read loop and workers
+	readDone  chan struct{}  // Closed when the read loop exits
+	closeOnce sync.Once
+	closeErr  error
+}
+
+type datagram struct {
+	buf  *[]byte
+	n    int
+	addr *net.UDPAddr
+}
+
+func NewUdpServer(addr string, handle UdpHandler) *UdpServer {
+	return &UdpServer{
+		Addr:    addr,
+		Handler: handle,
+	}
+}
+
+// Listen binds the server's socket. It is called implicitly by Start. Like
+// Server.Listen, it adopts a socket-activated UDP socket if there is one.
+func (s *UdpServer) Listen() error {
+	if s.conn != nil {
+		return nil
+	}
+
+	if conn := activation().udpConn(s.Name); conn != nil {
+		s.conn = conn
+		registerSocket(s, s.Name, conn)
+		s.logger().Info("Server is listening on an inherited socket", "addr", conn.LocalAddr().String())
+		return nil
+	}
+
+	packetConn, err := s.SocketOptions.listenConfig().ListenPacket(context.Background(), s.SocketOptions.network("udp"), s.Addr)
+	if err != nil {
+		s.logger().Error("Error starting server", "addr", s.Addr, "err", err)
+		return err
+	}
+	conn := packetConn.(*net.UDPConn)
+	if err := s.SocketOptions.applyBuffers(conn); err != nil {
+		conn.Close()
+		s.logger().Error("Error setting socket options", "addr", s.Addr, "err", err)
+		return err
+	}
+	s.conn = conn
+	registerSocket(s, s.Name, conn)
+
+	s.logger().Info("Server is listening", "addr", conn.LocalAddr().String())
+	return nil
+}
+
+// Start binds the socket and handles datagrams in the background until the
+// server is closed.
+func (s *UdpServer) Start() error {
+	if err := s.Listen(); err != nil {
+		return err
+	}
+
+	size := s.maxDatagramSize() + 1 // One extra byte to detect oversized datagrams
+	s.buffers.New = func() any {
+		buf := make([]byte, size)
+		return &buf
+	}
+	s.metrics = newUdpMetrics(s.Name)
+
+	handle := ChainUdp(s.Handler, append([]UdpMiddleware{RecoverUdp()}, s.Middleware...)...)
+	queues := make([]chan datagram, s.workers())
+	for i := range queues {
+		queues[i] = make(chan datagram, udpQueueSize)
+		s.running.Go(func() { s.work(handle, queues[i]) })
+	}
+	s.readDone = make(chan struct{})
+	s.running.Go(func() {
+		s.readLoop(queues)
+		close(s.readDone)
+	})
+
+	return nil
+}
+
+// Serve handles datagrams until ctx is cancelled, then closes the server.
+func (s *UdpServer) Serve(ctx context.Context) error {
+	if err := s.Start(); err != nil {
+		return err
+	}
+
+	select {
+	case <-s.readDone:
+		s.Close()
+		return nil // Socket was closed by someone else
+	case <-ctx.Done():
+	}
+	return s.Close()
+}
+
+// Close closes the socket, which stops the read loop, and waits for the
+// workers to finish the datagrams they have already been given. Replies
+// written by those handlers after the socket has closed are lost.
+func (s *UdpServer) Close() error {
+	s.closeOnce.Do(func() {
+		unregisterSocket(s)
+		if s.conn != nil {
+			s.closeErr = s.conn.Close()
+		}
+		s.running.Wait()
+	})
+	return s.closeErr
+}
+
+// LocalAddr returns the address the server's socket is bound to.
+func (s *UdpServer) LocalAddr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+func (s *UdpServer) readLoop(queues []chan datagram) {
+	defer func() {
+		for _, queue := range queues {
+			close(queue) // Lets the workers exit once they are done
+		}
+	}()
+
+	var backoff time.Duration
+	for {
+		buf := s.buffers.Get().(*[]byte)
+		n, addr, err := s.conn.ReadFromUDP(*buf)
+
+		if err != nil {
+			s.buffers.Put(buf)
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// As with Accept, an error that persists would otherwise spin.
+			backoff = nextAcceptBackoff(backoff)
+			s.logger().Error("Error reading datagram", "err", err, "retry_in", backoff)
+			time.Sleep(backoff)
+			continue
+		}
+		backoff = 0
+
+		s.metrics.received.Inc()
+		s.metrics.bytesRead.Add(int64(n))
+
+		if n > s.maxDatagramSize() {
+			s.buffers.Put(buf)
+			s.metrics.dropped.Inc()
+			continue // Oversized datagrams are ignored
+		}
+
+		queues[workerFor(addr, len(queues))] <- datagram{buf, n, addr}
+	}
+}
+
+func (s *UdpServer) work(handle UdpHandler, queue <-chan datagram) {
+	for d := range queue {
+		handle(s.conn, *d.buf, d.n, d.addr)
+		s.buffers.Put(d.buf)
+	}
+}
+
+// workerFor picks the worker for a source address, so that datagrams from
+// one client are never handled concurrently or out of order.
+func workerFor(addr *net.UDPAddr, workers int) int {
+	if workers == 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write(addr.IP)
+	h.Write([]byte{byte(addr.Port >> 8), byte(addr.Port)})
+	return int(h.Sum32() % uint32(workers))
+}
+
+func (s *UdpServer) workers() int {
+	if s.Workers > 0 {
+		return s.Workers
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+func (s *UdpServer) maxDatagramSize() int {
+	if s.MaxDatagramSize > 0 {
+		return s.MaxDatagramSize
+	}
+	return DefaultMaxDatagramSize
+}
+
+func (s *UdpServer) logger() *slog.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return slog.Default()
+}
+
+type udpMetrics struct {
+	received  *Counter
+	dropped   *Counter
+	bytesRead *Counter
+}
+
+func newUdpMetrics(name string) *udpMetrics {
+	var labels []string
+	if name != "" {
+		labels = []string{"service", name}
+	}
+	return &udpMetrics{
+		received:  NewCounter("server_datagrams_received_total", "Datagrams received.", labels...),
+		dropped:   NewCounter("server_datagrams_dropped_total", "Datagrams dropped for exceeding the maximum size.", labels...),
+		bytesRead: NewCounter("server_bytes_read_total", "Bytes read from clients.", labels...),
+	}
+}
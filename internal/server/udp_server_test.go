@@ -0,0 +1,300 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// udpEcho replies to every datagram with its contents.
+func udpEcho(conn UdpConn, buf []byte, n int, addr *net.UDPAddr) {
+	conn.WriteToUDP(buf[:n], addr)
+}
+
+func dialUdp(t testing.TB, addr net.Addr) *net.UDPConn {
+	t.Helper()
+	conn, err := net.DialUDP("udp", nil, addr.(*net.UDPAddr))
+	if err != nil {
+		t.Fatal("Connecting to the server failed", err)
+	}
+	return conn
+}
+
+func TestUdpMaxDatagramSize(t *testing.T) {
+	s := NewUdpServer("127.0.0.1:0", udpEcho)
+	s.MaxDatagramSize = 10
+	if err := s.Start(); err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer s.Close()
+
+	conn := dialUdp(t, s.LocalAddr())
+	defer conn.Close()
+
+	conn.Write([]byte(strings.Repeat("x", 11))) // Dropped
+	conn.Write([]byte(strings.Repeat("y", 10))) // Echoed
+
+	buf := make([]byte, 100)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal("Expected a reply:", err)
+	}
+	if string(buf[:n]) != strings.Repeat("y", 10) {
+		t.Fatalf("Expected only the datagram within the size limit to be echoed, got %q", buf[:n])
+	}
+}
+
+func TestUdpSlowClientDoesNotBlockOthers(t *testing.T) {
+	release := make(chan struct{})
+	s := NewUdpServer("127.0.0.1:0", func(conn UdpConn, buf []byte, n int, addr *net.UDPAddr) {
+		if string(buf[:n]) == "slow" {
+			<-release
+		}
+		conn.WriteToUDP(buf[:n], addr)
+	})
+	s.Workers = 4
+	if err := s.Start(); err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer s.Close()
+	defer close(release)
+
+	slow := dialUdp(t, s.LocalAddr())
+	defer slow.Close()
+	slow.Write([]byte("slow"))
+
+	// Find a client that hashes to a different worker than the slow one
+	slowWorker := workerFor(slow.LocalAddr().(*net.UDPAddr), s.Workers)
+	var fast *net.UDPConn
+	for fast == nil {
+		conn := dialUdp(t, s.LocalAddr())
+		if workerFor(conn.LocalAddr().(*net.UDPAddr), s.Workers) != slowWorker {
+			fast = conn
+		} else {
+			defer conn.Close()
+		}
+	}
+	defer fast.Close()
+
+	fast.Write([]byte("fast"))
+	buf := make([]byte, 100)
+	fast.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := fast.Read(buf)
+	if err != nil || string(buf[:n]) != "fast" {
+		t.Fatalf("Expected a reply while another client is being handled, got %q (%v)", buf[:n], err)
+	}
+}
+
+func TestUdpPreservesOrderPerSource(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	done := make(chan struct{})
+	s := NewUdpServer("127.0.0.1:0", func(conn UdpConn, buf []byte, n int, addr *net.UDPAddr) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, string(buf[:n]))
+		if len(received) == 50 {
+			close(done)
+		}
+	})
+	s.Workers = 8
+	if err := s.Start(); err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer s.Close()
+
+	conn := dialUdp(t, s.LocalAddr())
+	defer conn.Close()
+	for i := range 50 {
+		conn.Write([]byte(fmt.Sprint(i)))
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Not all datagrams were handled")
+	}
+	for i, msg := range received {
+		if msg != fmt.Sprint(i) {
+			t.Fatalf("Expected datagram %d at position %d, got %s", i, i, msg)
+		}
+	}
+}
+
+// benchmarkUdpServer measures request-response throughput against a handler
+// that takes about 100µs per datagram, with many clients in parallel.
+func benchmarkUdpServer(b *testing.B, workers int) {
+	s := NewUdpServer("127.0.0.1:0", func(conn UdpConn, buf []byte, n int, addr *net.UDPAddr) {
+		time.Sleep(100 * time.Microsecond)
+		conn.WriteToUDP(buf[:n], addr)
+	})
+	s.Workers = workers
+	if err := s.Start(); err != nil {
+		b.Fatal("Error starting server:", err)
+	}
+	defer s.Close()
+
+	b.ReportAllocs()
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		conn := dialUdp(b, s.LocalAddr())
+		defer conn.Close()
+		request := []byte("key=value")
+		reply := make([]byte, 100)
+		for pb.Next() {
+			for {
+				conn.Write(request)
+				conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+				if _, err := conn.Read(reply); err == nil {
+					break
+				} // Lost under load, send again
+			}
+		}
+	})
+}
+
+func BenchmarkUdpServer_1Worker(b *testing.B)   { benchmarkUdpServer(b, 1) }
+func BenchmarkUdpServer_4Workers(b *testing.B)  { benchmarkUdpServer(b, 4) }
+func BenchmarkUdpServer_16Workers(b *testing.B) { benchmarkUdpServer(b, 16) }
+
+func TestUdpCloseWaitsForInFlightHandlers(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var finished atomic.Bool
+	s := NewUdpServer("127.0.0.1:0", func(conn UdpConn, buf []byte, n int, addr *net.UDPAddr) {
+		close(started)
+		<-release
+		finished.Store(true)
+	})
+	if err := s.Start(); err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+
+	conn := dialUdp(t, s.LocalAddr())
+	defer conn.Close()
+	conn.Write([]byte("work"))
+	<-started
+
+	closed := make(chan error, 1)
+	go func() { closed <- s.Close() }()
+
+	select {
+	case <-closed:
+		t.Fatal("Close returned while a handler was still running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-closed; err != nil {
+		t.Fatal("Unexpected error closing server:", err)
+	}
+	if !finished.Load() {
+		t.Fatal("Expected the in-flight handler to finish before Close returned")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal("Expected closing twice to be harmless, got:", err)
+	}
+}
+
+func TestUdpServeStopsWhenContextIsCancelled(t *testing.T) {
+	s := NewUdpServer("127.0.0.1:0", udpEcho)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(ctx) }()
+
+	cancel()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatal("Expected clean shutdown, got:", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Serve did not return after the context was cancelled")
+	}
+}
+
+func TestUdpServeReturnsWhenSocketIsClosed(t *testing.T) {
+	s := NewUdpServer("127.0.0.1:0", udpEcho)
+	if err := s.Listen(); err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(t.Context()) }()
+
+	s.conn.Close()
+	select {
+	case <-served:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Serve did not return after its socket was closed")
+	}
+}
+
+// countingHandler counts the records logged through it.
+type countingHandler struct {
+	records atomic.Int64
+}
+
+func (h *countingHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *countingHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *countingHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *countingHandler) Handle(context.Context, slog.Record) error {
+	h.records.Add(1)
+	return nil
+}
+
+func TestUdpReadErrorsBackOff(t *testing.T) {
+	logs := &countingHandler{}
+	s := NewUdpServer("127.0.0.1:0", udpEcho)
+	s.Logger = slog.New(logs)
+	if err := s.Start(); err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+
+	// A deadline in the past fails every read, without closing the socket
+	logged := logs.records.Load() // Those from starting
+	s.conn.SetReadDeadline(time.Unix(1, 0))
+	time.Sleep(100 * time.Millisecond)
+	s.Close()
+
+	// 5ms, 10ms, 20ms, 40ms... fit at most a handful of retries in 100ms
+	if errors := logs.records.Load() - logged; errors > 10 {
+		t.Fatalf("Expected read errors to back off, got %d in 100ms", errors)
+	}
+}
+
+func TestUdpRecoversFromPanic(t *testing.T) {
+	s := NewUdpServer("127.0.0.1:0", func(conn UdpConn, buf []byte, n int, addr *net.UDPAddr) {
+		if string(buf[:n]) == "panic" {
+			panic("handler exploded")
+		}
+		udpEcho(conn, buf, n, addr)
+	})
+	s.Workers = 1
+	if err := s.Start(); err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer s.Close()
+
+	conn := dialUdp(t, s.LocalAddr())
+	defer conn.Close()
+	conn.Write([]byte("panic"))
+	conn.Write([]byte("hello"))
+
+	buf := make([]byte, 16)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "hello" {
+		t.Fatalf("Expected the worker to survive the panic, got %q (%v)", buf[:n], err)
+	}
+}
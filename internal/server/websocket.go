@@ -0,0 +1,463 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// websocketGUID is appended to the client's key to compute the handshake
+// response (RFC 6455, section 1.3).
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// WebSocket close status codes.
+const (
+	closeNormal        = 1000
+	closeGoingAway     = 1001
+	closeProtocolError = 1002
+)
+
+// closeFrameTimeout bounds how long sending a close frame may take.
+const closeFrameTimeout = time.Second
+
+// ServeWebSocket serves the server's handler to WebSocket clients of an HTTP
+// endpoint on addr until ctx is cancelled, so that browsers can use the
+// service. Each session is handed to the handler as a net.Conn: the payload
+// of the client's messages is read as one stream of bytes, and every Write
+// is sent as one message, as text if it is valid UTF-8 and binary otherwise.
+//
+// The endpoint serves TLS if the server does, and accepts handshakes from
+// pages of WebSocketOrigins only. It returns an error right away if addr
+// can't be bound, and whenever the endpoint stops other than through ctx.
+//
+// The sessions go through the same middleware with the same timeouts as the
+// server's TCP connections, but are counted towards connection limits and
+// drained separately. Configure the server fully before calling this; only
+// changes made through SetLimits reach the sessions later.
+func (s *Server) ServeWebSocket(ctx context.Context, addr string) error {
+	httpListener, err := net.Listen("tcp", addr)
+	if err != nil {
+		s.logger().Error("Error starting WebSocket endpoint", "addr", addr, "err", err)
+		return err
+	}
+	if s.TLSConfig != nil {
+		httpListener = tls.NewListener(httpListener, s.TLSConfig)
+	}
+
+	listener := NewWebSocketListener()
+	listener.CheckOrigin = s.WebSocketOrigins.Allow
+	websocket := &Server{
+		Name:            s.Name + "_websocket",
+		Handler:         s.Handler,
+		Listener:        listener,
+		Middleware:      s.Middleware,
+		Logger:          s.Logger,
+		ShutdownTimeout: s.ShutdownTimeout,
+		DrainTimeout:    s.DrainTimeout,
+		RejectMessage:   s.RejectMessage,
+		parent:          s, // For its limits, including those set later
+	}
+
+	// If the endpoint stops, so do the sessions, rather than waiting for
+	// ones that will never come.
+	endpointErr := make(chan error, 1)
+	go func() {
+		err := serveEndpoint(ctx, "websocket", httpListener, listener)
+		listener.Close()
+		endpointErr <- err
+	}()
+	err = websocket.Serve(ctx)
+	return errors.Join(err, <-endpointErr)
+}
+
+// WebSocketOrigins are the origins of the pages that may open WebSocket
+// sessions, such as "https://example.com", where "*" allows any page. Empty
+// allows only pages from the host the endpoint was reached on. Clients that
+// send no Origin header aren't browsers and are always allowed.
+type WebSocketOrigins []string
+
+// UnmarshalText parses a comma-separated list of origins.
+func (o *WebSocketOrigins) UnmarshalText(text []byte) error {
+	var parsed WebSocketOrigins
+	for origin := range strings.SplitSeq(string(text), ",") {
+		origin = strings.TrimSpace(origin)
+		if origin == "" {
+			continue
+		}
+		if origin != "*" {
+			u, err := url.Parse(origin)
+			if err != nil || u.Scheme == "" || u.Host == "" || strings.TrimSuffix(u.Path, "/") != "" {
+				return fmt.Errorf("invalid origin %q, expected scheme://host[:port] or *", origin)
+			}
+			origin = u.Scheme + "://" + u.Host
+		}
+		parsed = append(parsed, origin)
+	}
+	*o = parsed
+	return nil
+}
+
+func (o WebSocketOrigins) String() string {
+	return strings.Join(o, ",")
+}
+
+// Allow reports whether r comes from one of the origins, for CheckOrigin.
+func (o WebSocketOrigins) Allow(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if len(o) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+	for _, allowed := range o {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// WebSocketListener is a net.Listener whose connections are the WebSocket
+// sessions that its ServeHTTP upgrades, for use as a Server's Listener.
+type WebSocketListener struct {
+	// CheckOrigin, if set, refuses handshakes for which it returns false,
+	// such as those from pages on other sites. Nil accepts every origin, so
+	// a listener that browsers reach should set it, as ServeWebSocket does.
+	CheckOrigin func(r *http.Request) bool
+
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewWebSocketListener() *WebSocketListener {
+	return &WebSocketListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+func (l *WebSocketListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops accepting sessions. Later handshakes are refused, but sessions
+// already accepted are left alone.
+func (l *WebSocketListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *WebSocketListener) Addr() net.Addr { return websocketAddr("websocket") }
+
+type websocketAddr string
+
+func (a websocketAddr) Network() string { return "websocket" }
+func (a websocketAddr) String() string  { return string(a) }
+
+// ServeHTTP performs the WebSocket handshake and hands the session to
+// Accept.
+func (l *WebSocketListener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-l.done:
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	default:
+	}
+
+	if r.Method != http.MethodGet ||
+		!headerContainsToken(r.Header, "Connection", "upgrade") ||
+		!headerContainsToken(r.Header, "Upgrade", "websocket") {
+		w.Header().Set("Upgrade", "websocket")
+		http.Error(w, "Expected a WebSocket handshake", http.StatusUpgradeRequired)
+		return
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "Invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return
+	}
+	if l.CheckOrigin != nil && !l.CheckOrigin(r) {
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "WebSocket upgrade not supported", http.StatusInternalServerError)
+		return
+	}
+	// Hijacking leaves any deadlines set by the HTTP server in place.
+	conn.SetDeadline(time.Time{})
+
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", websocketAccept(key))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return
+	}
+
+	ws := &websocketConn{Conn: conn, r: rw.Reader}
+	select {
+	case l.conns <- ws:
+	case <-l.done:
+		ws.closeWith(closeGoingAway)
+		conn.Close()
+	}
+}
+
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerContainsToken reports whether the comma-separated header contains
+// token, ignoring case.
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for t := range strings.SplitSeq(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// errWebSocketProtocol is returned by reads once the client has broken the
+// framing rules, after the session has been closed with a protocol error.
+var errWebSocketProtocol = errors.New("websocket protocol error")
+
+// websocketConn is the server end of a WebSocket session.
+type websocketConn struct {
+	net.Conn
+	r *bufio.Reader
+
+	// State of the data frame being read. Read is not safe to call
+	// concurrently, like deadlineConn's.
+	remaining uint64
+	mask      [4]byte
+	maskPos   int
+	inMessage bool // A fragmented message has more frames to come
+	readErr   error
+
+	writeMu   sync.Mutex
+	closeSent bool
+}
+
+func (c *websocketConn) Read(b []byte) (int, error) {
+	for c.remaining == 0 {
+		if c.readErr != nil {
+			return 0, c.readErr
+		}
+		if err := c.nextDataFrame(); err != nil {
+			c.readErr = err
+			return 0, err
+		}
+	}
+
+	if uint64(len(b)) > c.remaining {
+		b = b[:c.remaining]
+	}
+	n, err := c.r.Read(b)
+	for i := range n {
+		b[i] ^= c.mask[c.maskPos]
+		c.maskPos = (c.maskPos + 1) % 4
+	}
+	c.remaining -= uint64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF // The client vanished mid-frame
+	}
+	return n, err
+}
+
+// nextDataFrame reads frame headers, answering any control frames along the
+// way, until one starts a data frame with a payload. It returns io.EOF once
+// the client has closed the session.
+func (c *websocketConn) nextDataFrame() error {
+	for {
+		fin, opcode, length, err := c.readFrameHeader()
+		if err != nil {
+			return err
+		}
+
+		switch opcode {
+		case opText, opBinary, opContinuation:
+			if (opcode == opContinuation) != c.inMessage {
+				return c.protocolError()
+			}
+			c.inMessage = !fin
+			if length > 0 {
+				c.remaining = length
+				return nil
+			}
+
+		case opClose, opPing, opPong:
+			if !fin || length > 125 {
+				return c.protocolError()
+			}
+			payload := make([]byte, length)
+			if _, err := io.ReadFull(c.r, payload); err != nil {
+				return err
+			}
+			for i := range payload {
+				payload[i] ^= c.mask[i%4]
+			}
+			switch opcode {
+			case opClose:
+				code := uint16(closeNormal)
+				if len(payload) >= 2 {
+					code = binary.BigEndian.Uint16(payload)
+				}
+				c.closeWith(code)
+				return io.EOF
+			case opPing:
+				c.writeFrame(opPong, payload)
+			}
+
+		default:
+			return c.protocolError()
+		}
+	}
+}
+
+func (c *websocketConn) readFrameHeader() (fin bool, opcode byte, length uint64, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(c.r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	if header[0]&0x70 != 0 || header[1]&0x80 == 0 {
+		// Extensions aren't negotiated and clients must mask every frame.
+		return false, 0, 0, c.protocolError()
+	}
+
+	length = uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+		if length>>63 != 0 {
+			return false, 0, 0, c.protocolError()
+		}
+	}
+
+	if _, err = io.ReadFull(c.r, c.mask[:]); err != nil {
+		return
+	}
+	c.maskPos = 0
+	return fin, opcode, length, nil
+}
+
+func (c *websocketConn) protocolError() error {
+	c.closeWith(closeProtocolError)
+	return errWebSocketProtocol
+}
+
+// Write sends b as a single message.
+func (c *websocketConn) Write(b []byte) (int, error) {
+	opcode := byte(opText)
+	if !utf8.Valid(b) {
+		opcode = opBinary
+	}
+	if err := c.writeFrame(opcode, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return net.ErrClosed
+	}
+	if opcode == opClose {
+		c.closeSent = true
+	}
+
+	frame := make([]byte, 0, 10+len(payload))
+	frame = append(frame, 0x80|opcode) // Always a final frame
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	frame = append(frame, payload...)
+	_, err := c.Conn.Write(frame)
+	return err
+}
+
+// closeWith sends a close frame with the given status code, unless one has
+// been sent already. The TCP connection is closed by Close.
+//
+// A client that has stopped reading must not hold up the close, so the
+// write deadline is shortened first. That also makes a Write stuck on the
+// same client give up the frame lock.
+func (c *websocketConn) closeWith(code uint16) {
+	c.Conn.SetWriteDeadline(time.Now().Add(closeFrameTimeout))
+	c.writeFrame(opClose, binary.BigEndian.AppendUint16(nil, code))
+}
+
+// Close ends the session with a normal closure and closes the connection.
+func (c *websocketConn) Close() error {
+	c.closeWith(closeNormal)
+	return c.Conn.Close()
+}
+
+func (c *websocketConn) Unwrap() net.Conn { return c.Conn }
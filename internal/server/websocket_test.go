@@ -0,0 +1,358 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// websocketClient speaks just enough of the client side of RFC 6455 for the
+// tests.
+type websocketClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialWebSocket(t *testing.T, addr string) *websocketClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	return handshakeWebSocket(t, conn, addr, "")
+}
+
+// handshakeWebSocket opens a session on conn, sending the given extra header
+// lines along with the handshake.
+func handshakeWebSocket(t *testing.T, conn net.Conn, addr, headers string) *websocketClient {
+	t.Helper()
+	resp, r := requestWebSocket(t, conn, addr, headers)
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected 101 Switching Protocols, got %s", resp.Status)
+	}
+	// The example from RFC 6455, section 1.3.
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Unexpected Sec-WebSocket-Accept %q", accept)
+	}
+	return &websocketClient{conn: conn, r: r}
+}
+
+// requestWebSocket sends a handshake on conn and returns the response.
+func requestWebSocket(t *testing.T, conn net.Conn, addr, headers string) (*http.Response, *bufio.Reader) {
+	t.Helper()
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	const key = "dGhlIHNhbXBsZSBub25jZQ=="
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n%s\r\n", addr, key, headers)
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal("Error reading handshake response:", err)
+	}
+	return resp, r
+}
+
+func (c *websocketClient) send(fin bool, opcode byte, payload []byte) {
+	mask := [4]byte{0x12, 0x34, 0x56, 0x78}
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	if len(payload) < 126 {
+		frame = append(frame, 0x80|byte(len(payload)))
+	} else {
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	c.conn.Write(frame)
+}
+
+func (c *websocketClient) receive(t *testing.T) (opcode byte, payload []byte) {
+	t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		t.Fatal("Error reading frame:", err)
+	}
+	if header[1]&0x80 != 0 {
+		t.Fatal("Server frames must not be masked")
+	}
+	length := int(header[1] & 0x7f)
+	if length == 126 {
+		var ext [2]byte
+		io.ReadFull(c.r, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		t.Fatal("Error reading frame payload:", err)
+	}
+	return header[0] & 0x0f, payload
+}
+
+// startWebSocketServer serves handle to WebSocket clients and returns the
+// address to dial.
+func startWebSocketServer(t *testing.T, handle Handler) string {
+	t.Helper()
+	listener := NewWebSocketListener()
+	srv := NewServer("", handle)
+	srv.Listener = listener
+	if _, err := srv.Start(); err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	httpServer := httptest.NewServer(listener)
+	t.Cleanup(httpServer.Close)
+	return strings.TrimPrefix(httpServer.URL, "http://")
+}
+
+func lineEcho(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		conn.Write([]byte(strings.ToUpper(scanner.Text()) + "\n"))
+	}
+}
+
+func TestWebSocketSession(t *testing.T) {
+	client := dialWebSocket(t, startWebSocketServer(t, lineEcho))
+
+	// A line split across a fragmented message and the next message, with a
+	// ping in between.
+	client.send(false, opText, []byte("hel"))
+	client.send(false, opContinuation, []byte("lo "))
+	client.send(true, opPing, []byte("are you there?"))
+	client.send(true, opContinuation, []byte("wor"))
+	client.send(true, opText, []byte("ld\n"))
+
+	if opcode, payload := client.receive(t); opcode != opPong || string(payload) != "are you there?" {
+		t.Fatalf("Expected pong with the ping's payload, got opcode %#x %q", opcode, payload)
+	}
+	if opcode, payload := client.receive(t); opcode != opText || string(payload) != "HELLO WORLD\n" {
+		t.Fatalf("Expected text message %q, got opcode %#x %q", "HELLO WORLD\n", opcode, payload)
+	}
+
+	client.send(true, opClose, binary.BigEndian.AppendUint16(nil, closeNormal))
+	if opcode, payload := client.receive(t); opcode != opClose || binary.BigEndian.Uint16(payload) != closeNormal {
+		t.Fatalf("Expected normal closure, got opcode %#x %v", opcode, payload)
+	}
+	if _, err := client.r.ReadByte(); err != io.EOF {
+		t.Fatal("Expected the server to close the connection, got:", err)
+	}
+}
+
+func TestWebSocketWritesBinaryMessages(t *testing.T) {
+	addr := startWebSocketServer(t, func(conn net.Conn) {
+		defer conn.Close()
+		conn.Write([]byte{0xff, 0x00})
+		conn.Write([]byte("text"))
+	})
+	client := dialWebSocket(t, addr)
+
+	if opcode, payload := client.receive(t); opcode != opBinary || string(payload) != "\xff\x00" {
+		t.Fatalf("Expected binary message, got opcode %#x %q", opcode, payload)
+	}
+	if opcode, payload := client.receive(t); opcode != opText || string(payload) != "text" {
+		t.Fatalf("Expected text message, got opcode %#x %q", opcode, payload)
+	}
+}
+
+func TestWebSocketRejectsUnmaskedFrames(t *testing.T) {
+	client := dialWebSocket(t, startWebSocketServer(t, lineEcho))
+
+	client.conn.Write([]byte{0x80 | opText, 6, 'h', 'e', 'l', 'l', 'o', '\n'})
+	if opcode, payload := client.receive(t); opcode != opClose || binary.BigEndian.Uint16(payload) != closeProtocolError {
+		t.Fatalf("Expected a protocol error closure, got opcode %#x %v", opcode, payload)
+	}
+}
+
+// A client that stops reading leaves the handler stuck in a write. Shutdown
+// must still close its session, without waiting for it to read again.
+func TestShutdownClosesWebSocketThatStoppedReading(t *testing.T) {
+	listener := NewWebSocketListener()
+	s := NewServer("", func(conn net.Conn) {
+		defer conn.Close()
+		message := make([]byte, 64*1024)
+		for {
+			if _, err := conn.Write(message); err != nil {
+				return
+			}
+		}
+	})
+	s.Listener = listener
+	if _, err := s.Start(); err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+	httpServer := httptest.NewServer(listener)
+	defer httpServer.Close()
+
+	dialWebSocket(t, strings.TrimPrefix(httpServer.URL, "http://"))
+	waitForConns(t, s, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- s.Shutdown(ctx)
+	}()
+
+	select {
+	case err := <-shutdown:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatal("Expected deadline exceeded, got:", err)
+		}
+	case <-time.After(closeFrameTimeout + 2*time.Second):
+		t.Fatal("Shutdown did not return")
+	}
+}
+
+func TestWebSocketRejectsPlainHTTP(t *testing.T) {
+	addr := startWebSocketServer(t, lineEcho)
+
+	resp, err := http.Get("http://" + addr)
+	if err != nil {
+		t.Fatal("Error requesting page:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired {
+		t.Fatalf("Expected 426 Upgrade Required, got %s", resp.Status)
+	}
+}
+
+// freeAddr returns a loopback address that nothing was listening on a
+// moment ago.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error finding a free port:", err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func TestServeWebSocketFailsIfAddrIsTaken(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening:", err)
+	}
+	defer taken.Close()
+
+	srv := NewServer(":0", lineEcho)
+	served := make(chan error, 1)
+	go func() { served <- srv.ServeWebSocket(t.Context(), taken.Addr().String()) }()
+	select {
+	case err := <-served:
+		if err == nil {
+			t.Fatal("Expected an error for an address in use")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ServeWebSocket kept running without its endpoint")
+	}
+}
+
+func TestServeWebSocketOverTLS(t *testing.T) {
+	serverConfig, clientConfig, err := SelfSignedTLSConfig()
+	if err != nil {
+		t.Fatal("Error generating certificate:", err)
+	}
+	srv := NewServer(":0", lineEcho)
+	srv.TLSConfig = serverConfig
+	addr := freeAddr(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- srv.ServeWebSocket(ctx, addr) }()
+	defer cancel()
+
+	var conn *tls.Conn
+	for deadline := time.Now().Add(2 * time.Second); conn == nil; time.Sleep(10 * time.Millisecond) {
+		if conn, err = tls.Dial("tcp", addr, clientConfig); err != nil && time.Now().After(deadline) {
+			t.Fatal("Error connecting over TLS:", err)
+		}
+	}
+	client := handshakeWebSocket(t, conn, addr, "")
+	client.send(true, opText, []byte("hello\n"))
+	if opcode, payload := client.receive(t); opcode != opText || string(payload) != "HELLO\n" {
+		t.Fatalf("Expected the echo over TLS, got opcode %#x %q", opcode, payload)
+	}
+
+	conn.Close()
+	cancel()
+	if err := <-served; err != nil {
+		t.Fatal("Expected a clean shutdown, got:", err)
+	}
+}
+
+func TestWebSocketOrigins(t *testing.T) {
+	tests := []struct {
+		origins string
+		host    string
+		origin  string
+		allowed bool
+	}{
+		{"", "chat.example.com", "", true},
+		{"", "chat.example.com", "https://chat.example.com", true},
+		{"", "chat.example.com", "https://evil.example", false},
+		{"https://example.com", "chat.example.com", "https://example.com", true},
+		{"https://example.com", "chat.example.com", "http://example.com", false},
+		{"https://example.com", "chat.example.com", "https://chat.example.com", false},
+		{"*", "chat.example.com", "https://evil.example", true},
+	}
+	for _, tt := range tests {
+		var origins WebSocketOrigins
+		if err := origins.UnmarshalText([]byte(tt.origins)); err != nil {
+			t.Fatalf("Error parsing %q: %v", tt.origins, err)
+		}
+		r := httptest.NewRequest(http.MethodGet, "http://"+tt.host+"/", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if allowed := origins.Allow(r); allowed != tt.allowed {
+			t.Errorf("Origins %q, origin %q on %s: expected allowed %v, got %v", tt.origins, tt.origin, tt.host, tt.allowed, allowed)
+		}
+	}
+
+	var origins WebSocketOrigins
+	if err := origins.UnmarshalText([]byte("example.com")); err == nil {
+		t.Fatal("Expected an error for an origin without a scheme")
+	}
+}
+
+func TestServeWebSocketRefusesOtherOrigins(t *testing.T) {
+	srv := NewServer(":0", lineEcho)
+	addr := freeAddr(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.ServeWebSocket(ctx, addr)
+
+	var conn net.Conn
+	var err error
+	for deadline := time.Now().Add(2 * time.Second); conn == nil; time.Sleep(10 * time.Millisecond) {
+		if conn, err = net.Dial("tcp", addr); err != nil && time.Now().After(deadline) {
+			t.Fatal("Error connecting to server:", err)
+		}
+	}
+	resp, _ := requestWebSocket(t, conn, addr, "Origin: https://evil.example\r\n")
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected 403 Forbidden for a page on another site, got %s", resp.Status)
+	}
+}
@@ -0,0 +1,27 @@
+package smoketest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+)
+
+// healthcheckPayload is what CheckHealth expects to be echoed back.
+var healthcheckPayload = []byte("healthcheck\x00\xff")
+
+// CheckHealth checks that the service on the other end of conn echoes what
+// it is sent.
+func CheckHealth(conn net.Conn) error {
+	if _, err := conn.Write(healthcheckPayload); err != nil {
+		return err
+	}
+	echo := make([]byte, len(healthcheckPayload))
+	if _, err := io.ReadFull(conn, echo); err != nil {
+		return fmt.Errorf("reading echo: %w", err)
+	}
+	if !bytes.Equal(echo, healthcheckPayload) {
+		return fmt.Errorf("sent %q, got %q back", healthcheckPayload, echo)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+// Package smoketest implements Protohackers problem 0, Smoke Test: an echo
+// service.
+package smoketest
+
+import (
+	"TDMR87/go_protohackers/internal/server"
+	"io"
+	"net"
+	"time"
+)
+
+// NewServer returns a server for the service on addr, configured the way it
+// is deployed.
+func NewServer(addr string) *server.Server {
+	srv := server.NewServer(addr, handle)
+	srv.Name = "smoketest"
+	srv.Middleware = []server.Middleware{server.AccessLog()}
+	srv.HandshakeTimeout = 10 * time.Second
+	srv.IdleTimeout = time.Minute
+	srv.WriteTimeout = 10 * time.Second
+	return srv
+}
+
+func handle(conn net.Conn) {
+	defer conn.Close()
+	logger := server.Logger(conn)
+
+	buf := make([]byte, 1024)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			if err == io.EOF {
+				logger.Debug("Connection closed by client")
+				return
+			} else {
+				logger.Warn("Read error", "err", err)
+				return
+			}
+		}
+
+		_, err = conn.Write(buf[:n])
+		if err != nil {
+			logger.Warn("Write error", "err", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package smoketest
+
+import (
+	"TDMR87/go_protohackers/internal/server"
+	"bufio"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+
+	var testCases = map[string]struct {
+		request  string
+		response string
+	}{
+		"echo 1": {
+			request:  "Hello, World!",
+			response: "Hello, World!",
+		},
+		"echo 2": {
+			request:  "Some test 123",
+			response: "Some test 123",
+		},
+	}
+
+	transports, err := server.Transports()
+	if err != nil {
+		t.Fatal("Error generating certificate:", err)
+	}
+
+	for transportName, transport := range transports {
+		t.Run(transportName, func(t *testing.T) {
+			listener, err := server.StartTLSListener(":0", handle, transport.Server)
+			if err != nil {
+				t.Fatal("Error starting server:", err)
+			}
+
+			defer listener.Close()
+
+			for _, tt := range testCases {
+				conn, err := server.Dial(listener.Addr().String(), transport.Client)
+				if err != nil {
+					t.Fatal("Error connecting to server:", err)
+				}
+
+				defer conn.Close()
+
+				_, err = conn.Write([]byte(tt.request + "\n"))
+				if err != nil {
+					t.Fatal("Error writing to server:", err)
+				}
+
+				scanner := bufio.NewScanner(conn)
+				if scanner.Scan() {
+					if scanner.Text() != tt.response {
+						t.Errorf("Expected response %q, got %q", tt.response, scanner.Text())
+					}
+				} else if err := scanner.Err(); err != nil {
+					t.Fatal("Error reading response from server:", err)
+				} else {
+					t.Fatal("No response from server")
+				}
+			}
+		})
+	}
+}
+
+func TestCheckHealth(t *testing.T) {
+	listener, err := server.StartPipeListener(handle)
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, _ := listener.Dial()
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if err := CheckHealth(conn); err != nil {
+		t.Fatal("Expected the service to be healthy:", err)
+	}
+}
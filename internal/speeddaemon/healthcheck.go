@@ -0,0 +1,41 @@
+package speeddaemon
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// healthcheckGrace is how long CheckHealth waits for the first heartbeat on
+// top of the minimum heartbeat interval.
+const healthcheckGrace = 5 * time.Second
+
+// CheckHealth asks the daemon on the other end of conn for heartbeats and
+// checks that the first one arrives. The daemon won't send it any sooner
+// than its minimum heartbeat interval, which is taken to be the one applied
+// in this process, so CheckHealth extends conn's deadline to wait for it.
+func CheckHealth(conn net.Conn) error {
+	if _, err := conn.Write(WantHeartBeat{Interval: 1}.Encode()); err != nil {
+		return err
+	}
+	if interval := settings.Load().MinHeartbeatInterval; interval > 0 {
+		conn.SetReadDeadline(time.Now().Add(interval + healthcheckGrace))
+	}
+	msgType := make([]byte, 1)
+	if _, err := io.ReadFull(conn, msgType); err != nil {
+		return fmt.Errorf("reading heartbeat: %w", err)
+	}
+	switch msgType[0] {
+	case HeartBeat{}.Type():
+		return nil
+	case Error{}.Type():
+		// Errors are sent right before the connection is closed, so the rest
+		// of the message is all that's left to read.
+		rest, _ := io.ReadAll(conn)
+		if msg, err := (Error{}).Decode(append(msgType, rest...)); err == nil {
+			return fmt.Errorf("daemon replied with an error: %s", msg.Msg)
+		}
+	}
+	return fmt.Errorf("expected a heartbeat, got message type %#x", msgType[0])
+}
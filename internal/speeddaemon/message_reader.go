@@ -1,4 +1,4 @@
-package main
+package speeddaemon
 
 import (
 	"fmt"
@@ -37,7 +37,8 @@ func (reader *MessageReader) NextMessage() (msg any, err error) {
 		switch msgType {
 		case Plate{}.Type():
 			if len(reader.buf) < 2 {
-				return nil, fmt.Errorf("A message of type Plate must have more than 1 byte")
+				needMoreBytes = true // The length byte hasn't arrived yet
+				break
 			}
 			strSize := int(reader.buf[1])
 			msgSizeInBytes := 2 + strSize + 4 // Type(1 byte) + Length(1 byte) + Plate length (bytes) + Timestamp(4 bytes)
@@ -48,7 +49,8 @@ func (reader *MessageReader) NextMessage() (msg any, err error) {
 			msg, needMoreBytes, err = extractMessage(reader, IAmCamera{}.Size(), IAmCamera{}.Decode)
 		case IAmDispatcher{}.Type():
 			if len(reader.buf) < 2 {
-				return nil, fmt.Errorf("A message of type IAmDispatcher must have more than 1 byte")
+				needMoreBytes = true // The length byte hasn't arrived yet
+				break
 			}
 			numRoads := int(reader.buf[1])
 			msgSizeInBytes := 2 + (numRoads * 2) // Type(1 byte) + NumRoads(1 byte) + Roads (2 bytes each)
@@ -100,9 +102,9 @@ func extractMessage[T any](
 func (f *MessageReader) fillBuffer() error {
 	tempBuf := make([]byte, 512)
 	n, err := f.reader.Read(tempBuf)
-	if err != nil {
-		return err
-	}
 	f.buf = append(f.buf, tempBuf[:n]...)
-	return nil
+	if n > 0 {
+		return nil // Any error comes back from the next read
+	}
+	return err
 }
@@ -1,8 +1,10 @@
-package main
+package speeddaemon
 
 import (
 	"bytes"
+	"reflect"
 	"testing"
+	"testing/iotest"
 )
 
 func TestMessageReader_WantHeartBeat(t *testing.T) {
@@ -50,3 +52,30 @@ func TestMessageReader_WantHeartBeat(t *testing.T) {
 		}
 	}
 }
+
+func TestMessageReader_OneByteAtATime(t *testing.T) {
+	plate, _ := Plate{Plate: "UN1X", Timestamp: 45}.Encode()
+	var stream []byte
+	stream = append(stream, IAmCamera{Road: 66, Mile: 8, Limit: 60}.Encode()...)
+	stream = append(stream, plate...)
+	stream = append(stream, IAmDispatcher{Numroads: 2, Roads: []uint16{66, 67}}.Encode()...)
+	stream = append(stream, WantHeartBeat{Interval: 10}.Encode()...)
+
+	expected := []any{
+		IAmCamera{Road: 66, Mile: 8, Limit: 60},
+		Plate{Plate: "UN1X", Timestamp: 45},
+		IAmDispatcher{Numroads: 2, Roads: []uint16{66, 67}},
+		WantHeartBeat{Interval: 10},
+	}
+
+	reader := NewMessageReader(iotest.OneByteReader(bytes.NewReader(stream)))
+	for _, want := range expected {
+		msg, err := reader.NextMessage()
+		if err != nil {
+			t.Fatalf("unexpected error reading %T: %v", want, err)
+		}
+		if !reflect.DeepEqual(msg, want) {
+			t.Fatalf("expected %+v, got %+v", want, msg)
+		}
+	}
+}
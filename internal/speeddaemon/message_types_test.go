@@ -1,4 +1,4 @@
-package main
+package speeddaemon
 
 import (
 	"encoding/binary"
@@ -0,0 +1,45 @@
+package speeddaemon
+
+import (
+	"TDMR87/go_protohackers/internal/server"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// Settings are the policies of every daemon in the process, which can be
+// changed while they run.
+type Settings struct {
+	// Tolerance is how many mph over the limit a car may average before it
+	// is ticketed.
+	Tolerance float64
+
+	// MinHeartbeatInterval is the shortest heartbeat interval a client can
+	// ask for; shorter ones are raised to it. Zero honours any interval.
+	MinHeartbeatInterval time.Duration
+}
+
+var settings atomic.Pointer[Settings]
+
+func init() {
+	settings.Store(&Settings{})
+}
+
+// AddFlags registers the flags that set s, starting from the defaults.
+func (s *Settings) AddFlags(f *server.Flags) {
+	f.Float(&s.Tolerance, "speed-tolerance", 0, "`mph` over the limit a car may average before it is ticketed")
+	f.Duration(&s.MinHeartbeatInterval, "min-heartbeat-interval", 0, "shortest heartbeat interval clients may ask for")
+	f.Live("speed-tolerance", "min-heartbeat-interval")
+	f.Check(func() error {
+		if s.Tolerance < 0 || s.MinHeartbeatInterval < 0 {
+			return errors.New("speed tolerance and heartbeat interval can't be negative")
+		}
+		return nil
+	})
+}
+
+// Apply makes s the policies of every daemon, for plates and heartbeat
+// requests received from then on.
+func (s Settings) Apply() {
+	settings.Store(&s)
+}
@@ -0,0 +1,321 @@
+// Package speeddaemon implements Protohackers problem 6, Speed Daemon: a
+// binary protocol through which cameras report plates and dispatchers
+// receive speeding tickets.
+//
+// The observations and tickets live in memory, so a process that hands its
+// socket to a new one (see server.Handoff) doesn't take them along. While
+// both processes serve, each sees only the cameras connected to it, and
+// tickets that would pair observations from one with the other are missed.
+package speeddaemon
+
+import (
+	"TDMR87/go_protohackers/internal/server"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	platesTotal  = server.NewCounter("speed_daemon_plates_total", "Plate observations received from cameras.")
+	ticketsTotal = server.NewCounter("speed_daemon_tickets_sent_total", "Tickets delivered to dispatchers.")
+)
+
+// Daemon holds the cameras, dispatchers and tickets shared by the clients of
+// one speed daemon.
+type Daemon struct {
+	mu                   sync.Mutex
+	heartbeatClients     map[net.Conn]struct{}
+	dispatchers          map[net.Conn]IAmDispatcher
+	cameraClients        map[net.Conn]IAmCamera
+	cameraPlateSnapshots map[Plate]IAmCamera
+	sentTickets          map[string][]uint32
+	outgoingTickets      []Ticket
+}
+
+func NewDaemon() *Daemon {
+	return &Daemon{
+		heartbeatClients:     make(map[net.Conn]struct{}),
+		dispatchers:          make(map[net.Conn]IAmDispatcher),
+		cameraClients:        make(map[net.Conn]IAmCamera),
+		cameraPlateSnapshots: make(map[Plate]IAmCamera),
+		sentTickets:          make(map[string][]uint32),
+	}
+}
+
+// NewServer returns a server for the service on addr, with a daemon of its
+// own, configured the way it is deployed.
+func NewServer(addr string) *server.Server {
+	s := NewDaemon()
+	s.registerMetrics()
+	srv := server.NewServer(addr, s.handle)
+	srv.Name = "speed_daemon"
+	srv.Middleware = []server.Middleware{server.AccessLog()}
+	srv.MaxConnsPerIP = 512
+	srv.RejectMessage, _ = Error{Msg: "Too many connections"}.Encode()
+	srv.HandshakeTimeout = 30 * time.Second
+	// The idle timeout reaps clients that never say what they are or stop
+	// halfway through a message. Cameras, dispatchers and heartbeat clients
+	// may legitimately stay quiet for as long as they like, so handle lifts
+	// it once a client is one of those.
+	srv.IdleTimeout = 10 * time.Minute
+	srv.WriteTimeout = 10 * time.Second
+	return srv
+}
+
+// registerMetrics exposes the size of the daemon's client and ticket sets.
+func (s *Daemon) registerMetrics() {
+	gauge := func(name, help string, size func() int) {
+		server.NewGaugeFunc(name, help, func() float64 {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return float64(size())
+		})
+	}
+	gauge("speed_daemon_cameras", "Connected cameras.", func() int { return len(s.cameraClients) })
+	gauge("speed_daemon_dispatchers", "Connected dispatchers.", func() int { return len(s.dispatchers) })
+	gauge("speed_daemon_pending_tickets", "Tickets waiting for a dispatcher for their road.", func() int { return len(s.outgoingTickets) })
+}
+
+func (s *Daemon) handle(conn net.Conn) {
+	defer conn.Close()
+	defer func() {
+		s.mu.Lock()
+		delete(s.heartbeatClients, conn)
+		delete(s.cameraClients, conn)
+		delete(s.dispatchers, conn)
+		s.mu.Unlock()
+	}()
+
+	reader := NewMessageReader(conn)
+
+	for {
+		var deliveries []ticketDelivery
+		message, err := reader.NextMessage()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				server.Logger(conn).Debug("Client disconnected")
+			} else {
+				server.Logger(conn).Warn("Error reading message", "err", err)
+			}
+			response, _ := Error{Msg: err.Error()}.Encode()
+			conn.Write(response)
+			return
+		}
+
+		s.mu.Lock()
+
+		switch msg := message.(type) {
+		case WantHeartBeat:
+			_, exists := s.heartbeatClients[conn]
+			if exists {
+				s.mu.Unlock()
+				sendError(conn, "Client is already receiving heartbeats")
+				return
+			}
+			s.heartbeatClients[conn] = struct{}{}
+			server.DisableIdleTimeout(conn)
+			if msg.Interval > 0 {
+				go s.sendHeartBeat(conn, msg.Interval)
+			}
+
+		case IAmCamera:
+			_, exists := s.cameraClients[conn]
+			if exists {
+				s.mu.Unlock()
+				sendError(conn, "Client is already identified as a camera")
+				return
+			}
+			s.cameraClients[conn] = msg
+			server.DisableIdleTimeout(conn)
+			server.SetConnLabel(conn, fmt.Sprintf("camera road=%d mile=%d", msg.Road, msg.Mile))
+
+		case Plate:
+			camera, exists := s.cameraClients[conn]
+			if !exists {
+				s.mu.Unlock()
+				sendError(conn, "Client must be identified as a camera to send a plate")
+				continue
+			}
+			platesTotal.Inc()
+			s.cameraPlateSnapshots[msg] = camera
+			s.handlePlate(msg, camera)
+			deliveries = s.takeTickets()
+
+		case IAmDispatcher:
+			_, exists := s.dispatchers[conn]
+			if exists {
+				s.mu.Unlock()
+				sendError(conn, "Client is already identified as a dispatcher")
+				return
+			}
+			s.dispatchers[conn] = msg
+			server.DisableIdleTimeout(conn)
+			server.SetConnLabel(conn, fmt.Sprintf("dispatcher roads=%v", msg.Roads))
+			deliveries = s.takeTickets()
+
+		default:
+			s.mu.Unlock()
+			sendError(conn, "Unknown message received from MessageReader")
+			continue
+		}
+
+		s.mu.Unlock()
+		s.sendTickets(deliveries)
+	}
+}
+
+// sendHeartBeat sends heartbeats to conn until a write fails. The client
+// stays registered in heartbeatClients until it disconnects, as it has asked
+// for heartbeats and may not ask again.
+func (s *Daemon) sendHeartBeat(conn net.Conn, deciSeconds uint32) {
+	interval := max(time.Duration(deciSeconds*100)*time.Millisecond, settings.Load().MinHeartbeatInterval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		_, err := conn.Write(HeartBeat{}.Encode())
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *Daemon) handlePlate(currentPlate Plate, currentCamera IAmCamera) {
+	tolerance := settings.Load().Tolerance
+
+outerloop:
+	for previousCameraPlate, previousCamera := range s.cameraPlateSnapshots {
+		if previousCamera == currentCamera ||
+			previousCameraPlate.Plate != currentPlate.Plate ||
+			previousCamera.Road != currentCamera.Road {
+			continue
+		}
+
+		currentDay := currentPlate.Timestamp / 86400
+		previousDay := previousCameraPlate.Timestamp / 86400
+
+		if _, exists := s.sentTickets[currentPlate.Plate]; exists {
+			for _, day := range s.sentTickets[currentPlate.Plate] {
+				if day >= previousDay && day <= currentDay {
+					continue outerloop
+				}
+			}
+		}
+
+		var distanceDiff uint16
+		var timeDiff uint32
+		if currentCamera.Mile > previousCamera.Mile {
+			distanceDiff = currentCamera.Mile - previousCamera.Mile
+			timeDiff = currentPlate.Timestamp - previousCameraPlate.Timestamp
+		} else {
+			distanceDiff = previousCamera.Mile - currentCamera.Mile
+			timeDiff = previousCameraPlate.Timestamp - currentPlate.Timestamp
+		}
+
+		if timeDiff == 0 {
+			continue
+		}
+
+		speedInMph := (float64(distanceDiff) / float64(timeDiff)) * 3600.0
+		if speedInMph < float64(currentCamera.Limit)+tolerance {
+			continue
+		}
+
+		for day := previousDay; day <= currentDay; day++ {
+			s.sentTickets[currentPlate.Plate] = append(s.sentTickets[currentPlate.Plate], day)
+		}
+
+		if currentCamera.Mile > previousCamera.Mile {
+			s.outgoingTickets = append(s.outgoingTickets, Ticket{
+				Plate:      currentPlate.Plate,
+				Road:       currentCamera.Road,
+				Mile1:      previousCamera.Mile,
+				Timestamp1: previousCameraPlate.Timestamp,
+				Mile2:      currentCamera.Mile,
+				Timestamp2: currentPlate.Timestamp,
+				Speed:      uint16(speedInMph) * 100,
+			})
+		} else {
+			s.outgoingTickets = append(s.outgoingTickets, Ticket{
+				Plate:      currentPlate.Plate,
+				Road:       currentCamera.Road,
+				Mile1:      currentCamera.Mile,
+				Timestamp1: currentPlate.Timestamp,
+				Mile2:      previousCamera.Mile,
+				Timestamp2: previousCameraPlate.Timestamp,
+				Speed:      uint16(speedInMph) * 100,
+			})
+		}
+
+		break
+	}
+}
+
+// ticketDelivery is a ticket taken off outgoingTickets for a dispatcher of
+// its road.
+type ticketDelivery struct {
+	conn   net.Conn
+	ticket Ticket
+}
+
+// takeTickets takes the outgoing tickets for which a dispatcher is connected
+// off outgoingTickets. The caller must hold s.mu, and pass the deliveries to
+// sendTickets once it has released it.
+func (s *Daemon) takeTickets() []ticketDelivery {
+	var deliveries []ticketDelivery
+	var pending []Ticket
+	for _, ticket := range s.outgoingTickets {
+		if conn := s.dispatcherFor(ticket.Road); conn != nil {
+			deliveries = append(deliveries, ticketDelivery{conn, ticket})
+		} else {
+			pending = append(pending, ticket)
+		}
+	}
+	s.outgoingTickets = pending
+	return deliveries
+}
+
+// dispatcherFor returns the connection of a dispatcher for road, or nil if
+// there is none.
+func (s *Daemon) dispatcherFor(road uint16) net.Conn {
+	for conn, dispatcher := range s.dispatchers {
+		if slices.Contains(dispatcher.Roads, road) {
+			return conn
+		}
+	}
+	return nil
+}
+
+// sendTickets writes the tickets to their dispatchers without holding s.mu,
+// so that a dispatcher that is slow to read holds up no other client. A
+// ticket that can't be written goes back to outgoingTickets, for the next
+// dispatcher of its road.
+func (s *Daemon) sendTickets(deliveries []ticketDelivery) {
+	for _, d := range deliveries {
+		ticketBytes, err := d.ticket.Encode()
+		if err != nil {
+			sendError(d.conn, "Failed to encode ticket")
+			continue
+		}
+		if _, err := d.conn.Write(ticketBytes); err != nil {
+			server.Logger(d.conn).Warn("Error sending ticket", "plate", d.ticket.Plate, "err", err)
+			s.mu.Lock()
+			s.outgoingTickets = append(s.outgoingTickets, d.ticket)
+			s.mu.Unlock()
+			continue
+		}
+		server.Logger(d.conn).Info("Sent ticket", "plate", d.ticket.Plate, "road", d.ticket.Road, "speed", d.ticket.Speed)
+		ticketsTotal.Inc()
+	}
+}
+
+// sendError logs a protocol error and reports it to the client.
+func sendError(conn net.Conn, msg string) {
+	server.Logger(conn).Warn("Protocol error", "err", msg)
+	response, _ := Error{Msg: msg}.Encode()
+	conn.Write(response)
+}
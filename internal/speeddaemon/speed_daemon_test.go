@@ -1,27 +1,30 @@
-package main
+package speeddaemon
 
 import (
 	"TDMR87/go_protohackers/internal/server"
+	"context"
 	"fmt"
+	"io"
 	"net"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
 )
 
 func Test_WantHeartBeat_OnlyOnePerClientAllowed(t *testing.T) {
-	s := NewServer()
-	listener, err := server.StartTcpListener(":0", s.handle)
+	s := NewDaemon()
+	listener, err := server.StartPipeListener(s.handle)
 	if err != nil {
 		t.Fatal("Error starting server:", err)
 	}
 	defer listener.Close()
 
-	conn, _ := net.Dial("tcp", listener.Addr().String())
+	conn, _ := listener.Dial()
 	defer conn.Close()
 
 	conn.Write(WantHeartBeat{Interval: 9999}.Encode())
-	time.Sleep(100 * time.Millisecond)
+	processed(t, conn)
 	conn.Write(WantHeartBeat{Interval: 9999}.Encode())
 
 	buf := make([]byte, Error{}.Size())
@@ -38,14 +41,14 @@ func Test_WantHeartBeat_OnlyOnePerClientAllowed(t *testing.T) {
 }
 
 func Test_WantHeartBeat_SendsHeartBeats(t *testing.T) {
-	s := NewServer()
-	listener, err := server.StartTcpListener(":0", s.handle)
+	s := NewDaemon()
+	listener, err := server.StartPipeListener(s.handle)
 	if err != nil {
 		t.Fatal("Error starting server:", err)
 	}
 	defer listener.Close()
 
-	conn, _ := net.Dial("tcp", listener.Addr().String())
+	conn, _ := listener.Dial()
 	defer conn.Close()
 
 	// Request heartbeats every 100ms (1 decisecond)
@@ -80,21 +83,21 @@ func Test_WantHeartBeat_SendsHeartBeats(t *testing.T) {
 }
 
 func Test_WantHeartBeat_ZeroIntervalNoHeartBeats(t *testing.T) {
-	s := NewServer()
-	listener, err := server.StartTcpListener(":0", s.handle)
+	s := NewDaemon()
+	listener, err := server.StartPipeListener(s.handle)
 	if err != nil {
 		t.Fatal("Error starting server:", err)
 	}
 	defer listener.Close()
 
-	conn, _ := net.Dial("tcp", listener.Addr().String())
+	conn, _ := listener.Dial()
 	defer conn.Close()
 
 	// Request heartbeats with interval 0 (should not send heartbeats)
 	conn.Write(WantHeartBeat{Interval: 0}.Encode())
 
-	// Wait a bit for the server to process
-	time.Sleep(100 * time.Millisecond)
+	// Wait for the server to process it
+	processed(t, conn)
 
 	// Try to read with a short deadline - should timeout because no heartbeats sent
 	buf := make([]byte, HeartBeat{}.Size())
@@ -106,15 +109,91 @@ func Test_WantHeartBeat_ZeroIntervalNoHeartBeats(t *testing.T) {
 	}
 }
 
+// A client that asked for no heartbeats has still asked, and may not ask
+// again. Nor may a client that asks twice in a row, before any heartbeat.
+func Test_WantHeartBeat_SecondRefusedAfterZeroInterval(t *testing.T) {
+	s := NewDaemon()
+	listener, err := server.StartPipeListener(s.handle)
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, _ := listener.Dial()
+	defer conn.Close()
+
+	conn.Write(append(WantHeartBeat{Interval: 0}.Encode(), WantHeartBeat{Interval: 0}.Encode()...))
+
+	buf := make([]byte, Error{}.Size())
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal("Expected an error for the second WantHeartbeat, got:", err)
+	}
+	response, err := Error{}.Decode(buf[:n])
+	if err != nil {
+		t.Fatal("Error decoding response:", err)
+	}
+	if response.Msg != "Client is already receiving heartbeats" {
+		t.Fatalf("expected error message 'Client is already receiving heartbeats', got '%s'", response.Msg)
+	}
+}
+
+// Cameras, dispatchers and heartbeat clients may stay quiet for longer than
+// the idle timeout once they have said what they are.
+func Test_IdentifiedClientsAreNotTimedOutAsIdle(t *testing.T) {
+	heartbeat := WantHeartBeat{Interval: 1}.Encode()
+	for name, tt := range map[string]struct {
+		hello, probe []byte
+		reply        byte
+	}{
+		"camera":           {IAmCamera{Road: 1, Mile: 8, Limit: 60}.Encode(), heartbeat, HeartBeat{}.Type()},
+		"dispatcher":       {IAmDispatcher{Numroads: 1, Roads: []uint16{1}}.Encode(), heartbeat, HeartBeat{}.Type()},
+		"heartbeat client": {WantHeartBeat{Interval: 0}.Encode(), heartbeat, Error{}.Type()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			listener := server.NewPipeListener()
+			srv := server.NewServer("", NewDaemon().handle)
+			srv.Listener = listener
+			srv.IdleTimeout = 50 * time.Millisecond
+			if _, err := srv.Start(); err != nil {
+				t.Fatal("Error starting server:", err)
+			}
+			defer srv.Shutdown(context.Background())
+
+			conn, _ := listener.Dial()
+			defer conn.Close()
+			conn.Write(tt.hello)
+			time.Sleep(200 * time.Millisecond) // Well past the idle timeout
+
+			conn.Write(tt.probe)
+			buf := make([]byte, Error{}.Size())
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			n, err := conn.Read(buf)
+			if err != nil {
+				t.Fatal("Expected a reply to the probe, got:", err)
+			}
+			if buf[0] != tt.reply {
+				t.Fatalf("Expected a reply of type %#x, got %q", tt.reply, buf[:n])
+			}
+			if tt.reply == (Error{}).Type() {
+				if msg, _ := (Error{}).Decode(buf[:n]); msg.Msg != "Client is already receiving heartbeats" {
+					t.Fatalf("Expected the second WantHeartbeat to be refused, got %q", msg.Msg)
+				}
+			}
+		})
+	}
+}
+
 func Test_IAmCamera_RegistersSuccessfully(t *testing.T) {
-	s := NewServer()
-	listener, err := server.StartTcpListener(":0", s.handle)
+	s := NewDaemon()
+	listener, err := server.StartPipeListener(s.handle)
 	if err != nil {
 		t.Fatal("Error starting server:", err)
 	}
 	defer listener.Close()
 
-	conn, _ := net.Dial("tcp", listener.Addr().String())
+	conn, _ := listener.Dial()
 	defer conn.Close()
 
 	// Send IAmCamera message
@@ -125,7 +204,7 @@ func Test_IAmCamera_RegistersSuccessfully(t *testing.T) {
 		t.Fatalf("Expected no error for valid IAmCamera, but got one: %v", err)
 	}
 
-	time.Sleep(100 * time.Millisecond)
+	processed(t, conn)
 
 	// Check that the camera was registered
 	cameraRegistered := false
@@ -144,20 +223,20 @@ func Test_IAmCamera_RegistersSuccessfully(t *testing.T) {
 }
 
 func Test_IAmCamera_OnlyOnePerClientAllowed(t *testing.T) {
-	s := NewServer()
-	listener, err := server.StartTcpListener(":0", s.handle)
+	s := NewDaemon()
+	listener, err := server.StartPipeListener(s.handle)
 	if err != nil {
 		t.Fatal("Error starting server:", err)
 	}
 	defer listener.Close()
 
-	conn, _ := net.Dial("tcp", listener.Addr().String())
+	conn, _ := listener.Dial()
 	defer conn.Close()
 
 	// Send first IAmCamera message
 	firstMsg := IAmCamera{Road: 123, Mile: 8, Limit: 60}
 	conn.Write(firstMsg.Encode())
-	time.Sleep(100 * time.Millisecond)
+	processed(t, conn)
 
 	// Send second IAmCamera message
 	secondMsg := IAmCamera{Road: 456, Mile: 10, Limit: 70}
@@ -172,14 +251,14 @@ func Test_IAmCamera_OnlyOnePerClientAllowed(t *testing.T) {
 }
 
 func Test_ClientMustBeACamera_ToSendPlate(t *testing.T) {
-	s := NewServer()
-	listener, err := server.StartTcpListener(":0", s.handle)
+	s := NewDaemon()
+	listener, err := server.StartPipeListener(s.handle)
 	if err != nil {
 		t.Fatal("Error starting server:", err)
 	}
 	defer listener.Close()
 
-	conn, _ := net.Dial("tcp", listener.Addr().String())
+	conn, _ := listener.Dial()
 	defer conn.Close()
 
 	plate, err := Plate{Plate: "ABCD1234", Timestamp: 123456}.Encode()
@@ -189,7 +268,7 @@ func Test_ClientMustBeACamera_ToSendPlate(t *testing.T) {
 
 	// Send Plate message without identifying as a camera
 	conn.Write(plate)
-	time.Sleep(100 * time.Millisecond)
+	processed(t, conn)
 
 	buf := make([]byte, Error{}.Size())
 	n, _ := conn.Read(buf)
@@ -200,69 +279,224 @@ func Test_ClientMustBeACamera_ToSendPlate(t *testing.T) {
 }
 
 func Test_SendTicket(t *testing.T) {
-	s := NewServer()
-	listener, err := server.StartTcpListener(":0", s.handle)
+	s := NewDaemon()
+	listener, err := server.StartPipeListener(s.handle)
 	if err != nil {
 		t.Fatal("Error starting server:", err)
 	}
 	defer listener.Close()
 
 	// First camera connects and sends a plate
-	cameraOneConn, _ := net.Dial("tcp", listener.Addr().String())
+	cameraOneConn, _ := listener.Dial()
 	defer cameraOneConn.Close()
 	cameraOne := IAmCamera{Road: 123, Mile: 8, Limit: 60}
 	cameraOneConn.Write(cameraOne.Encode())
-	time.Sleep(100 * time.Millisecond)
+	processed(t, cameraOneConn)
 	plate, _ := Plate{Plate: "ABCD1234", Timestamp: 0}.Encode()
 	cameraOneConn.Write(plate)
-	time.Sleep(100 * time.Millisecond)
+	processed(t, cameraOneConn)
 
 	// Second camera connects and sends a plate
-	cameraTwoConn, _ := net.Dial("tcp", listener.Addr().String())
+	cameraTwoConn, _ := listener.Dial()
 	defer cameraTwoConn.Close()
 	cameraTwo := IAmCamera{Road: 123, Mile: 9, Limit: 60}
 	cameraTwoConn.Write(cameraTwo.Encode())
-	time.Sleep(100 * time.Millisecond)
+	processed(t, cameraTwoConn)
 	plate, _ = Plate{Plate: "ABCD1234", Timestamp: 45}.Encode()
 	cameraTwoConn.Write(plate)
-	time.Sleep(100 * time.Millisecond)
+	processed(t, cameraTwoConn)
 
 	if len(s.outgoingTickets) != 1 {
 		t.Fatal("Expected speeding ticket to be outgoing, but it was not")
 	}
 
 	// Now a dispatcher connects to receive the ticket
-	dispatcherConn, _ := net.Dial("tcp", listener.Addr().String())
+	dispatcherConn, _ := listener.Dial()
 	defer dispatcherConn.Close()
 	dispatcher := IAmDispatcher{Numroads: 1, Roads: []uint16{123}}
 	dispatcherConn.Write(dispatcher.Encode())
-	time.Sleep(100 * time.Millisecond)
+	processed(t, dispatcherConn)
 
 	if len(s.outgoingTickets) != 0 {
 		t.Fatal("Expected outgoing ticket to have been sent, but it was not sent")
 	}
 }
 
+func Test_SendTicket_OverTCP(t *testing.T) {
+	transports, err := server.Transports()
+	if err != nil {
+		t.Fatal("Error generating certificate:", err)
+	}
+
+	for name, transport := range transports {
+		t.Run(name, func(t *testing.T) {
+			listener, err := server.StartTLSListener("127.0.0.1:0", NewDaemon().handle, transport.Server)
+			if err != nil {
+				t.Fatal("Error starting server:", err)
+			}
+			defer listener.Close()
+
+			dial := func() net.Conn {
+				conn, err := server.Dial(listener.Addr().String(), transport.Client)
+				if err != nil {
+					t.Fatal("Error connecting to server:", err)
+				}
+				return conn
+			}
+
+			dispatcherConn := dial()
+			defer dispatcherConn.Close()
+			dispatcherConn.Write(IAmDispatcher{Numroads: 1, Roads: []uint16{123}}.Encode())
+
+			for _, observation := range []struct {
+				mile      uint16
+				timestamp uint32
+			}{{8, 0}, {9, 45}} {
+				cameraConn := dial()
+				defer cameraConn.Close()
+				cameraConn.Write(IAmCamera{Road: 123, Mile: observation.mile, Limit: 60}.Encode())
+				plate, _ := Plate{Plate: "ABCD1234", Timestamp: observation.timestamp}.Encode()
+				cameraConn.Write(plate)
+			}
+
+			// Type, plate length and plate, then the ticket's fixed-size fields
+			buf := make([]byte, 2+len("ABCD1234")+2+2+4+2+4+2)
+			dispatcherConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			if _, err := io.ReadFull(dispatcherConn, buf); err != nil {
+				t.Fatal("Expected to receive a ticket:", err)
+			}
+			ticket, err := Ticket{}.Decode(buf)
+			if err != nil {
+				t.Fatal("Error decoding ticket:", err)
+			}
+			if ticket.Plate != "ABCD1234" || ticket.Road != 123 {
+				t.Fatalf("Expected a ticket for ABCD1234 on road 123, got %+v", ticket)
+			}
+		})
+	}
+}
+
+// stalledTicketConn blocks writing tickets until release is closed, like a
+// dispatcher that has stopped reading, and reports each one on stalled.
+type stalledTicketConn struct {
+	net.Conn
+	stalled chan<- struct{}
+	release <-chan struct{}
+}
+
+func (c stalledTicketConn) Write(b []byte) (int, error) {
+	if len(b) > 0 && b[0] == (Ticket{}).Type() {
+		c.stalled <- struct{}{}
+		<-c.release
+	}
+	return c.Conn.Write(b)
+}
+
+func (c stalledTicketConn) Unwrap() net.Conn { return c.Conn }
+
+func Test_StalledDispatcher_DoesNotHoldUpOtherClients(t *testing.T) {
+	stalled := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+	stall := func(next server.Handler) server.Handler {
+		return func(conn net.Conn) { next(stalledTicketConn{conn, stalled, release}) }
+	}
+
+	s := NewDaemon()
+	listener, err := server.StartPipeListener(s.handle, stall)
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	dispatcherConn, _ := listener.Dial()
+	defer dispatcherConn.Close()
+	dispatcherConn.Write(IAmDispatcher{Numroads: 1, Roads: []uint16{123}}.Encode())
+	processed(t, dispatcherConn)
+
+	// Two cameras see a car speeding, and the ticket's write stalls
+	for _, observation := range []struct {
+		mile      uint16
+		timestamp uint32
+	}{{8, 0}, {9, 45}} {
+		cameraConn, _ := listener.Dial()
+		defer cameraConn.Close()
+		cameraConn.Write(IAmCamera{Road: 123, Mile: observation.mile, Limit: 60}.Encode())
+		plate, _ := Plate{Plate: "ABCD1234", Timestamp: observation.timestamp}.Encode()
+		cameraConn.Write(plate)
+	}
+	select {
+	case <-stalled:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a ticket to be sent")
+	}
+
+	// Another client is still answered
+	conn, _ := listener.Dial()
+	defer conn.Close()
+	conn.Write(append(IAmCamera{Road: 1, Mile: 1, Limit: 60}.Encode(), IAmCamera{Road: 1, Mile: 1, Limit: 60}.Encode()...))
+
+	buf := make([]byte, Error{}.Size())
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal("Expected an error for the second IAmCamera, got:", err)
+	}
+	if response, _ := (Error{}).Decode(buf[:n]); response.Msg != "Client is already identified as a camera" {
+		t.Fatalf("expected error message 'Client is already identified as a camera', got '%s'", response.Msg)
+	}
+}
+
+func Test_SpeedTolerance_SparesCarsJustOverTheLimit(t *testing.T) {
+	Settings{Tolerance: 25}.Apply()
+	t.Cleanup(Settings{}.Apply)
+
+	s := NewDaemon()
+	listener, err := server.StartPipeListener(s.handle)
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	// 80 mph on a 60 mph road, within the tolerance
+	for _, observation := range []struct {
+		mile      uint16
+		timestamp uint32
+	}{{8, 0}, {9, 45}} {
+		cameraConn, _ := listener.Dial()
+		defer cameraConn.Close()
+		cameraConn.Write(IAmCamera{Road: 123, Mile: observation.mile, Limit: 60}.Encode())
+		processed(t, cameraConn)
+		plate, _ := Plate{Plate: "ABCD1234", Timestamp: observation.timestamp}.Encode()
+		cameraConn.Write(plate)
+		processed(t, cameraConn)
+	}
+
+	if len(s.outgoingTickets) != 0 {
+		t.Fatalf("Expected no ticket within the tolerance, got %+v", s.outgoingTickets)
+	}
+}
+
 func Test_IAmDispatcher_OnlyOnePerClientAllowed(t *testing.T) {
-	s := NewServer()
-	listener, err := server.StartTcpListener(":0", s.handle)
+	s := NewDaemon()
+	listener, err := server.StartPipeListener(s.handle)
 	if err != nil {
 		t.Fatal("Error starting server:", err)
 	}
 	defer listener.Close()
 
-	conn, _ := net.Dial("tcp", listener.Addr().String())
+	conn, _ := listener.Dial()
 	defer conn.Close()
 
 	// Send first IAmDispatcher message
 	firstMsg := IAmDispatcher{Numroads: 2, Roads: []uint16{123, 456}}
 	conn.Write(firstMsg.Encode())
-	time.Sleep(100 * time.Millisecond)
+	processed(t, conn)
 
 	// Send second IAmDispatcher message
 	secondMsg := IAmDispatcher{Numroads: 1, Roads: []uint16{456}}
 	conn.Write(secondMsg.Encode())
-	time.Sleep(100 * time.Millisecond)
+	processed(t, conn)
 
 	buf := make([]byte, Error{}.Size())
 	n, _ := conn.Read(buf)
@@ -273,76 +507,76 @@ func Test_IAmDispatcher_OnlyOnePerClientAllowed(t *testing.T) {
 }
 
 func Test_CompleteScenario_MultipleCamerasDispatchersAndPlates(t *testing.T) {
-	s := NewServer()
-	listener, err := server.StartTcpListener(":0", s.handle)
+	s := NewDaemon()
+	listener, err := server.StartPipeListener(s.handle)
 	if err != nil {
 		t.Fatal("Error starting server:", err)
 	}
 	defer listener.Close()
 
 	// Camera 1 on Road 66, Mile 100, Limit 60 mph
-	camera1Conn, _ := net.Dial("tcp", listener.Addr().String())
+	camera1Conn, _ := listener.Dial()
 	defer camera1Conn.Close()
 	camera1 := IAmCamera{Road: 66, Mile: 100, Limit: 60}
 	camera1Conn.Write(camera1.Encode())
-	time.Sleep(50 * time.Millisecond)
+	processed(t, camera1Conn)
 
 	// Camera 2 on Road 66, Mile 110, Limit 60 mph
-	camera2Conn, _ := net.Dial("tcp", listener.Addr().String())
+	camera2Conn, _ := listener.Dial()
 	defer camera2Conn.Close()
 	camera2 := IAmCamera{Road: 66, Mile: 110, Limit: 60}
 	camera2Conn.Write(camera2.Encode())
-	time.Sleep(50 * time.Millisecond)
+	processed(t, camera2Conn)
 
 	// Camera 3 on Road 123, Mile 50, Limit 70 mph
-	camera3Conn, _ := net.Dial("tcp", listener.Addr().String())
+	camera3Conn, _ := listener.Dial()
 	defer camera3Conn.Close()
 	camera3 := IAmCamera{Road: 123, Mile: 50, Limit: 70}
 	camera3Conn.Write(camera3.Encode())
-	time.Sleep(50 * time.Millisecond)
+	processed(t, camera3Conn)
 
 	// Camera 4 on Road 123, Mile 60, Limit 70 mph
-	camera4Conn, _ := net.Dial("tcp", listener.Addr().String())
+	camera4Conn, _ := listener.Dial()
 	defer camera4Conn.Close()
 	camera4 := IAmCamera{Road: 123, Mile: 60, Limit: 70}
 	camera4Conn.Write(camera4.Encode())
-	time.Sleep(50 * time.Millisecond)
+	processed(t, camera4Conn)
 
 	// Car "SPEEDY1" on Road 66 - speeding (100 miles in 1 hour = 100 mph, limit is 60)
 	plate1, _ := Plate{Plate: "SPEEDY1", Timestamp: 0}.Encode()
 	camera1Conn.Write(plate1)
-	time.Sleep(50 * time.Millisecond)
+	processed(t, camera1Conn)
 
 	plate2, _ := Plate{Plate: "SPEEDY1", Timestamp: 360}.Encode() // 1 hour later, 10 miles ahead
 	camera2Conn.Write(plate2)
-	time.Sleep(50 * time.Millisecond)
+	processed(t, camera2Conn)
 
 	// Car "LEGAL1" on Road 66 - not speeding (10 miles in 2 hours = 5 mph)
 	plate3, _ := Plate{Plate: "LEGAL1", Timestamp: 0}.Encode()
 	camera1Conn.Write(plate3)
-	time.Sleep(50 * time.Millisecond)
+	processed(t, camera1Conn)
 
 	plate4, _ := Plate{Plate: "LEGAL1", Timestamp: 7200}.Encode() // 2 hours later
 	camera2Conn.Write(plate4)
-	time.Sleep(50 * time.Millisecond)
+	processed(t, camera2Conn)
 
 	// Car "SPEEDY2" on Road 123 - speeding (10 miles in 0.1 hour = 100 mph, limit is 70)
 	plate5, _ := Plate{Plate: "SPEEDY2", Timestamp: 0}.Encode()
 	camera3Conn.Write(plate5)
-	time.Sleep(50 * time.Millisecond)
+	processed(t, camera3Conn)
 
 	plate6, _ := Plate{Plate: "SPEEDY2", Timestamp: 360}.Encode() // 0.1 hour later
 	camera4Conn.Write(plate6)
-	time.Sleep(50 * time.Millisecond)
+	processed(t, camera4Conn)
 
 	// Car "LEGAL2" on Road 123 - not speeding
 	plate7, _ := Plate{Plate: "LEGAL2", Timestamp: 0}.Encode()
 	camera3Conn.Write(plate7)
-	time.Sleep(50 * time.Millisecond)
+	processed(t, camera3Conn)
 
 	plate8, _ := Plate{Plate: "LEGAL2", Timestamp: 600}.Encode()
 	camera4Conn.Write(plate8)
-	time.Sleep(100 * time.Millisecond)
+	processed(t, camera4Conn)
 
 	// Check that we have 2 outgoing tickets (SPEEDY1 and SPEEDY2)
 	if len(s.outgoingTickets) != 2 {
@@ -350,10 +584,10 @@ func Test_CompleteScenario_MultipleCamerasDispatchersAndPlates(t *testing.T) {
 	}
 
 	// Dispatcher 1 handles Road 66
-	dispatcher1Conn, _ := net.Dial("tcp", listener.Addr().String())
+	dispatcher1Conn, _ := listener.Dial()
 	defer dispatcher1Conn.Close()
 	dispatcher1Conn.Write(IAmDispatcher{Numroads: 1, Roads: []uint16{66}}.Encode())
-	time.Sleep(100 * time.Millisecond)
+	processed(t, dispatcher1Conn)
 
 	// Dispatcher 1 should receive ticket for SPEEDY1
 	buf := make([]byte, 1024)
@@ -376,17 +610,17 @@ func Test_CompleteScenario_MultipleCamerasDispatchersAndPlates(t *testing.T) {
 	}
 
 	// Now only 1 ticket should remain (SPEEDY2)
-	time.Sleep(100 * time.Millisecond)
+	processed(t, dispatcher1Conn)
 	if len(s.outgoingTickets) != 1 {
 		t.Fatalf("Expected 1 remaining ticket, got %d", len(s.outgoingTickets))
 	}
 
 	// Dispatcher 2 handles multiple roads including Road 123
-	dispatcher2Conn, _ := net.Dial("tcp", listener.Addr().String())
+	dispatcher2Conn, _ := listener.Dial()
 	defer dispatcher2Conn.Close()
 	dispatcher2 := IAmDispatcher{Numroads: 3, Roads: []uint16{99, 123, 456}}
 	dispatcher2Conn.Write(dispatcher2.Encode())
-	time.Sleep(100 * time.Millisecond)
+	processed(t, dispatcher2Conn)
 
 	// Dispatcher 2 should receive ticket for SPEEDY2
 	dispatcher2Conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
@@ -408,13 +642,13 @@ func Test_CompleteScenario_MultipleCamerasDispatchersAndPlates(t *testing.T) {
 	}
 
 	// All tickets should now be sent
-	time.Sleep(100 * time.Millisecond)
+	processed(t, dispatcher2Conn)
 	if len(s.outgoingTickets) != 0 {
 		t.Fatalf("Expected all tickets to be sent, got %d remaining", len(s.outgoingTickets))
 	}
 
 	// Test heartbeats alongside everything else
-	heartbeatConn, _ := net.Dial("tcp", listener.Addr().String())
+	heartbeatConn, _ := listener.Dial()
 	defer heartbeatConn.Close()
 	heartbeatConn.Write(WantHeartBeat{Interval: 1}.Encode())
 
@@ -432,37 +666,37 @@ func Test_CompleteScenario_MultipleCamerasDispatchersAndPlates(t *testing.T) {
 }
 
 func Test_SingleCar_DispatcherConnectsAfterSpeeding(t *testing.T) {
-	s := NewServer()
-	listener, err := server.StartTcpListener(":0", s.handle)
+	s := NewDaemon()
+	listener, err := server.StartPipeListener(s.handle)
 	if err != nil {
 		t.Fatal("Error starting server:", err)
 	}
 	defer listener.Close()
 
 	// Camera 1 on Road 66, Mile 8, Limit 60 mph
-	camera1Conn, _ := net.Dial("tcp", listener.Addr().String())
+	camera1Conn, _ := listener.Dial()
 	defer camera1Conn.Close()
 	camera1 := IAmCamera{Road: 66, Mile: 8, Limit: 60}
 	camera1Conn.Write(camera1.Encode())
-	time.Sleep(50 * time.Millisecond)
+	processed(t, camera1Conn)
 
 	// Camera 2 on Road 66, Mile 9, Limit 60 mph
-	camera2Conn, _ := net.Dial("tcp", listener.Addr().String())
+	camera2Conn, _ := listener.Dial()
 	defer camera2Conn.Close()
 	camera2 := IAmCamera{Road: 66, Mile: 9, Limit: 60}
 	camera2Conn.Write(camera2.Encode())
-	time.Sleep(50 * time.Millisecond)
+	processed(t, camera2Conn)
 
 	// Car passes camera 1 at timestamp 0
 	plate1, _ := Plate{Plate: "UN1X", Timestamp: 0}.Encode()
 	camera1Conn.Write(plate1)
-	time.Sleep(50 * time.Millisecond)
+	processed(t, camera1Conn)
 
 	// Car passes camera 2 at timestamp 45 (45 seconds later)
 	// Distance: 1 mile in 45 seconds = 80 mph (exceeds 60 mph limit)
 	plate2, _ := Plate{Plate: "UN1X", Timestamp: 45}.Encode()
 	camera2Conn.Write(plate2)
-	time.Sleep(100 * time.Millisecond)
+	processed(t, camera2Conn)
 
 	// Verify ticket was created
 	s.mu.Lock()
@@ -474,7 +708,7 @@ func Test_SingleCar_DispatcherConnectsAfterSpeeding(t *testing.T) {
 	}
 
 	// NOW dispatcher connects (after speeding already occurred)
-	dispatcherConn, _ := net.Dial("tcp", listener.Addr().String())
+	dispatcherConn, _ := listener.Dial()
 	defer dispatcherConn.Close()
 	dispatcher := IAmDispatcher{Numroads: 1, Roads: []uint16{66}}
 	dispatcherConn.Write(dispatcher.Encode())
@@ -519,7 +753,7 @@ func Test_SingleCar_DispatcherConnectsAfterSpeeding(t *testing.T) {
 	}
 
 	// Verify ticket was removed from queue
-	time.Sleep(100 * time.Millisecond)
+	processed(t, dispatcherConn)
 	s.mu.Lock()
 	remainingTickets := len(s.outgoingTickets)
 	s.mu.Unlock()
@@ -530,44 +764,44 @@ func Test_SingleCar_DispatcherConnectsAfterSpeeding(t *testing.T) {
 }
 
 func Test_SingleCar_ObservationsInReverseOrder(t *testing.T) {
-	s := NewServer()
-	listener, err := server.StartTcpListener(":0", s.handle)
+	s := NewDaemon()
+	listener, err := server.StartPipeListener(s.handle)
 	if err != nil {
 		t.Fatal("Error starting server:", err)
 	}
 	defer listener.Close()
 
 	// Camera 1 on Road 66, Mile 8, Limit 60 mph
-	camera1Conn, _ := net.Dial("tcp", listener.Addr().String())
+	camera1Conn, _ := listener.Dial()
 	defer camera1Conn.Close()
 	camera1 := IAmCamera{Road: 66, Mile: 8, Limit: 60}
 	camera1Conn.Write(camera1.Encode())
-	time.Sleep(50 * time.Millisecond)
+	processed(t, camera1Conn)
 
 	// Camera 2 on Road 66, Mile 9, Limit 60 mph
-	camera2Conn, _ := net.Dial("tcp", listener.Addr().String())
+	camera2Conn, _ := listener.Dial()
 	defer camera2Conn.Close()
 	camera2 := IAmCamera{Road: 66, Mile: 9, Limit: 60}
 	camera2Conn.Write(camera2.Encode())
-	time.Sleep(50 * time.Millisecond)
+	processed(t, camera2Conn)
 
 	// Dispatcher connects first
-	dispatcherConn, _ := net.Dial("tcp", listener.Addr().String())
+	dispatcherConn, _ := listener.Dial()
 	defer dispatcherConn.Close()
 	dispatcher := IAmDispatcher{Numroads: 1, Roads: []uint16{66}}
 	dispatcherConn.Write(dispatcher.Encode())
-	time.Sleep(50 * time.Millisecond)
+	processed(t, dispatcherConn)
 
 	// Car passes camera 2 at timestamp 45
 	plate2, _ := Plate{Plate: "UN1X", Timestamp: 45}.Encode()
 	camera2Conn.Write(plate2)
-	time.Sleep(50 * time.Millisecond)
+	processed(t, camera2Conn)
 
 	// Car passes camera 1 at timestamp 0 (earlier in time, but reported later)
 	// This simulates out-of-order reporting
 	plate1, _ := Plate{Plate: "UN1X", Timestamp: 0}.Encode()
 	camera1Conn.Write(plate1)
-	time.Sleep(100 * time.Millisecond)
+	processed(t, camera1Conn)
 
 	// Should still detect speeding (1 mile in 45 seconds = 80 mph)
 	buf := make([]byte, 1024)
@@ -597,43 +831,43 @@ func Test_SingleCar_ObservationsInReverseOrder(t *testing.T) {
 }
 
 func Test_PreventDuplicateTicketsOnSameDay(t *testing.T) {
-	s := NewServer()
-	listener, err := server.StartTcpListener(":0", s.handle)
+	s := NewDaemon()
+	listener, err := server.StartPipeListener(s.handle)
 	if err != nil {
 		t.Fatal("Error starting server:", err)
 	}
 	defer listener.Close()
 
 	// Camera 1 on Road 66, Mile 8, Limit 60 mph
-	camera1Conn, _ := net.Dial("tcp", listener.Addr().String())
+	camera1Conn, _ := listener.Dial()
 	defer camera1Conn.Close()
 	camera1 := IAmCamera{Road: 66, Mile: 8, Limit: 60}
 	camera1Conn.Write(camera1.Encode())
-	time.Sleep(50 * time.Millisecond)
+	processed(t, camera1Conn)
 
 	// Camera 2 on Road 66, Mile 9, Limit 60 mph
-	camera2Conn, _ := net.Dial("tcp", listener.Addr().String())
+	camera2Conn, _ := listener.Dial()
 	defer camera2Conn.Close()
 	camera2 := IAmCamera{Road: 66, Mile: 9, Limit: 60}
 	camera2Conn.Write(camera2.Encode())
-	time.Sleep(50 * time.Millisecond)
+	processed(t, camera2Conn)
 
 	// Dispatcher connects
-	dispatcherConn, _ := net.Dial("tcp", listener.Addr().String())
+	dispatcherConn, _ := listener.Dial()
 	defer dispatcherConn.Close()
 	dispatcher := IAmDispatcher{Numroads: 1, Roads: []uint16{66}}
 	dispatcherConn.Write(dispatcher.Encode())
-	time.Sleep(50 * time.Millisecond)
+	processed(t, dispatcherConn)
 
 	// First speeding violation
 	// Speed: 1 mile in 45 seconds = 80 mph
 	plate1a, _ := Plate{Plate: "UN1X", Timestamp: 0}.Encode()
 	camera1Conn.Write(plate1a)
-	time.Sleep(50 * time.Millisecond)
+	processed(t, camera1Conn)
 
 	plate1b, _ := Plate{Plate: "UN1X", Timestamp: 45}.Encode()
 	camera2Conn.Write(plate1b)
-	time.Sleep(100 * time.Millisecond)
+	processed(t, camera2Conn)
 
 	// Should receive first ticket
 	buf := make([]byte, 1024)
@@ -655,14 +889,15 @@ func Test_PreventDuplicateTicketsOnSameDay(t *testing.T) {
 	// Speed: 1 mile in 45 seconds = 80 mph
 	plate2a, _ := Plate{Plate: "UN1X", Timestamp: 1000}.Encode()
 	camera1Conn.Write(plate2a)
-	time.Sleep(50 * time.Millisecond)
+	processed(t, camera1Conn)
 
 	plate2b, _ := Plate{Plate: "UN1X", Timestamp: 1045}.Encode()
 	camera2Conn.Write(plate2b)
-	time.Sleep(200 * time.Millisecond)
+	processed(t, camera2Conn)
 
-	// Should NOT receive a second ticket because it's the same day
-	dispatcherConn.SetReadDeadline(time.Now().Add(1 * time.Second))
+	// Should NOT receive a second ticket because it's the same day. The plates
+	// have been processed, so any ticket would already be waiting.
+	dispatcherConn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
 	n, err = dispatcherConn.Read(buf)
 	if err == nil {
 		ticket2, _ := Ticket{}.Decode(buf[:n])
@@ -673,11 +908,11 @@ func Test_PreventDuplicateTicketsOnSameDay(t *testing.T) {
 	// Speed: 1 mile in 45 seconds = 80 mph
 	plate3a, _ := Plate{Plate: "UN1X", Timestamp: 86400}.Encode()
 	camera1Conn.Write(plate3a)
-	time.Sleep(50 * time.Millisecond)
+	processed(t, camera1Conn)
 
 	plate3b, _ := Plate{Plate: "UN1X", Timestamp: 86445}.Encode()
 	camera2Conn.Write(plate3b)
-	time.Sleep(200 * time.Millisecond)
+	processed(t, camera2Conn)
 
 	// Should receive third ticket (different day)
 	dispatcherConn.SetReadDeadline(time.Now().Add(1 * time.Second))
@@ -699,74 +934,78 @@ func Test_PreventDuplicateTicketsOnSameDay(t *testing.T) {
 }
 
 func Test_TicketAcrossDayBoundary(t *testing.T) {
-	s := NewServer()
-	listener, err := server.StartTcpListener(":0", s.handle)
+	s := NewDaemon()
+	listener, err := server.StartPipeListener(s.handle)
 	if err != nil {
 		t.Fatal("Error starting server:", err)
 	}
 	defer listener.Close()
 
-	cam1, _ := net.Dial("tcp", listener.Addr().String())
+	cam1, _ := listener.Dial()
 	defer cam1.Close()
 	cam1.Write(IAmCamera{Road: 1, Mile: 0, Limit: 60}.Encode())
 
-	cam2, _ := net.Dial("tcp", listener.Addr().String())
+	cam2, _ := listener.Dial()
 	defer cam2.Close()
 	cam2.Write(IAmCamera{Road: 1, Mile: 10, Limit: 60}.Encode())
 
-	time.Sleep(100 * time.Millisecond)
+	processed(t, cam1)
+	processed(t, cam2)
 
 	plate1, _ := Plate{Plate: "CAR", Timestamp: 86000}.Encode()
 	cam1.Write(plate1)
-	time.Sleep(50 * time.Millisecond)
+	processed(t, cam1)
 
 	// Timestamp 86401 = day 1 (different day from ts=86000 which is day 0).
 	// Distance=10mi, time=401s -> 89.8 mph > 60 limit.
 	// Verifies a ticket is correctly generated when observations span
 	// multiple days (the previous defer-in-loop deadlock is impossible
-	// with the single-mutex Server struct).
+	// with the single-mutex Daemon struct).
 	plate2, _ := Plate{Plate: "CAR", Timestamp: 86401}.Encode()
 	cam2.Write(plate2)
 
-	time.Sleep(300 * time.Millisecond)
+	processed(t, cam2)
 
 	s.mu.Lock()
 	ticketCount := len(s.outgoingTickets)
 	s.mu.Unlock()
 
 	if ticketCount == 0 {
-		t.Fatal("Expected ticket to be created (single-mutex Server struct should have fixed the defer-in-loop deadlock)")
+		t.Fatal("Expected ticket to be created (single-mutex Daemon struct should have fixed the defer-in-loop deadlock)")
 	}
 }
 
 func Test_ConcurrentObservations(t *testing.T) {
-	s := NewServer()
-	listener, err := server.StartTcpListener(":0", s.handle)
+	s := NewDaemon()
+	listener, err := server.StartPipeListener(s.handle)
 	if err != nil {
 		t.Fatal("Error starting server:", err)
 	}
 	defer listener.Close()
 
-	cam1, _ := net.Dial("tcp", listener.Addr().String())
+	cam1, _ := listener.Dial()
 	defer cam1.Close()
 	cam1.Write(IAmCamera{Road: 1, Mile: 0, Limit: 60}.Encode())
 
-	cam2, _ := net.Dial("tcp", listener.Addr().String())
+	cam2, _ := listener.Dial()
 	defer cam2.Close()
 	cam2.Write(IAmCamera{Road: 1, Mile: 5, Limit: 60}.Encode())
 
-	cam3, _ := net.Dial("tcp", listener.Addr().String())
+	cam3, _ := listener.Dial()
 	defer cam3.Close()
 	cam3.Write(IAmCamera{Road: 1, Mile: 10, Limit: 60}.Encode())
 
-	time.Sleep(100 * time.Millisecond)
+	processed(t, cam1)
+	processed(t, cam2)
+	processed(t, cam3)
 
 	// Initial observations to establish snapshots
 	plate1, _ := Plate{Plate: "CAR1", Timestamp: 0}.Encode()
 	cam1.Write(plate1)
 	plate2, _ := Plate{Plate: "CAR2", Timestamp: 0}.Encode()
 	cam2.Write(plate2)
-	time.Sleep(50 * time.Millisecond)
+	processed(t, cam1)
+	processed(t, cam2)
 
 	// Fire observations concurrently to exercise the server.
 	var wg sync.WaitGroup
@@ -782,50 +1021,51 @@ func Test_ConcurrentObservations(t *testing.T) {
 		}(i)
 	}
 	wg.Wait()
-	time.Sleep(500 * time.Millisecond)
+	processed(t, cam3)
 }
 
 func Test_SnapshotOverwriteMissesTicket(t *testing.T) {
-	s := NewServer()
-	listener, err := server.StartTcpListener(":0", s.handle)
+	s := NewDaemon()
+	listener, err := server.StartPipeListener(s.handle)
 	if err != nil {
 		t.Fatal("Error starting server:", err)
 	}
 	defer listener.Close()
 
-	cam1, _ := net.Dial("tcp", listener.Addr().String())
+	cam1, _ := listener.Dial()
 	defer cam1.Close()
 	cam1.Write(IAmCamera{Road: 1, Mile: 0, Limit: 60}.Encode())
 
-	cam2, _ := net.Dial("tcp", listener.Addr().String())
+	cam2, _ := listener.Dial()
 	defer cam2.Close()
 	cam2.Write(IAmCamera{Road: 1, Mile: 10, Limit: 60}.Encode())
 
-	time.Sleep(100 * time.Millisecond)
+	processed(t, cam1)
+	processed(t, cam2)
 
 	// Camera 1 observes CarA at ts=0 -> snapshot[{1,0,60}] = {CarA, 0}
 	plateA1, _ := Plate{Plate: "CarA", Timestamp: 0}.Encode()
 	cam1.Write(plateA1)
-	time.Sleep(50 * time.Millisecond)
+	processed(t, cam1)
 
 	// Camera 1 observes CarB at ts=1 -> OVERWRITES snapshot[{1,0,60}] = {CarB, 1}
 	// CarA's observation is now lost.
 	plateB1, _ := Plate{Plate: "CarB", Timestamp: 1}.Encode()
 	cam1.Write(plateB1)
-	time.Sleep(50 * time.Millisecond)
+	processed(t, cam1)
 
 	// Camera 2 observes CarA at ts=300. Speed = 10mi/300s*3600 = 120 mph > 60.
 	// But handlePlate won't find CarA in snapshots (it was overwritten by CarB),
 	// so the plate check filters it out. NO TICKET for CarA — MISSED TICKET BUG.
 	plateA2, _ := Plate{Plate: "CarA", Timestamp: 300}.Encode()
 	cam2.Write(plateA2)
-	time.Sleep(100 * time.Millisecond)
+	processed(t, cam2)
 
 	// Camera 2 observes CarB at ts=600. Speed = 10mi/599s*3600 = 60.1 mph > 60.
 	// Should find CarB's snapshot and generate a ticket.
 	plateB2, _ := Plate{Plate: "CarB", Timestamp: 600}.Encode()
 	cam2.Write(plateB2)
-	time.Sleep(100 * time.Millisecond)
+	processed(t, cam2)
 
 	s.mu.Lock()
 	carAFound := false
@@ -847,3 +1087,90 @@ func Test_SnapshotOverwriteMissesTicket(t *testing.T) {
 		t.Error("CarB should have a speeding ticket")
 	}
 }
+
+// processed waits until the server has handled everything sent on conn.
+func processed(t *testing.T, conn *server.PipeConn) {
+	t.Helper()
+	if err := conn.AwaitProcessed(time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_TicketSurvivesHostileSegmentation(t *testing.T) {
+	for name, faults := range server.HostileSegmentation() {
+		t.Run(name, func(t *testing.T) {
+			s := NewDaemon()
+			listener, err := server.StartPipeListener(s.handle, server.InjectFaults(faults))
+			if err != nil {
+				t.Fatal("Error starting server:", err)
+			}
+			defer listener.Close()
+
+			camera1Conn, _ := listener.Dial()
+			defer camera1Conn.Close()
+			camera2Conn, _ := listener.Dial()
+			defer camera2Conn.Close()
+			dispatcherConn, _ := listener.Dial()
+			defer dispatcherConn.Close()
+
+			// Every message goes out in one write, back to back, so that the
+			// server has to find the boundaries itself.
+			plate1, _ := Plate{Plate: "UN1X", Timestamp: 0}.Encode()
+			plate2, _ := Plate{Plate: "UN1X", Timestamp: 45}.Encode()
+			camera1Conn.Write(append(IAmCamera{Road: 66, Mile: 8, Limit: 60}.Encode(), plate1...))
+			processed(t, camera1Conn)
+			dispatcherConn.Write(IAmDispatcher{Numroads: 1, Roads: []uint16{66}}.Encode())
+			processed(t, dispatcherConn)
+			camera2Conn.Write(append(IAmCamera{Road: 66, Mile: 9, Limit: 60}.Encode(), plate2...))
+			processed(t, camera2Conn)
+
+			expected := Ticket{Plate: "UN1X", Road: 66, Mile1: 8, Timestamp1: 0, Mile2: 9, Timestamp2: 45, Speed: 8000}
+			expectedBytes, _ := expected.Encode()
+			buf := make([]byte, len(expectedBytes))
+			dispatcherConn.SetReadDeadline(time.Now().Add(time.Second))
+			if _, err := io.ReadFull(dispatcherConn, buf); err != nil {
+				t.Fatal("Expected to receive speeding ticket:", err)
+			}
+			ticket, err := Ticket{}.Decode(buf)
+			if err != nil {
+				t.Fatal("Error decoding ticket:", err)
+			}
+			if !reflect.DeepEqual(ticket, expected) {
+				t.Fatalf("Expected ticket %+v, got %+v", expected, ticket)
+			}
+		})
+	}
+}
+
+func TestCheckHealth(t *testing.T) {
+	listener, err := server.StartPipeListener(NewDaemon().handle)
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, _ := listener.Dial()
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if err := CheckHealth(conn); err != nil {
+		t.Fatal("Expected the service to be healthy:", err)
+	}
+}
+
+func TestCheckHealthWaitsForMinHeartbeatInterval(t *testing.T) {
+	Settings{MinHeartbeatInterval: 200 * time.Millisecond}.Apply()
+	t.Cleanup(Settings{}.Apply)
+
+	listener, err := server.StartPipeListener(NewDaemon().handle)
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, _ := listener.Dial()
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(50 * time.Millisecond)) // Shorter than the interval
+	if err := CheckHealth(conn); err != nil {
+		t.Fatal("Expected the check to wait for the first heartbeat:", err)
+	}
+}
@@ -0,0 +1,89 @@
+package supervisor
+
+import (
+	"TDMR87/go_protohackers/internal/server"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"runtime/debug"
+)
+
+// errListenerClosed is reported for servers whose listener was closed under
+// them.
+var errListenerClosed = errors.New("listener closed")
+
+// TCP returns a service that serves a server made by newServer. Each
+// restart gets a new server, so services that keep their state in the server
+// start afresh. The service fails if its listener dies or one of its handlers
+// panics, as the panic may have left that state inconsistent.
+func TCP(name string, newServer func() *server.Server) Service {
+	return Service{
+		Name: name,
+		Run: func(ctx context.Context) error {
+			srv := newServer()
+			srv.Middleware = append([]server.Middleware{failOnPanic(ctx)}, srv.Middleware...)
+			err := srv.Serve(ctx)
+			if err != nil || ctx.Err() != nil {
+				return err
+			}
+
+			// Serve returns early if the listener dies, leaving the
+			// connections it accepted running. Close them, so that they
+			// don't linger next to the restarted server.
+			closed, cancel := context.WithCancel(context.Background())
+			cancel()
+			srv.Shutdown(closed)
+			return errListenerClosed
+		},
+	}
+}
+
+// UDP is like TCP, for UDP servers.
+func UDP(name string, newServer func() *server.UdpServer) Service {
+	return Service{
+		Name: name,
+		Run: func(ctx context.Context) error {
+			srv := newServer()
+			srv.Middleware = append([]server.UdpMiddleware{failOnUdpPanic(ctx)}, srv.Middleware...)
+			err := srv.Serve(ctx)
+			if err != nil || ctx.Err() != nil {
+				return err
+			}
+			return errListenerClosed
+		},
+	}
+}
+
+// failOnPanic recovers from a panicking handler like server.Recover does,
+// and also fails the service running with ctx.
+func failOnPanic(ctx context.Context) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(conn net.Conn) {
+			defer func() {
+				if r := recover(); r != nil {
+					server.Logger(conn).Error("Recovered from panic in handler", "panic", r, "stack", string(debug.Stack()))
+					conn.Close()
+					Fail(ctx, fmt.Errorf("handler panicked: %v", r))
+				}
+			}()
+			next(conn)
+		}
+	}
+}
+
+// failOnUdpPanic is failOnPanic for UDP handlers.
+func failOnUdpPanic(ctx context.Context) server.UdpMiddleware {
+	return func(next server.UdpHandler) server.UdpHandler {
+		return func(conn server.UdpConn, buf []byte, n int, addr *net.UDPAddr) {
+			defer func() {
+				if r := recover(); r != nil {
+					slog.Error("Recovered from panic in handler", "remote_addr", addr.String(), "panic", r, "stack", string(debug.Stack()))
+					Fail(ctx, fmt.Errorf("handler panicked: %v", r))
+				}
+			}()
+			next(conn, buf, n, addr)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Package supervisor runs several services in one process and restarts any
+// of them that fails, so that they can share a single container.
+package supervisor
+
+import (
+	"TDMR87/go_protohackers/internal/server"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMinBackoff is how long a failed service waits before its first
+	// restart, unless MinBackoff is set. Each consecutive failure doubles the
+	// wait, up to DefaultMaxBackoff unless MaxBackoff is set.
+	DefaultMinBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// Service is something the Supervisor keeps running.
+type Service struct {
+	Name string
+
+	// Run serves until ctx is cancelled. Returning before that, with or
+	// without an error, or panicking, counts as a failure, as does calling
+	// Fail with ctx.
+	Run func(ctx context.Context) error
+}
+
+// State is where a service is in its lifecycle.
+type State string
+
+const (
+	Starting   State = "starting"
+	Running    State = "running"
+	Restarting State = "restarting" // Failed, waiting to be restarted
+	Stopped    State = "stopped"
+)
+
+// Status reports on one service.
+type Status struct {
+	Name      string    `json:"name"`
+	State     State     `json:"state"`
+	Since     time.Time `json:"since"` // When the service entered State
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Supervisor runs Services, restarting each one that fails with exponential
+// backoff, and reports their status.
+//
+// Panics are only caught in the goroutine that calls Run, and in handlers if
+// the service is built with TCP or UDP. A panic in any other goroutine still
+// takes down the whole process.
+type Supervisor struct {
+	Services []Service
+
+	// MinBackoff and MaxBackoff bound the wait before restarting a failed
+	// service. The wait starts over at MinBackoff once a service has stayed
+	// up for MaxBackoff. Zero means DefaultMinBackoff and DefaultMaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Logger is used for the supervisor's own messages. Nil means
+	// slog.Default().
+	Logger *slog.Logger
+
+	mu       sync.Mutex
+	statuses []*Status
+}
+
+func New(services ...Service) *Supervisor {
+	return &Supervisor{Services: services}
+}
+
+// Run runs every service until ctx is cancelled, then waits for them to
+// stop.
+func (s *Supervisor) Run(ctx context.Context) error {
+	if len(s.Services) == 0 {
+		return errors.New("no services to run")
+	}
+	seen := make(map[string]bool)
+	for _, service := range s.Services {
+		if seen[service.Name] {
+			return fmt.Errorf("service %q is listed twice", service.Name)
+		}
+		seen[service.Name] = true
+	}
+
+	s.mu.Lock()
+	s.statuses = make([]*Status, len(s.Services))
+	for i, service := range s.Services {
+		s.statuses[i] = &Status{Name: service.Name, State: Starting, Since: time.Now()}
+	}
+	s.mu.Unlock()
+
+	var running sync.WaitGroup
+	for i, service := range s.Services {
+		running.Go(func() { s.supervise(ctx, service, s.statuses[i]) })
+	}
+	running.Wait()
+	return nil
+}
+
+// supervise runs service until ctx is cancelled, restarting it whenever it
+// fails.
+func (s *Supervisor) supervise(ctx context.Context, service Service, status *Status) {
+	logger := s.logger().With("service", service.Name)
+	up := server.NewGauge("supervisor_service_up", "Whether a service is running (1) or not (0).", "service", service.Name)
+	restarts := server.NewCounter("supervisor_restarts_total", "Times a service was restarted after failing.", "service", service.Name)
+	defer up.Set(0)
+
+	backoff := s.minBackoff()
+	for {
+		s.setState(status, Running, nil)
+		up.Set(1)
+		started := time.Now()
+		err := s.runOnce(ctx, service)
+		up.Set(0)
+
+		if ctx.Err() != nil {
+			s.setState(status, Stopped, nil)
+			logger.Info("Service stopped")
+			return
+		}
+
+		if time.Since(started) >= s.maxBackoff() {
+			backoff = s.minBackoff() // It had been up for a while, so start over
+		}
+		s.setState(status, Restarting, err)
+		logger.Error("Service failed, restarting", "err", err, "retry_in", backoff)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			s.setState(status, Stopped, err)
+			return
+		}
+		backoff = min(2*backoff, s.maxBackoff())
+
+		s.mu.Lock()
+		status.Restarts++
+		s.mu.Unlock()
+		restarts.Inc()
+	}
+}
+
+// failKey is the context key under which a service's run context holds the
+// function that fails it.
+type failKey struct{}
+
+// errStopped is reported for services whose Run returned early without an
+// error.
+var errStopped = errors.New("service stopped unexpectedly")
+
+// runOnce runs service until it returns, panics or fails, and reports why
+// unless ctx was cancelled.
+func (s *Supervisor) runOnce(ctx context.Context, service Service) (err error) {
+	runCtx, fail := context.WithCancelCause(ctx)
+	defer fail(nil)
+	runCtx = context.WithValue(runCtx, failKey{}, fail)
+
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger().Error("Recovered from panic in service", "service", service.Name, "panic", r, "stack", string(debug.Stack()))
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	err = service.Run(runCtx)
+	if cause := context.Cause(runCtx); ctx.Err() == nil && cause != nil {
+		return cause // Failed through Fail
+	}
+	if err == nil {
+		err = errStopped
+	}
+	return err
+}
+
+// Fail marks the service whose run context is ctx as failed, which cancels
+// ctx so that the service stops and is restarted. It does nothing if ctx
+// doesn't belong to a supervised service.
+func Fail(ctx context.Context, err error) {
+	if fail, ok := ctx.Value(failKey{}).(context.CancelCauseFunc); ok {
+		fail(err)
+	}
+}
+
+func (s *Supervisor) setState(status *Status, state State, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status.State = state
+	status.Since = time.Now()
+	if err != nil {
+		status.LastError = err.Error()
+	}
+}
+
+// Status reports on every service, in the order of Services.
+func (s *Supervisor) Status() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]Status, len(s.statuses))
+	for i, status := range s.statuses {
+		statuses[i] = *status
+	}
+	return statuses
+}
+
+// ServeHTTP reports the status of every service as JSON. The response is
+// 200 OK if all of them are running and 503 Service Unavailable otherwise,
+// so that it can serve as a health check.
+func (s *Supervisor) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	statuses := s.Status()
+	code := http.StatusOK
+	for _, status := range statuses {
+		if status.State != Running {
+			code = http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(statuses)
+}
+
+func (s *Supervisor) minBackoff() time.Duration {
+	if s.MinBackoff > 0 {
+		return s.MinBackoff
+	}
+	return DefaultMinBackoff
+}
+
+func (s *Supervisor) maxBackoff() time.Duration {
+	if s.MaxBackoff > 0 {
+		return s.MaxBackoff
+	}
+	return DefaultMaxBackoff
+}
+
+func (s *Supervisor) logger() *slog.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return slog.Default()
+}
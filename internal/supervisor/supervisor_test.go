@@ -0,0 +1,219 @@
+package supervisor
+
+import (
+	"TDMR87/go_protohackers/internal/server"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startSupervisor runs services until the test ends.
+func startSupervisor(t *testing.T, services ...Service) *Supervisor {
+	t.Helper()
+	s := New(services...)
+	s.MinBackoff = time.Millisecond
+	s.MaxBackoff = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error("Unexpected error from Run:", err)
+		}
+	})
+	return s
+}
+
+// waitForStatus waits until the named service's status satisfies ok.
+func waitForStatus(t *testing.T, s *Supervisor, name string, ok func(Status) bool) Status {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		for _, status := range s.Status() {
+			if status.Name == name && ok(status) {
+				return status
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s, statuses: %+v", name, s.Status())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func restarted(status Status) bool { return status.Restarts > 0 && status.State == Running }
+
+func TestRestartsFailedServices(t *testing.T) {
+	tests := map[string]func(ctx context.Context) error{
+		"error":  func(ctx context.Context) error { return errors.New("exploded") },
+		"return": func(ctx context.Context) error { return nil },
+		"panic":  func(ctx context.Context) error { panic("exploded") },
+		"fail": func(ctx context.Context) error {
+			Fail(ctx, errors.New("exploded"))
+			<-ctx.Done()
+			return nil
+		},
+	}
+	for name, fail := range tests {
+		t.Run(name, func(t *testing.T) {
+			var runs atomic.Int32
+			s := startSupervisor(t, Service{Name: name, Run: func(ctx context.Context) error {
+				if runs.Add(1) == 1 {
+					return fail(ctx)
+				}
+				<-ctx.Done()
+				return nil
+			}})
+
+			status := waitForStatus(t, s, name, restarted)
+			if status.Restarts != 1 || status.LastError == "" {
+				t.Fatalf("Expected one restart with an error, got %+v", status)
+			}
+		})
+	}
+}
+
+func TestFailingServiceDoesNotAffectOthers(t *testing.T) {
+	var steadyRuns atomic.Int32
+	s := startSupervisor(t,
+		Service{Name: "flaky", Run: func(ctx context.Context) error { return errors.New("exploded") }},
+		Service{Name: "steady", Run: func(ctx context.Context) error {
+			steadyRuns.Add(1)
+			<-ctx.Done()
+			return nil
+		}},
+	)
+
+	waitForStatus(t, s, "flaky", func(status Status) bool { return status.Restarts >= 3 })
+	if status := s.Status()[1]; status.State != Running || status.Restarts != 0 || steadyRuns.Load() != 1 {
+		t.Fatalf("Expected the steady service to be left alone, got %+v", status)
+	}
+}
+
+func TestStatusEndpoint(t *testing.T) {
+	s := startSupervisor(t,
+		Service{Name: "flaky", Run: func(ctx context.Context) error { return errors.New("exploded") }},
+	)
+	waitForStatus(t, s, "flaky", func(status Status) bool { return status.Restarts > 0 })
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 while a service is failing, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestStopsServicesWhenCancelled(t *testing.T) {
+	s := New(Service{Name: "steady", Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Run(ctx); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if status := s.Status()[0]; status.State != Stopped || status.Restarts != 0 {
+		t.Fatalf("Expected the service to be stopped, got %+v", status)
+	}
+}
+
+func TestRejectsDuplicateServices(t *testing.T) {
+	run := func(ctx context.Context) error { return nil }
+	s := New(Service{Name: "a", Run: run}, Service{Name: "a", Run: run})
+	if err := s.Run(context.Background()); err == nil {
+		t.Fatal("Expected an error for a service listed twice")
+	}
+}
+
+// newTestServer returns a server that panics on connections that send
+// "panic", and passes on the listener it serves.
+func newTestServer(listeners chan<- net.Listener) func() *server.Server {
+	return func() *server.Server {
+		srv := server.NewServer("", func(conn net.Conn) {
+			defer conn.Close()
+			buf := make([]byte, 5)
+			n, _ := conn.Read(buf)
+			if string(buf[:n]) == "panic" {
+				panic("handler exploded")
+			}
+			conn.Write(buf[:n])
+		})
+		srv.ShutdownTimeout = 100 * time.Millisecond
+		srv.Listener, _ = net.Listen("tcp", "127.0.0.1:0")
+		listeners <- srv.Listener
+		return srv
+	}
+}
+
+func TestTCPRestartsOnHandlerPanic(t *testing.T) {
+	listeners := make(chan net.Listener, 2)
+	s := startSupervisor(t, TCP("tcp", newTestServer(listeners)))
+
+	conn, err := net.Dial("tcp", (<-listeners).Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("panic"))
+
+	status := waitForStatus(t, s, "tcp", restarted)
+	if status.LastError != "handler panicked: handler exploded" {
+		t.Fatalf("Unexpected error %q", status.LastError)
+	}
+	conn, err = net.Dial("tcp", (<-listeners).Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to the restarted server:", err)
+	}
+	conn.Close()
+}
+
+func TestTCPRestartsWhenListenerDies(t *testing.T) {
+	listeners := make(chan net.Listener, 2)
+	s := startSupervisor(t, TCP("tcp", newTestServer(listeners)))
+
+	listener := <-listeners
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Close()
+	listener.Close()
+
+	status := waitForStatus(t, s, "tcp", restarted)
+	if status.LastError != errListenerClosed.Error() {
+		t.Fatalf("Unexpected error %q", status.LastError)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("Expected the old server's connection to be closed")
+	}
+}
+
+func TestUDPRestartsOnHandlerPanic(t *testing.T) {
+	addrs := make(chan net.Addr, 2)
+	s := startSupervisor(t, UDP("udp", func() *server.UdpServer {
+		srv := server.NewUdpServer("127.0.0.1:0", func(conn server.UdpConn, buf []byte, n int, addr *net.UDPAddr) {
+			panic("handler exploded")
+		})
+		srv.Listen()
+		addrs <- srv.LocalAddr()
+		return srv
+	}))
+
+	conn, err := net.Dial("udp", (<-addrs).String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("hello"))
+
+	waitForStatus(t, s, "udp", restarted)
+}
@@ -0,0 +1,24 @@
+package unusualdatabase
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// CheckHealth checks that the database on the other end of conn reports its
+// version.
+func CheckHealth(conn net.Conn) error {
+	if _, err := conn.Write([]byte("version")); err != nil {
+		return err
+	}
+	buf := make([]byte, 1000)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return fmt.Errorf("reading version: %w", err)
+	}
+	if version, ok := strings.CutPrefix(string(buf[:n]), "version="); !ok || version == "" {
+		return fmt.Errorf("expected a version, got %q", buf[:n])
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// Package unusualdatabase implements Protohackers problem 4, Unusual Database
+// Program: a key-value store over UDP.
+package unusualdatabase
+
+import (
+	"TDMR87/go_protohackers/internal/server"
+	"net"
+	"strings"
+	"sync"
+)
+
+// NewServer returns a server for the service on addr, with an empty database
+// of its own, configured the way it is deployed.
+func NewServer(addr string) *server.UdpServer {
+	db := NewDatabase()
+	server.NewGaugeFunc("unusual_database_keys", "Keys stored in the database.", func() float64 {
+		db.Lock.RLock()
+		defer db.Lock.RUnlock()
+		return float64(len(db.Store))
+	})
+
+	srv := server.NewUdpServer(addr, db.handle)
+	srv.Name = "unusual_database_program"
+	return srv
+}
+
+func (db *Database) handle(conn server.UdpConn, buf []byte, n int, clientAddr *net.UDPAddr) {
+	msg := string(buf[:n])
+
+	if msg == "version" {
+		val := db.Retrieve(msg)
+		response := msg + "=" + val
+		conn.WriteToUDP([]byte(response), clientAddr)
+		retrievalsTotal.Inc()
+	} else if ContainsEqualsSign(msg) {
+		key, val := parse(msg)
+		if key != "version" {
+			db.Insert(key, val)
+		}
+		insertsTotal.Inc()
+	} else {
+		val := db.Retrieve(msg)
+		response := msg + "=" + val
+		conn.WriteToUDP([]byte(response), clientAddr)
+		retrievalsTotal.Inc()
+	}
+}
+
+var (
+	insertsTotal    = server.NewCounter("unusual_database_inserts_total", "Insert requests received.")
+	retrievalsTotal = server.NewCounter("unusual_database_retrievals_total", "Retrieve requests answered.")
+)
+
+type Database struct {
+	Store map[string]string
+	Lock  sync.RWMutex
+}
+
+func NewDatabase() *Database {
+	return &Database{
+		Store: map[string]string{
+			"version": "6.6.6",
+		},
+	}
+}
+
+func (db *Database) Retrieve(key string) string {
+	db.Lock.Lock()
+	defer db.Lock.Unlock()
+	if db.Store[key] != "" {
+		return db.Store[key]
+	} else {
+		return ""
+	}
+}
+
+func (db *Database) Insert(key string, val string) {
+	db.Lock.Lock()
+	defer db.Lock.Unlock()
+	db.Store[key] = val
+}
+
+func parse(msg string) (key string, val string) {
+	if k, v, ok := strings.Cut(msg, "="); ok {
+		key = k
+		val = v
+	}
+	return
+}
+
+func ContainsEqualsSign(msg string) bool {
+	for _, r := range msg {
+		if r == '=' {
+			return true
+		}
+	}
+
+	return false
+}
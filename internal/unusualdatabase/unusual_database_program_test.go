@@ -1,14 +1,15 @@
-package main
+package unusualdatabase
 
 import (
 	"TDMR87/go_protohackers/internal/server"
 	"net"
+	"runtime"
 	"testing"
 	"time"
 )
 
 func TestServer(t *testing.T) {
-	listener, _ := server.StartUdpListener(":8080", handle)
+	listener, _ := server.StartUdpListener(":8080", NewDatabase().handle)
 	defer listener.Close()
 
 	serverAddr, err := net.ResolveUDPAddr("udp", listener.LocalAddr().String())
@@ -24,10 +25,11 @@ func TestServer(t *testing.T) {
 
     // Insert
     conn.Write([]byte("message=hello"))
-	time.Sleep(50 * time.Millisecond)
 
-	// Get
+	// Get. Datagrams from one source are handled in order, so the insert is
+	// done by the time this is.
 	conn.Write([]byte("message"))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
 	buf := make([]byte, 1000)
 	n, _, _ := conn.ReadFromUDP(buf)
 	response := string(buf[:n])
@@ -37,7 +39,7 @@ func TestServer(t *testing.T) {
 }
 
 func TestNonExistentKey(t *testing.T) {
-	listener, _ := server.StartUdpListener(":8080", handle)
+	listener, _ := server.StartUdpListener(":8080", NewDatabase().handle)
 	defer listener.Close()
 
 	serverAddr, err := net.ResolveUDPAddr("udp", listener.LocalAddr().String())
@@ -61,7 +63,7 @@ func TestNonExistentKey(t *testing.T) {
 }
 
 func TestRetrieveVersion(t *testing.T) {
-	listener, _ := server.StartUdpListener(":8080", handle)
+	listener, _ := server.StartUdpListener(":8080", NewDatabase().handle)
 	defer listener.Close()
 
 	serverAddr, err := net.ResolveUDPAddr("udp", listener.LocalAddr().String())
@@ -85,7 +87,7 @@ func TestRetrieveVersion(t *testing.T) {
 }
 
 func TestInsertVersion(t *testing.T) {
-	listener, _ := server.StartUdpListener(":8080", handle)
+	listener, _ := server.StartUdpListener(":8080", NewDatabase().handle)
 	defer listener.Close()
 
 	serverAddr, err := net.ResolveUDPAddr("udp", listener.LocalAddr().String())
@@ -159,4 +161,51 @@ func TestParseMessage(t *testing.T) {
 			t.Fatalf("Expected value %s, got %s", tt.ExpectedVal, val)
 		}
 	}
-}
\ No newline at end of file
+}
+func TestOpenAndCloseManyListeners(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	for range 50 {
+		listener, err := server.StartUdpListener("127.0.0.1:0", NewDatabase().handle)
+		if err != nil {
+			t.Fatal("Error starting server:", err)
+		}
+
+		serverAddr := listener.LocalAddr().(*net.UDPAddr)
+		conn, err := net.DialUDP("udp", nil, serverAddr)
+		if err != nil {
+			t.Fatal("Connecting to the server failed", err)
+		}
+		conn.Write([]byte("version"))
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		conn.Read(make([]byte, 1000))
+		conn.Close()
+
+		if err := listener.Close(); err != nil {
+			t.Fatal("Error closing server:", err)
+		}
+	}
+
+	// Close waits for the read loop and workers, so nothing should be left
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatalf("Leaked goroutines: %d before, %d after", before, after)
+	}
+}
+
+func TestCheckHealth(t *testing.T) {
+	listener, err := server.StartUdpListener("127.0.0.1:0", NewDatabase().handle)
+	if err != nil {
+		t.Fatal("Error starting server:", err)
+	}
+	defer listener.Close()
+
+	conn, err := net.Dial("udp", listener.LocalAddr().String())
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if err := CheckHealth(conn); err != nil {
+		t.Fatal("Expected the database to be healthy:", err)
+	}
+}